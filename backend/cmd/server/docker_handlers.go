@@ -0,0 +1,618 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"devops-unity-backend/pkg/config"
+	"devops-unity-backend/pkg/docker"
+)
+
+// allDockerEndpoints selects every endpoint on routes that aggregate.
+const allDockerEndpoints = "all"
+
+// dockerEndpointName returns the endpoint requested through the endpoint
+// query parameter or the X-Docker-Endpoint header.
+func dockerEndpointName(c *gin.Context) string {
+	if name := c.Query("endpoint"); name != "" {
+		return name
+	}
+	return c.GetHeader("X-Docker-Endpoint")
+}
+
+// selectDockerEndpoint resolves the requested endpoint for every Docker route.
+func selectDockerEndpoint(c *gin.Context) {
+	name := dockerEndpointName(c)
+	if name == allDockerEndpoints {
+		c.Next()
+		return
+	}
+
+	dm, err := dockerEndpoints.Get(name)
+	if err != nil {
+		c.AbortWithStatusJSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	c.Set("dockerManager", dm)
+	c.Next()
+}
+
+// requireSingleDockerEndpoint rejects endpoint=all on routes that act on
+// one endpoint.
+func requireSingleDockerEndpoint(c *gin.Context) bool {
+	if dockerEndpointName(c) == allDockerEndpoints {
+		c.JSON(400, gin.H{"error": "endpoint=all is not supported on this route, select one endpoint"})
+		return false
+	}
+	return true
+}
+
+// dockerFor returns the manager selected by selectDockerEndpoint.
+func dockerFor(c *gin.Context) *docker.DockerManager {
+	if dm, ok := c.Get("dockerManager"); ok {
+		return dm.(*docker.DockerManager)
+	}
+	return nil
+}
+
+// requireDocker aborts the request when the selected Docker daemon is not
+// reachable. Handlers added after the mock era have no mock fallback.
+func requireDocker(c *gin.Context) bool {
+	if !checkDockerAvailable(c) {
+		c.JSON(503, gin.H{"error": "Docker daemon is not available"})
+		return false
+	}
+	return true
+}
+
+// showSecrets reads show_secrets=true. Unmasking must be enabled with
+// server.allowShowSecrets in the config; otherwise the request is aborted
+// with 403 and ok is false.
+func showSecrets(c *gin.Context) (show, ok bool) {
+	if c.Query("show_secrets") != "true" {
+		return false, true
+	}
+	if !config.GlobalConfig.Server.AllowShowSecrets {
+		c.JSON(403, gin.H{"error": "showing secret values is disabled, set server.allowShowSecrets in the config"})
+		return false, false
+	}
+	return true, true
+}
+
+func inspectContainer(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+	show, ok := showSecrets(c)
+	if !ok {
+		return
+	}
+
+	details, err := dockerFor(c).InspectContainer(c.Param("id"), show)
+	if cerrdefs.IsNotFound(err) {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"container": details})
+}
+
+func runContainer(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	var spec docker.ContainerSpec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	logrus.Infof("Running container from image: %s", spec.Image)
+	container, err := dockerFor(c).RunContainer(spec)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"container": container})
+}
+
+func recreateContainer(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	var changes docker.ContainerSpec
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	logrus.Infof("Recreating container: %s", id)
+	container, err := dockerFor(c).RecreateContainer(id, changes)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"container": container})
+}
+
+func getDockerEndpoints(c *gin.Context) {
+	c.JSON(200, gin.H{"endpoints": dockerEndpoints.Status()})
+}
+
+func checkDockerEndpoints(c *gin.Context) {
+	c.JSON(200, gin.H{"endpoints": dockerEndpoints.CheckHealth()})
+}
+
+func getDockerDiskUsage(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	report, err := dockerFor(c).DiskUsage()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"disk_usage": report})
+}
+
+func pruneDocker(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	var opts docker.PruneOptions
+	if err := c.ShouldBindJSON(&opts); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	logrus.Infof("Pruning Docker objects %v (dry run: %t)", opts.Targets, opts.DryRun)
+	result, err := dockerFor(c).Prune(opts)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"prune": result})
+}
+
+func listContainerFiles(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	entries, err := dockerFor(c).ListDirectory(c.Param("id"), c.DefaultQuery("path", "/"))
+	if err != nil {
+		status := 500
+		if cerrdefs.IsNotFound(err) {
+			status = 404
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"files": entries})
+}
+
+func downloadContainerFiles(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	id := c.Param("id")
+	p := c.Query("path")
+	format := c.DefaultQuery("format", "tar")
+	if p == "" {
+		c.JSON(400, gin.H{"error": "path is required"})
+		return
+	}
+	if format != "tar" && format != "zip" {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("unsupported archive format %q", format)})
+		return
+	}
+
+	// Stat first so errors can still be reported as JSON
+	entry, err := dockerFor(c).StatPath(id, p)
+	if err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-tar")
+	if format == "zip" {
+		c.Header("Content-Type", "application/zip")
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", entry.Name+"."+format))
+	if err := dockerFor(c).DownloadPath(id, p, format, c.Writer); err != nil {
+		logrus.Errorf("Failed to download %s from container %s: %v", p, id, err)
+	}
+}
+
+func uploadContainerFile(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	id := c.Param("id")
+	dir := c.DefaultQuery("path", "/")
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	content, err := file.Open()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+
+	// Archives are extracted in place; anything else is written as a file
+	if c.Query("extract") == "true" {
+		err = dockerFor(c).UploadArchive(id, dir, content)
+	} else {
+		err = dockerFor(c).UploadFile(id, path.Join(dir, filepath.Base(file.Filename)), content, file.Size, 0)
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	logrus.Infof("Uploaded %s to container %s:%s", file.Filename, id, dir)
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Uploaded %s to %s", file.Filename, dir)})
+}
+
+func diffContainer(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	changes, err := dockerFor(c).DiffContainer(c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"changes": changes})
+}
+
+// Image references are passed in the query string or body rather than the
+// path because repository names contain slashes.
+
+func inspectImage(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+	show, ok := showSecrets(c)
+	if !ok {
+		return
+	}
+
+	details, err := dockerFor(c).InspectImage(c.Query("image"), show)
+	if err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"image": details})
+}
+
+func tagImage(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	// Either an explicit target, or a registry the target is derived for
+	var body struct {
+		Source     string `json:"source"`
+		Target     string `json:"target"`
+		Registry   string `json:"registry"`
+		Repository string `json:"repository"`
+		Tag        string `json:"tag"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Source == "" || (body.Target == "" && body.Registry == "") {
+		c.JSON(400, gin.H{"error": "source and either target or registry are required"})
+		return
+	}
+
+	target := body.Target
+	var err error
+	if target == "" {
+		host := body.Registry
+		if reg, ok := imageRegistries[body.Registry]; ok {
+			host = reg.Config().Host()
+		}
+		target, err = dockerFor(c).TagForRegistry(body.Source, host, body.Repository, body.Tag)
+	} else {
+		err = dockerFor(c).TagImage(body.Source, target)
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	logrus.Infof("Tagged image %s as %s", body.Source, target)
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Tagged %s as %s", body.Source, target), "target": target})
+}
+
+// pushImage streams push progress as newline-delimited JSON. Credentials
+// come from the request, the named registry, or the configured registry
+// matching the image host.
+func pushImage(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	var body struct {
+		Image    string `json:"image"`
+		Registry string `json:"registry"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Image == "" {
+		c.JSON(400, gin.H{"error": "image is required"})
+		return
+	}
+	ref, err := docker.ParseImageReference(body.Image)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Stored credentials only go to the host they belong to
+	var auth *docker.RegistryAuth
+	if body.Username != "" {
+		auth = &docker.RegistryAuth{Username: body.Username, Password: body.Password}
+	} else if body.Registry != "" {
+		reg, ok := imageRegistries[body.Registry]
+		if !ok {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("unknown registry %q", body.Registry)})
+			return
+		}
+		if host := reg.Config().Host(); host != ref.Registry {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("image %s is not hosted on registry %s (%s)", body.Image, body.Registry, host)})
+			return
+		}
+		auth = reg.Config().Auth()
+	} else {
+		for _, reg := range imageRegistries {
+			if reg.Config().Host() == ref.Registry {
+				auth = reg.Config().Auth()
+				break
+			}
+		}
+	}
+
+	logrus.Infof("Pushing image: %s", body.Image)
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(200)
+	encoder := json.NewEncoder(c.Writer)
+	result, err := dockerFor(c).PushImage(body.Image, auth, func(p docker.PushProgress) {
+		encoder.Encode(gin.H{"progress": p})
+		c.Writer.Flush()
+	})
+	if err != nil {
+		logrus.Errorf("Failed to push image %s: %v", body.Image, err)
+		encoder.Encode(gin.H{"error": err.Error()})
+		return
+	}
+	encoder.Encode(gin.H{"result": result})
+}
+
+func getImageRegistries(c *gin.Context) {
+	registries := make([]docker.RegistryConfig, 0, len(imageRegistries))
+	for _, reg := range imageRegistries {
+		registries = append(registries, reg.Config())
+	}
+	sort.Slice(registries, func(i, j int) bool { return registries[i].Name < registries[j].Name })
+	c.JSON(200, gin.H{"registries": registries})
+}
+
+// registryFor returns the registry named in the path, or aborts with 404.
+func registryFor(c *gin.Context) *docker.RegistryClient {
+	reg, ok := imageRegistries[c.Param("name")]
+	if !ok {
+		c.JSON(404, gin.H{"error": fmt.Sprintf("unknown registry %q", c.Param("name"))})
+		return nil
+	}
+	return reg
+}
+
+func listRegistryRepositories(c *gin.Context) {
+	reg := registryFor(c)
+	if reg == nil {
+		return
+	}
+
+	n, _ := strconv.Atoi(c.DefaultQuery("n", "100"))
+	page, err := reg.ListRepositories(c.Query("last"), n)
+	if err != nil {
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"repositories": page.Items, "next": page.Next})
+}
+
+func listRegistryTags(c *gin.Context) {
+	reg := registryFor(c)
+	if reg == nil {
+		return
+	}
+
+	repository := c.Query("repository")
+	if repository == "" {
+		c.JSON(400, gin.H{"error": "repository is required"})
+		return
+	}
+	n, _ := strconv.Atoi(c.DefaultQuery("n", "100"))
+	page, err := reg.ListTags(repository, c.Query("last"), n)
+	if err != nil {
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"repository": repository, "tags": page.Items, "next": page.Next})
+}
+
+func getRegistryManifest(c *gin.Context) {
+	reg := registryFor(c)
+	if reg == nil {
+		return
+	}
+
+	repository, ref := c.Query("repository"), c.DefaultQuery("reference", "latest")
+	if repository == "" {
+		c.JSON(400, gin.H{"error": "repository is required"})
+		return
+	}
+	manifest, err := reg.GetManifest(repository, ref)
+	if err != nil {
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"manifest": manifest})
+}
+
+// tagRegistryManifest adds a tag to a manifest already in the registry.
+func tagRegistryManifest(c *gin.Context) {
+	reg := registryFor(c)
+	if reg == nil {
+		return
+	}
+
+	var body struct {
+		Repository string `json:"repository"`
+		Source     string `json:"source"` // tag or digest
+		Tag        string `json:"tag"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Repository == "" || body.Source == "" || body.Tag == "" {
+		c.JSON(400, gin.H{"error": "repository, source and tag are required"})
+		return
+	}
+	manifest, err := reg.TagManifest(body.Repository, body.Source, body.Tag)
+	if err != nil {
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+	logrus.Infof("Tagged %s:%s as %s in registry %s", body.Repository, body.Source, body.Tag, c.Param("name"))
+	c.JSON(200, gin.H{"manifest": manifest})
+}
+
+func deleteRegistryManifest(c *gin.Context) {
+	reg := registryFor(c)
+	if reg == nil {
+		return
+	}
+
+	repository, ref := c.Query("repository"), c.Query("reference")
+	if repository == "" || ref == "" {
+		c.JSON(400, gin.H{"error": "repository and reference are required"})
+		return
+	}
+	digest, err := reg.DeleteManifest(repository, ref)
+	if err != nil {
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+	logrus.Infof("Deleted %s@%s from registry %s", repository, digest, c.Param("name"))
+	c.JSON(200, gin.H{"repository": repository, "digest": digest})
+}
+
+func untagImage(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	var body struct {
+		Reference string `json:"reference"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Reference == "" {
+		c.JSON(400, gin.H{"error": "reference is required"})
+		return
+	}
+	result, err := dockerFor(c).UntagImage(body.Reference)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": result})
+}
+
+func removeImage(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	ref := c.Query("image")
+	if ref == "" {
+		c.JSON(400, gin.H{"error": "image is required"})
+		return
+	}
+	logrus.Infof("Removing image: %s", ref)
+	result, err := dockerFor(c).RemoveImage(ref, c.Query("force") == "true", c.DefaultQuery("prune", "true") == "true")
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": result})
+}
+
+func saveImages(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	refs := c.QueryArray("image")
+	if len(refs) == 0 {
+		c.JSON(400, gin.H{"error": "image is required"})
+		return
+	}
+
+	filename := "images.tar"
+	if len(refs) == 1 {
+		filename = strings.NewReplacer("/", "_", ":", "_").Replace(refs[0]) + ".tar"
+	}
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := dockerFor(c).SaveImages(refs, c.Writer); err != nil {
+		logrus.Errorf("Failed to save images %v: %v", refs, err)
+		if !c.Writer.Written() {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+func loadImages(c *gin.Context) {
+	if !requireDocker(c) {
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	archive, err := file.Open()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	defer archive.Close()
+
+	loaded, err := dockerFor(c).LoadImages(archive)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error(), "loaded": loaded})
+		return
+	}
+	logrus.Infof("Loaded images from %s: %v", file.Filename, loaded)
+	c.JSON(200, gin.H{"loaded": loaded})
+}
@@ -0,0 +1,996 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	"devops-unity-backend/pkg/config"
+	"devops-unity-backend/pkg/kubernetes"
+)
+
+// k8sContextName returns the context requested through the context query
+// parameter or the X-Kube-Context header.
+func k8sContextName(c *gin.Context) string {
+	if name := c.Query("context"); name != "" {
+		return name
+	}
+	return c.GetHeader("X-Kube-Context")
+}
+
+// selectK8sContext resolves the requested context for every Kubernetes
+// route. Only an unknown explicit context is rejected, so legacy handlers
+// keep their mock fallback without a kubeconfig.
+func selectK8sContext(c *gin.Context) {
+	if k8sClusters == nil {
+		c.Next()
+		return
+	}
+
+	name := k8sContextName(c)
+	km, err := k8sClusters.Get(name)
+	if err != nil {
+		if name != "" {
+			c.AbortWithStatusJSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		logrus.Debugf("No default Kubernetes context: %v", err)
+	} else {
+		c.Set("k8sManager", km)
+	}
+	c.Next()
+}
+
+// k8sFor returns the manager selected by selectK8sContext.
+func k8sFor(c *gin.Context) *kubernetes.K8sManager {
+	if km, ok := c.Get("k8sManager"); ok {
+		return km.(*kubernetes.K8sManager)
+	}
+	return nil
+}
+
+func checkK8sAvailable(c *gin.Context) bool {
+	km := k8sFor(c)
+	return km != nil && km.IsConnected()
+}
+
+// requireK8s aborts the request when the cluster is not reachable. Handlers
+// added after the mock era have no mock fallback.
+func requireK8s(c *gin.Context) bool {
+	if !checkK8sAvailable(c) {
+		c.JSON(503, gin.H{"error": "Kubernetes cluster is not available"})
+		return false
+	}
+	return true
+}
+
+// k8sErrorStatus maps an error of the Kubernetes manager to an HTTP status:
+// unknown resource types are bad requests and API errors keep their status.
+func k8sErrorStatus(err error) int {
+	if meta.IsNoMatchError(err) {
+		return 400
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Code != 0 {
+		return int(status.Status().Code)
+	}
+	return 500
+}
+
+func getK8sContexts(c *gin.Context) {
+	if k8sClusters == nil {
+		c.JSON(200, gin.H{"contexts": []kubernetes.ClusterStatus{}})
+		return
+	}
+	c.JSON(200, gin.H{"contexts": k8sClusters.Status(), "default": k8sClusters.Default()})
+}
+
+func checkK8sContexts(c *gin.Context) {
+	if k8sClusters == nil {
+		c.JSON(200, gin.H{"contexts": []kubernetes.ClusterStatus{}})
+		return
+	}
+	c.JSON(200, gin.H{"contexts": k8sClusters.CheckHealth(), "default": k8sClusters.Default()})
+}
+
+func setDefaultK8sContext(c *gin.Context) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Name == "" {
+		c.JSON(400, gin.H{"error": "name is required"})
+		return
+	}
+	if k8sClusters == nil {
+		c.JSON(503, gin.H{"error": "Kubernetes is not configured"})
+		return
+	}
+	if err := k8sClusters.SetDefault(body.Name); err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"default": body.Name})
+}
+
+// deleteK8sResource deletes /resources/:type/:name, or every object of the
+// type matching the selector query. Progress is published on the hub as
+// kubernetes.delete messages while the request waits.
+func deleteK8sResource(hub *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireK8s(c) {
+			return
+		}
+
+		// Selectors apply to the default namespace unless namespace=all
+		opts := kubernetes.DeleteOptions{
+			Namespace:     k8sNamespace(c.DefaultQuery("namespace", "default")),
+			Name:          c.Param("name"),
+			LabelSelector: c.Query("selector"),
+			Propagation:   c.Query("propagation"),
+			DryRun:        c.Query("dry_run") == "true",
+			Wait:          c.Query("wait") == "true",
+		}
+		if grace := c.Query("grace_period"); grace != "" {
+			seconds, err := strconv.ParseInt(grace, 10, 64)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "invalid grace_period"})
+				return
+			}
+			opts.GracePeriodSeconds = &seconds
+		}
+		if timeout := c.Query("timeout"); timeout != "" {
+			d, err := time.ParseDuration(timeout)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "invalid timeout"})
+				return
+			}
+			opts.Timeout = d
+		}
+
+		results, err := k8sFor(c).DeleteResource(c.Param("type"), opts, func(p kubernetes.DeleteProgress) {
+			hub.Publish("kubernetes.delete", p)
+		})
+		if err != nil {
+			c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"results": results})
+	}
+}
+
+// diffK8sManifest previews /apply: it takes the same body and returns a
+// unified diff per object.
+func diffK8sManifest(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	var body struct {
+		Manifest string `json:"manifest"`
+		kubernetes.ApplyOptions
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Manifest == "" {
+		c.JSON(400, gin.H{"error": "manifest is required"})
+		return
+	}
+	if body.FieldManager == "" {
+		body.FieldManager = config.GlobalConfig.Kubernetes.FieldManager
+	}
+
+	diffs, summary, err := k8sFor(c).DiffManifest(body.Manifest, body.ApplyOptions)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"diffs": diffs, "summary": summary})
+}
+
+// k8sNamespace maps the "all" namespace query value to all namespaces.
+func k8sNamespace(namespace string) string {
+	if namespace == "all" {
+		return ""
+	}
+	return namespace
+}
+
+// k8sTopic names the hub topic of a kind in a namespace of a cluster;
+// cluster-scoped kinds use "cluster" as namespace.
+func k8sTopic(contextName, namespace, kind string) string {
+	if namespace == "" {
+		namespace = "cluster"
+	}
+	return "kubernetes/" + contextName + "/" + namespace + "/" + kind
+}
+
+func getK8sNamespaces(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	namespaces, err := k8sFor(c).ListNamespaces()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"namespaces": namespaces})
+}
+
+func getPortForwards(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+	c.JSON(200, gin.H{"port_forwards": k8sFor(c).ListPortForwards()})
+}
+
+func startPortForward(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	var req kubernetes.PortForwardRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Target == "" {
+		c.JSON(400, gin.H{"error": "target is required"})
+		return
+	}
+	forward, err := k8sFor(c).StartPortForward(req)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(201, forward)
+}
+
+func stopPortForward(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+	if err := k8sFor(c).StopPortForward(c.Param("id")); err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Port-forward stopped"})
+}
+
+// logOptionsFromQuery reads container, previous, since (a duration or an
+// RFC 3339 time), tail, timestamps and follow.
+func logOptionsFromQuery(c *gin.Context) (kubernetes.LogOptions, error) {
+	opts := kubernetes.LogOptions{
+		Container:  c.Query("container"),
+		Previous:   c.Query("previous") == "true",
+		Timestamps: c.Query("timestamps") == "true",
+		Follow:     c.Query("follow") == "true",
+	}
+	if since := c.Query("since"); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			seconds := int64(d.Seconds())
+			opts.SinceSeconds = &seconds
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			opts.SinceTime = &t
+		} else {
+			return opts, fmt.Errorf("invalid since %q", since)
+		}
+	}
+	if tail := c.Query("tail"); tail != "" {
+		lines, err := strconv.ParseInt(tail, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("invalid tail %q", tail)
+		}
+		opts.TailLines = &lines
+	}
+	return opts, nil
+}
+
+// streamLogs runs a log stream over a WebSocket when the request is an
+// upgrade, and as server-sent "log" events otherwise.
+func streamLogs(c *gin.Context, run func(ctx context.Context, out kubernetes.LogHandler) error) {
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		err := run(c.Request.Context(), func(line kubernetes.LogLine) {
+			c.SSEvent("log", line)
+			c.Writer.Flush()
+		})
+		if err != nil {
+			c.SSEvent("error", gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		logrus.Errorf("WebSocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	// The client sends nothing; reading only detects it going away
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	err = run(ctx, func(line kubernetes.LogLine) {
+		if err := conn.WriteJSON(line); err != nil {
+			cancel()
+		}
+	})
+	if err != nil {
+		conn.WriteJSON(gin.H{"error": err.Error()})
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+func getPodLogs(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+	opts, err := logOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	namespace := c.DefaultQuery("namespace", "default")
+	streamLogs(c, func(ctx context.Context, out kubernetes.LogHandler) error {
+		return k8sFor(c).StreamPodLogs(ctx, namespace, c.Param("name"), opts, out)
+	})
+}
+
+// tailK8sLogs follows every pod matching the selector query until the
+// client disconnects.
+func tailK8sLogs(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+	opts, err := logOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	selector := c.Query("selector")
+	if selector == "" {
+		c.JSON(400, gin.H{"error": "selector is required"})
+		return
+	}
+
+	namespace := k8sNamespace(c.DefaultQuery("namespace", "default"))
+	streamLogs(c, func(ctx context.Context, out kubernetes.LogHandler) error {
+		return k8sFor(c).TailPods(ctx, namespace, selector, opts, out)
+	})
+}
+
+// followRollout publishes the progress of a rollout the IDE just started
+// as kubernetes.rollout messages on kubernetes/<context>/<namespace>/rollouts.
+func followRollout(hub *Hub, km *kubernetes.K8sManager, kind, namespace, name string) {
+	go func() {
+		_, err := km.WatchRollout(context.Background(), kind, namespace, name, 10*time.Minute, func(status kubernetes.RolloutStatus) {
+			hub.PublishTopic(k8sTopic(km.Context(), namespace, "rollouts"), "kubernetes.rollout", status)
+		})
+		if err != nil {
+			logrus.Warnf("Stopped following rollout of %s %s/%s: %v", kind, namespace, name, err)
+		}
+	}()
+}
+
+func scaleK8sWorkload(hub *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireK8s(c) {
+			return
+		}
+
+		var body struct {
+			Replicas *int32 `json:"replicas"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil || body.Replicas == nil {
+			c.JSON(400, gin.H{"error": "replicas is required"})
+			return
+		}
+		km, kind, name := k8sFor(c), c.Param("kind"), c.Param("name")
+		namespace := c.DefaultQuery("namespace", "default")
+		if err := km.ScaleWorkload(kind, namespace, name, *body.Replicas); err != nil {
+			c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		followRollout(hub, km, kind, namespace, name)
+		c.JSON(200, gin.H{"message": "Workload scaled", "replicas": *body.Replicas})
+	}
+}
+
+func restartK8sWorkload(hub *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireK8s(c) {
+			return
+		}
+
+		km, kind, name := k8sFor(c), c.Param("kind"), c.Param("name")
+		namespace := c.DefaultQuery("namespace", "default")
+		if err := km.RestartWorkload(kind, namespace, name); err != nil {
+			c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		followRollout(hub, km, kind, namespace, name)
+		c.JSON(200, gin.H{"message": "Rollout restarted"})
+	}
+}
+
+// pauseK8sWorkload pauses or, with paused false, resumes a rollout.
+func pauseK8sWorkload(hub *Hub, paused bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireK8s(c) {
+			return
+		}
+
+		km, kind, name := k8sFor(c), c.Param("kind"), c.Param("name")
+		namespace := c.DefaultQuery("namespace", "default")
+		if err := km.SetRolloutPaused(kind, namespace, name, paused); err != nil {
+			c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !paused {
+			followRollout(hub, km, kind, namespace, name)
+		}
+		c.JSON(200, gin.H{"message": "Rollout updated", "paused": paused})
+	}
+}
+
+func undoK8sWorkload(hub *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireK8s(c) {
+			return
+		}
+
+		var body struct {
+			Revision int64 `json:"revision"` // 0 rolls back to the previous revision
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		km, kind, name := k8sFor(c), c.Param("kind"), c.Param("name")
+		namespace := c.DefaultQuery("namespace", "default")
+		revision, err := km.UndoRollout(kind, namespace, name, body.Revision)
+		if err != nil {
+			c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		followRollout(hub, km, kind, namespace, name)
+		c.JSON(200, gin.H{"message": "Rolled back", "revision": revision})
+	}
+}
+
+// getRolloutStatus returns the rollout status, or with watch=true streams
+// every change as NDJSON until the rollout completes or timeout passes.
+func getRolloutStatus(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	km, kind, name := k8sFor(c), c.Param("kind"), c.Param("name")
+	namespace := c.DefaultQuery("namespace", "default")
+	if c.Query("watch") != "true" {
+		status, err := km.GetRolloutStatus(kind, namespace, name)
+		if err != nil {
+			c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"status": status})
+		return
+	}
+
+	var timeout time.Duration
+	if t := c.Query("timeout"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid timeout"})
+			return
+		}
+		timeout = d
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(200)
+	encoder := json.NewEncoder(c.Writer)
+	_, err := km.WatchRollout(c.Request.Context(), kind, namespace, name, timeout, func(status kubernetes.RolloutStatus) {
+		encoder.Encode(gin.H{"status": status})
+		c.Writer.Flush()
+	})
+	if err != nil {
+		encoder.Encode(gin.H{"error": err.Error()})
+	}
+}
+
+func getRolloutHistory(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	history, err := k8sFor(c).RolloutHistory(c.Param("kind"), c.DefaultQuery("namespace", "default"), c.Param("name"))
+	if err != nil {
+		c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"history": history})
+}
+
+// listK8sKind serves a namespaced Info listing under key, honouring the
+// namespace query ("all" for every namespace).
+func listK8sKind[T any](key string, list func(km *kubernetes.K8sManager, namespace string) ([]T, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireK8s(c) {
+			return
+		}
+
+		items, err := list(k8sFor(c), k8sNamespace(c.DefaultQuery("namespace", "default")))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{key: items})
+	}
+}
+
+func getK8sPersistentVolumes(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	volumes, err := k8sFor(c).ListPersistentVolumes()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"persistentvolumes": volumes})
+}
+
+func getK8sAPIResources(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	resources, err := k8sFor(c).ListAPIResources()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"resources": resources})
+}
+
+// listK8sResources lists /resources/:type for any resource type, CRDs
+// included, with selectors and limit/continue pagination.
+func listK8sResources(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	opts := kubernetes.ResourceListOptions{
+		Namespace:     k8sNamespace(c.DefaultQuery("namespace", "all")),
+		LabelSelector: c.Query("selector"),
+		FieldSelector: c.Query("field_selector"),
+		Continue:      c.Query("continue"),
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || n < 0 {
+			c.JSON(400, gin.H{"error": "invalid limit"})
+			return
+		}
+		opts.Limit = n
+	}
+
+	list, err := k8sFor(c).ListResources(c.Param("type"), opts)
+	if err != nil {
+		c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, list)
+}
+
+func getK8sResource(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	show, ok := showSecrets(c)
+	if !ok {
+		return
+	}
+
+	detail, err := k8sFor(c).GetResource(c.Param("type"), c.Query("namespace"), c.Param("name"), show)
+	if err != nil {
+		c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"resource": detail})
+}
+
+// getK8sEvents lists events of a namespace, optionally narrowed to one
+// involved object with kind and name (or uid) and to a type.
+func getK8sEvents(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	events, err := k8sFor(c).ListEvents(kubernetes.EventFilter{
+		Namespace: k8sNamespace(c.DefaultQuery("namespace", "default")),
+		Kind:      c.Query("kind"),
+		Name:      c.Query("name"),
+		UID:       c.Query("uid"),
+		Type:      c.Query("type"),
+	})
+	if err != nil {
+		c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"events": events})
+}
+
+func diagnoseK8sPod(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	diagnosis, err := k8sFor(c).DiagnosePod(c.DefaultQuery("namespace", "default"), c.Param("name"))
+	if err != nil {
+		c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"diagnosis": diagnosis})
+}
+
+func diagnoseK8sDeployment(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	diagnosis, err := k8sFor(c).DiagnoseDeployment(c.DefaultQuery("namespace", "default"), c.Param("name"))
+	if err != nil {
+		c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"diagnosis": diagnosis})
+}
+
+func getK8sGraph(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	graph, err := k8sFor(c).BuildGraph(c.Param("kind"), c.DefaultQuery("namespace", "default"), c.Param("name"))
+	if err != nil {
+		c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"graph": graph})
+}
+
+// getK8sNodeUsage reports requests, limits and, with metrics-server, usage
+// of every node; metrics_available tells whether usage is included.
+func getK8sNodeUsage(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	usage, err := k8sFor(c).ListNodeUsage()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, usage)
+}
+
+func getK8sPodUsage(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	usage, err := k8sFor(c).ListPodUsage(k8sNamespace(c.DefaultQuery("namespace", "default")))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, usage)
+}
+
+func cordonK8sNode(cordon bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireK8s(c) {
+			return
+		}
+
+		km, name := k8sFor(c), c.Param("name")
+		var err error
+		if cordon {
+			err = km.CordonNode(name)
+		} else {
+			err = km.UncordonNode(name)
+		}
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"node": name, "unschedulable": cordon})
+	}
+}
+
+// drainK8sNode cordons and drains a node, streaming NDJSON lines: one
+// {"progress": ...} per eviction step, then {"result": ...} or {"error": ...}.
+func drainK8sNode(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	opts := kubernetes.DrainOptions{
+		Force:              c.Query("force") == "true",
+		DeleteEmptyDirData: c.Query("delete_emptydir_data") == "true",
+		DryRun:             c.Query("dry_run") == "true",
+	}
+	if grace := c.Query("grace_period"); grace != "" {
+		seconds, err := strconv.ParseInt(grace, 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid grace_period"})
+			return
+		}
+		opts.GracePeriodSeconds = &seconds
+	}
+	if timeout := c.Query("timeout"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid timeout"})
+			return
+		}
+		opts.Timeout = d
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(200)
+	encoder := json.NewEncoder(c.Writer)
+	result, err := k8sFor(c).DrainNode(c.Request.Context(), c.Param("name"), opts, func(p kubernetes.DrainProgress) {
+		encoder.Encode(gin.H{"progress": p})
+		c.Writer.Flush()
+	})
+	if err != nil {
+		encoder.Encode(gin.H{"error": err.Error(), "result": result})
+		return
+	}
+	encoder.Encode(gin.H{"result": result})
+}
+
+func getHelmReleases(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	releases, err := k8sFor(c).ListHelmReleases(k8sNamespace(c.DefaultQuery("namespace", "all")))
+	if err != nil {
+		c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"releases": releases})
+}
+
+// getHelmRelease returns values, manifest, hooks and notes of the latest
+// revision, or of the revision query. Secrets are masked unless
+// show_secrets is set and allowed.
+func getHelmRelease(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	revision, err := strconv.Atoi(c.DefaultQuery("revision", "0"))
+	if err != nil || revision < 0 {
+		c.JSON(400, gin.H{"error": "invalid revision"})
+		return
+	}
+	show, ok := showSecrets(c)
+	if !ok {
+		return
+	}
+	release, err := k8sFor(c).GetHelmRelease(c.DefaultQuery("namespace", "default"), c.Param("name"), revision, show)
+	if err != nil {
+		c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"release": release})
+}
+
+func getHelmHistory(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+
+	history, err := k8sFor(c).HelmHistory(c.DefaultQuery("namespace", "default"), c.Param("name"))
+	if err != nil {
+		c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"history": history})
+}
+
+// bindHelmChart reads the chart options of an install, upgrade or diff;
+// the release name comes from the path when present and timeout is a
+// duration string.
+func bindHelmChart(c *gin.Context) (kubernetes.HelmChartOptions, bool) {
+	var body struct {
+		kubernetes.HelmChartOptions
+		Timeout string `json:"timeout"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return body.HelmChartOptions, false
+	}
+	opts := body.HelmChartOptions
+	if name := c.Param("name"); name != "" {
+		opts.Release = name
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = c.DefaultQuery("namespace", "default")
+	}
+	if body.Timeout != "" {
+		d, err := time.ParseDuration(body.Timeout)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid timeout"})
+			return opts, false
+		}
+		opts.Timeout = d
+	}
+	return opts, true
+}
+
+// publishHelmRelease announces a changed release on
+// kubernetes/<context>/<namespace>/helm as a kubernetes.helm message.
+func publishHelmRelease(hub *Hub, km *kubernetes.K8sManager, release kubernetes.HelmRelease) {
+	hub.PublishTopic(k8sTopic(km.Context(), release.Namespace, "helm"), "kubernetes.helm", release)
+}
+
+func installHelmChart(hub *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireK8s(c) {
+			return
+		}
+		opts, ok := bindHelmChart(c)
+		if !ok {
+			return
+		}
+
+		release, err := k8sFor(c).InstallHelmChart(c.Request.Context(), opts)
+		if err != nil {
+			c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !opts.DryRun {
+			publishHelmRelease(hub, k8sFor(c), release.HelmRelease)
+		}
+		c.JSON(200, gin.H{"release": release})
+	}
+}
+
+func upgradeHelmRelease(hub *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireK8s(c) {
+			return
+		}
+		opts, ok := bindHelmChart(c)
+		if !ok {
+			return
+		}
+
+		release, err := k8sFor(c).UpgradeHelmRelease(c.Request.Context(), opts)
+		if err != nil {
+			c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !opts.DryRun {
+			publishHelmRelease(hub, k8sFor(c), release.HelmRelease)
+		}
+		c.JSON(200, gin.H{"release": release})
+	}
+}
+
+// diffHelmUpgrade previews an upgrade: it takes the upgrade body and
+// returns a unified diff per object against the current revision.
+func diffHelmUpgrade(c *gin.Context) {
+	if !requireK8s(c) {
+		return
+	}
+	opts, ok := bindHelmChart(c)
+	if !ok {
+		return
+	}
+
+	diffs, summary, err := k8sFor(c).DiffHelmUpgrade(c.Request.Context(), opts)
+	if err != nil {
+		c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"diffs": diffs, "summary": summary})
+}
+
+func rollbackHelmRelease(hub *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireK8s(c) {
+			return
+		}
+
+		var body struct {
+			Revision int    `json:"revision"` // 0 for the previous revision
+			Wait     bool   `json:"wait"`
+			Timeout  string `json:"timeout"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		var timeout time.Duration
+		if body.Timeout != "" {
+			d, err := time.ParseDuration(body.Timeout)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "invalid timeout"})
+				return
+			}
+			timeout = d
+		}
+
+		release, err := k8sFor(c).RollbackHelmRelease(c.Request.Context(), c.DefaultQuery("namespace", "default"), c.Param("name"), body.Revision, body.Wait, timeout)
+		if err != nil {
+			c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		publishHelmRelease(hub, k8sFor(c), release.HelmRelease)
+		c.JSON(200, gin.H{"release": release})
+	}
+}
+
+func uninstallHelmRelease(hub *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireK8s(c) {
+			return
+		}
+
+		namespace, name := c.DefaultQuery("namespace", "default"), c.Param("name")
+		if err := k8sFor(c).UninstallHelmRelease(c.Request.Context(), namespace, name, c.Query("keep_history") == "true"); err != nil {
+			c.JSON(k8sErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		publishHelmRelease(hub, k8sFor(c), kubernetes.HelmRelease{Name: name, Namespace: namespace, Status: "uninstalled"})
+		c.JSON(200, gin.H{"message": fmt.Sprintf("Release %s uninstalled", name)})
+	}
+}
+
+// validateK8sManifest checks a manifest for the editor. Without a cluster
+// context only YAML, deprecation and lint checks run; an unreachable
+// cluster falls back to its saved schemas.
+func validateK8sManifest(c *gin.Context) {
+	var body struct {
+		Manifest string `json:"manifest" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	km := k8sFor(c)
+	if km == nil {
+		c.JSON(200, kubernetes.LintManifest(body.Manifest))
+		return
+	}
+	c.JSON(200, km.ValidateManifest(body.Manifest))
+}
@@ -3,40 +3,108 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
+
+	"devops-unity-backend/pkg/config"
+	"devops-unity-backend/pkg/docker"
+	"devops-unity-backend/pkg/kubernetes"
 )
 
+// dockerEndpoints holds one Docker client per configured endpoint. The
+// legacy Docker handlers fall back to mock data while the selected daemon is
+// unreachable.
+var dockerEndpoints *docker.Registry
+
+// k8sClusters holds one Kubernetes client per kubeconfig context. The
+// legacy Kubernetes handlers fall back to mock data while the selected
+// cluster is unreachable.
+var k8sClusters *kubernetes.ClusterRegistry
+
+// imageRegistries holds a distribution API client per configured registry.
+var imageRegistries = map[string]*docker.RegistryClient{}
+
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
+	CheckOrigin: checkOrigin,
+}
+
+// checkOrigin accepts WebSocket handshakes from the configured allowed
+// origins, or from loopback origins when none are configured. Requests
+// without an Origin header do not come from a browser and are accepted.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
 		return true
-	},
+	}
+	allowed := config.GlobalConfig.Server.AllowedOrigins
+	if len(allowed) == 0 {
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
 }
 
 type Hub struct {
 	clients    map[*Client]bool
 	broadcast  chan []byte
+	topical    chan topicMessage
+	subscribe  chan subscription
 	register   chan *Client
 	unregister chan *Client
 }
 
 type Client struct {
-	hub  *Hub
-	conn *websocket.Conn
-	send chan []byte
+	hub    *Hub
+	conn   *websocket.Conn
+	send   chan []byte
+	topics map[string]bool // only touched by the hub goroutine
+}
+
+// topicMessage is only delivered to clients subscribed to its topic.
+type topicMessage struct {
+	topic string
+	data  []byte
+}
+
+// subscription is a request sent by a client over the socket:
+// {"action":"subscribe","topics":["kubernetes/default"]}
+type subscription struct {
+	client *Client
+	Action string   `json:"action"` // subscribe or unsubscribe
+	Topics []string `json:"topics"`
 }
 
 func newHub() *Hub {
 	return &Hub{
 		broadcast:  make(chan []byte),
+		topical:    make(chan topicMessage),
+		subscribe:  make(chan subscription),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
@@ -57,17 +125,84 @@ func (h *Hub) run() {
 			}
 		case message := <-h.broadcast:
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+				h.deliver(client, message)
+			}
+		case message := <-h.topical:
+			for client := range h.clients {
+				if client.subscribed(message.topic) {
+					h.deliver(client, message.data)
+				}
+			}
+		case sub := <-h.subscribe:
+			if _, ok := h.clients[sub.client]; !ok {
+				continue
+			}
+			for _, topic := range sub.Topics {
+				if sub.Action == "unsubscribe" {
+					delete(sub.client.topics, topic)
+				} else {
+					sub.client.topics[topic] = true
 				}
 			}
 		}
 	}
 }
 
+// deliver queues a message, dropping clients that cannot keep up.
+func (h *Hub) deliver(client *Client, message []byte) {
+	select {
+	case client.send <- message:
+	default:
+		close(client.send)
+		delete(h.clients, client)
+	}
+}
+
+// subscribed reports whether the client asked for topic. Topics are
+// slash-separated and a subscription covers every topic below it, so
+// "kubernetes/default" receives "kubernetes/default/pods"; "*" matches one
+// segment.
+func (c *Client) subscribed(topic string) bool {
+	parts := strings.Split(topic, "/")
+	for sub := range c.topics {
+		subParts := strings.Split(sub, "/")
+		if len(subParts) > len(parts) {
+			continue
+		}
+		match := true
+		for i, part := range subParts {
+			if part != "*" && part != parts[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish broadcasts a typed message to every connected client.
+func (h *Hub) Publish(msgType string, payload interface{}) {
+	message, err := json.Marshal(gin.H{"type": msgType, "payload": payload})
+	if err != nil {
+		logrus.Errorf("Failed to encode %s message: %v", msgType, err)
+		return
+	}
+	h.broadcast <- message
+}
+
+// PublishTopic sends a typed message to the clients subscribed to topic.
+func (h *Hub) PublishTopic(topic, msgType string, payload interface{}) {
+	message, err := json.Marshal(gin.H{"type": msgType, "topic": topic, "payload": payload})
+	if err != nil {
+		logrus.Errorf("Failed to encode %s message: %v", msgType, err)
+		return
+	}
+	h.topical <- topicMessage{topic: topic, data: message}
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		c.hub.unregister <- c
@@ -75,13 +210,21 @@ func (c *Client) readPump() {
 	}()
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				logrus.Errorf("WebSocket error: %v", err)
 			}
 			break
 		}
+
+		// Clients only send topic subscriptions
+		sub := subscription{client: c}
+		if err := json.Unmarshal(data, &sub); err != nil || (sub.Action != "subscribe" && sub.Action != "unsubscribe") {
+			logrus.Debugf("Ignoring WebSocket message: %s", data)
+			continue
+		}
+		c.hub.subscribe <- sub
 	}
 }
 
@@ -102,7 +245,7 @@ func handleWebSocket(hub *Hub) gin.HandlerFunc {
 			return
 		}
 
-		client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256)}
+		client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256), topics: make(map[string]bool)}
 		client.hub.register <- client
 
 		go client.writePump()
@@ -134,24 +277,104 @@ func setupRouter(hub *Hub) *gin.Engine {
 	v1 := router.Group("/api/v1")
 	{
 		// Docker endpoints
-		docker := v1.Group("/docker")
+		docker := v1.Group("/docker", selectDockerEndpoint)
 		{
+			docker.GET("/endpoints", getDockerEndpoints)
+			docker.POST("/endpoints/check", checkDockerEndpoints)
 			docker.GET("/containers", getDockerContainers)
+			docker.GET("/containers/:id/inspect", inspectContainer)
+			docker.POST("/containers/run", runContainer)
+			docker.POST("/containers/:id/recreate", recreateContainer)
+			docker.GET("/containers/:id/files", listContainerFiles)
+			docker.GET("/containers/:id/files/download", downloadContainerFiles)
+			docker.POST("/containers/:id/files/upload", uploadContainerFile)
+			docker.GET("/containers/:id/diff", diffContainer)
 			docker.POST("/containers/:id/start", startContainer)
 			docker.POST("/containers/:id/stop", stopContainer)
 			docker.DELETE("/containers/:id", removeContainer)
 			docker.GET("/images", getDockerImages)
 			docker.POST("/images/pull", pullImage)
+			docker.GET("/images/inspect", inspectImage)
+			docker.POST("/images/tag", tagImage)
+			docker.POST("/images/untag", untagImage)
+			docker.POST("/images/push", pushImage)
+			docker.DELETE("/images", removeImage)
+			docker.GET("/images/save", saveImages)
+			docker.POST("/images/load", loadImages)
+			docker.GET("/registries", getImageRegistries)
+			docker.GET("/registries/:name/repositories", listRegistryRepositories)
+			docker.GET("/registries/:name/tags", listRegistryTags)
+			docker.POST("/registries/:name/tags", tagRegistryManifest)
+			docker.GET("/registries/:name/manifests", getRegistryManifest)
+			docker.DELETE("/registries/:name/manifests", deleteRegistryManifest)
+			docker.GET("/system/df", getDockerDiskUsage)
+			docker.POST("/system/prune", pruneDocker)
 		}
 
 		// Kubernetes endpoints
-		k8s := v1.Group("/kubernetes")
+		k8s := v1.Group("/kubernetes", selectK8sContext)
 		{
+			k8s.GET("/contexts", getK8sContexts)
+			k8s.POST("/contexts/check", checkK8sContexts)
+			k8s.PUT("/contexts/default", setDefaultK8sContext)
 			k8s.GET("/pods", getK8sPods)
+			k8s.GET("/pods/:name/logs", getPodLogs)
+			k8s.GET("/pods/:name/diagnose", diagnoseK8sPod)
+			k8s.GET("/logs", tailK8sLogs)
+			k8s.GET("/pods/:name/exec", podTerminal("exec"))
+			k8s.GET("/pods/:name/attach", podTerminal("attach"))
+			k8s.GET("/terminals", getTerminalSessions)
+			k8s.DELETE("/terminals/:id", closeTerminalSession)
+			k8s.GET("/port-forwards", getPortForwards)
+			k8s.POST("/port-forwards", startPortForward)
+			k8s.DELETE("/port-forwards/:id", stopPortForward)
 			k8s.GET("/deployments", getK8sDeployments)
+			k8s.GET("/deployments/:name/diagnose", diagnoseK8sDeployment)
+			k8s.GET("/workloads/:kind/:name/rollout", getRolloutStatus)
+			k8s.GET("/workloads/:kind/:name/history", getRolloutHistory)
+			k8s.POST("/workloads/:kind/:name/scale", scaleK8sWorkload(hub))
+			k8s.POST("/workloads/:kind/:name/restart", restartK8sWorkload(hub))
+			k8s.POST("/workloads/:kind/:name/pause", pauseK8sWorkload(hub, true))
+			k8s.POST("/workloads/:kind/:name/resume", pauseK8sWorkload(hub, false))
+			k8s.POST("/workloads/:kind/:name/undo", undoK8sWorkload(hub))
 			k8s.GET("/services", getK8sServices)
 			k8s.GET("/nodes", getK8sNodes)
+			k8s.POST("/nodes/:name/cordon", cordonK8sNode(true))
+			k8s.POST("/nodes/:name/uncordon", cordonK8sNode(false))
+			k8s.POST("/nodes/:name/drain", drainK8sNode)
+			k8s.GET("/namespaces", getK8sNamespaces)
+			k8s.GET("/events", getK8sEvents)
+			k8s.GET("/statefulsets", listK8sKind("statefulsets", (*kubernetes.K8sManager).ListStatefulSets))
+			k8s.GET("/daemonsets", listK8sKind("daemonsets", (*kubernetes.K8sManager).ListDaemonSets))
+			k8s.GET("/replicasets", listK8sKind("replicasets", (*kubernetes.K8sManager).ListReplicaSets))
+			k8s.GET("/jobs", listK8sKind("jobs", (*kubernetes.K8sManager).ListJobs))
+			k8s.GET("/cronjobs", listK8sKind("cronjobs", (*kubernetes.K8sManager).ListCronJobs))
+			k8s.GET("/configmaps", listK8sKind("configmaps", (*kubernetes.K8sManager).ListConfigMaps))
+			k8s.GET("/secrets", listK8sKind("secrets", (*kubernetes.K8sManager).ListSecrets))
+			k8s.GET("/ingresses", listK8sKind("ingresses", (*kubernetes.K8sManager).ListIngresses))
+			k8s.GET("/persistentvolumeclaims", listK8sKind("persistentvolumeclaims", (*kubernetes.K8sManager).ListPersistentVolumeClaims))
+			k8s.GET("/persistentvolumes", getK8sPersistentVolumes)
+			k8s.GET("/serviceaccounts", listK8sKind("serviceaccounts", (*kubernetes.K8sManager).ListServiceAccounts))
+			k8s.GET("/horizontalpodautoscalers", listK8sKind("horizontalpodautoscalers", (*kubernetes.K8sManager).ListHPAs))
+			k8s.GET("/api-resources", getK8sAPIResources)
+			k8s.GET("/resources/:type", listK8sResources)
+			k8s.GET("/resources/:type/:name", getK8sResource)
+			k8s.GET("/graph/:kind/:name", getK8sGraph)
+			k8s.GET("/metrics/nodes", getK8sNodeUsage)
+			k8s.GET("/metrics/pods", getK8sPodUsage)
+			k8s.GET("/helm/releases", getHelmReleases)
+			k8s.POST("/helm/releases", installHelmChart(hub))
+			k8s.GET("/helm/releases/:name", getHelmRelease)
+			k8s.PUT("/helm/releases/:name", upgradeHelmRelease(hub))
+			k8s.DELETE("/helm/releases/:name", uninstallHelmRelease(hub))
+			k8s.GET("/helm/releases/:name/history", getHelmHistory)
+			k8s.POST("/helm/releases/:name/diff", diffHelmUpgrade)
+			k8s.POST("/helm/releases/:name/rollback", rollbackHelmRelease(hub))
 			k8s.POST("/apply", applyK8sManifest)
+			k8s.POST("/diff", diffK8sManifest)
+			k8s.POST("/validate", validateK8sManifest)
+			k8s.DELETE("/resources/:type", deleteK8sResource(hub))
+			k8s.DELETE("/resources/:type/:name", deleteK8sResource(hub))
 		}
 
 		// Ansible endpoints
@@ -216,8 +439,27 @@ func setupRouter(hub *Hub) *gin.Engine {
 
 // Docker handlers - Mock implementations for now
 func getDockerContainers(c *gin.Context) {
+	if dockerEndpointName(c) == allDockerEndpoints {
+		c.JSON(200, gin.H{"endpoints": dockerEndpoints.ListAllContainers()})
+		return
+	}
+
 	// Check if Docker is available
-	dockerAvailable := checkDockerAvailable()
+	dockerAvailable := checkDockerAvailable(c)
+
+	if dockerAvailable {
+		containers, err := dockerFor(c).ListContainers()
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{
+			"containers":       containers,
+			"docker_available": dockerAvailable,
+			"endpoint":         dockerFor(c).Endpoint(),
+		})
+		return
+	}
 
 	containers := []map[string]interface{}{
 		{
@@ -248,30 +490,66 @@ func getDockerContainers(c *gin.Context) {
 	})
 }
 
-func checkDockerAvailable() bool {
-	// Simple check - in real implementation, try to connect to Docker daemon
-	return true
+func checkDockerAvailable(c *gin.Context) bool {
+	return dockerFor(c) != nil && dockerEndpoints.Available(dockerEndpointName(c))
 }
 
 func startContainer(c *gin.Context) {
+	if !requireSingleDockerEndpoint(c) {
+		return
+	}
 	id := c.Param("id")
 	logrus.Infof("Starting container: %s", id)
+	if checkDockerAvailable(c) {
+		if err := dockerFor(c).StartContainer(id); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	c.JSON(200, gin.H{"message": fmt.Sprintf("Container %s started", id)})
 }
 
 func stopContainer(c *gin.Context) {
+	if !requireSingleDockerEndpoint(c) {
+		return
+	}
 	id := c.Param("id")
 	logrus.Infof("Stopping container: %s", id)
+	if checkDockerAvailable(c) {
+		if err := dockerFor(c).StopContainer(id); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	c.JSON(200, gin.H{"message": fmt.Sprintf("Container %s stopped", id)})
 }
 
 func removeContainer(c *gin.Context) {
+	if !requireSingleDockerEndpoint(c) {
+		return
+	}
 	id := c.Param("id")
 	logrus.Infof("Removing container: %s", id)
+	if checkDockerAvailable(c) {
+		if err := dockerFor(c).RemoveContainer(id); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	c.JSON(200, gin.H{"message": fmt.Sprintf("Container %s removed", id)})
 }
 
 func getDockerImages(c *gin.Context) {
+	if checkDockerAvailable(c) {
+		images, err := dockerFor(c).ListImages()
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"images": images})
+		return
+	}
+
 	images := []map[string]interface{}{
 		{
 			"id":           "nginx:latest",
@@ -302,6 +580,30 @@ func pullImage(c *gin.Context) {
 // Kubernetes handlers - Mock implementations
 func getK8sPods(c *gin.Context) {
 	namespace := c.DefaultQuery("namespace", "default")
+	if checkK8sAvailable(c) {
+		opts := kubernetes.ResourceListOptions{
+			Namespace:     k8sNamespace(namespace),
+			LabelSelector: c.Query("selector"),
+			FieldSelector: c.Query("field_selector"),
+			Continue:      c.Query("continue"),
+		}
+		if limit := c.Query("limit"); limit != "" {
+			n, err := strconv.ParseInt(limit, 10, 64)
+			if err != nil || n < 0 {
+				c.JSON(400, gin.H{"error": "invalid limit"})
+				return
+			}
+			opts.Limit = n
+		}
+		pods, err := k8sFor(c).ListPods(opts)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"pods": pods.Items, "continue": pods.Continue})
+		return
+	}
+
 	pods := []map[string]interface{}{
 		{
 			"name":      "web-app-7d4b8c9f6-abc12",
@@ -331,6 +633,16 @@ func getK8sPods(c *gin.Context) {
 
 func getK8sDeployments(c *gin.Context) {
 	namespace := c.DefaultQuery("namespace", "default")
+	if checkK8sAvailable(c) {
+		deployments, err := k8sFor(c).ListDeployments(k8sNamespace(namespace))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"deployments": deployments})
+		return
+	}
+
 	deployments := []map[string]interface{}{
 		{
 			"name":      "web-app",
@@ -356,6 +668,16 @@ func getK8sDeployments(c *gin.Context) {
 
 func getK8sServices(c *gin.Context) {
 	namespace := c.DefaultQuery("namespace", "default")
+	if checkK8sAvailable(c) {
+		services, err := k8sFor(c).ListServices(k8sNamespace(namespace))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"services": services})
+		return
+	}
+
 	services := []map[string]interface{}{
 		{
 			"name":       "web-app-service",
@@ -380,6 +702,16 @@ func getK8sServices(c *gin.Context) {
 }
 
 func getK8sNodes(c *gin.Context) {
+	if checkK8sAvailable(c) {
+		nodes, err := k8sFor(c).ListNodes()
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"nodes": nodes})
+		return
+	}
+
 	nodes := []map[string]interface{}{
 		{
 			"name":     "master-node-1",
@@ -404,11 +736,29 @@ func getK8sNodes(c *gin.Context) {
 }
 
 func applyK8sManifest(c *gin.Context) {
-	var body map[string]string
-	c.BindJSON(&body)
-	manifest := body["manifest"]
-	logrus.Infof("Applying Kubernetes manifest: %s", manifest)
-	c.JSON(200, gin.H{"message": "Manifest applied successfully"})
+	if !requireK8s(c) {
+		return
+	}
+
+	var body struct {
+		Manifest string `json:"manifest" binding:"required"`
+		kubernetes.ApplyOptions
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "manifest is required"})
+		return
+	}
+	logrus.Infof("Applying Kubernetes manifest (%d bytes, dry run: %v)", len(body.Manifest), body.DryRun)
+
+	if body.FieldManager == "" {
+		body.FieldManager = config.GlobalConfig.Kubernetes.FieldManager
+	}
+	results, err := k8sFor(c).ApplyManifest(body.Manifest, body.ApplyOptions)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Manifest applied", "results": results})
 }
 
 // Ansible handlers - Mock implementations
@@ -752,6 +1102,10 @@ func main() {
 
 	logrus.Info("Starting DevOps Unity IDE Backend Server...")
 
+	if err := config.LoadConfig(os.Getenv("DEVOPS_UNITY_CONFIG")); err != nil {
+		logrus.Warnf("Using default configuration: %v", err)
+	}
+
 	// Set Gin to release mode in production
 	if os.Getenv("GIN_MODE") == "" {
 		gin.SetMode(gin.DebugMode)
@@ -761,6 +1115,62 @@ func main() {
 	hub := newHub()
 	go hub.run()
 
+	// Background watchers stop when the server shuts down
+	watchCtx, stopWatchers := context.WithCancel(context.Background())
+	defer stopWatchers()
+
+	// Register Docker endpoints and stream their events to the UI
+	var endpoints []docker.Endpoint
+	for _, ep := range config.GlobalConfig.Docker.Endpoints {
+		endpoints = append(endpoints, docker.Endpoint{
+			Name:      ep.Name,
+			Host:      ep.Host,
+			TLSCACert: ep.TLSCACert,
+			TLSCert:   ep.TLSCert,
+			TLSKey:    ep.TLSKey,
+		})
+	}
+	dockerEndpoints = docker.NewRegistry(docker.DiscoverEndpoints(config.GlobalConfig.Docker.SocketPath, endpoints))
+	logrus.Infof("Docker endpoints: %v", dockerEndpoints.Names())
+	go dockerEndpoints.MonitorHealth(watchCtx, 30*time.Second)
+	dockerEndpoints.WatchEvents(watchCtx, func(event docker.Event) {
+		hub.Publish("docker."+event.Type, event)
+	})
+
+	// Register kubeconfig contexts; clients connect on first use and
+	// handlers degrade while a cluster is unavailable
+	if config.GlobalConfig.Kubernetes.HelmPath != "" {
+		kubernetes.HelmBinary = config.GlobalConfig.Kubernetes.HelmPath
+	}
+	kubeconfigs := append([]string{config.GlobalConfig.Kubernetes.ConfigPath}, config.GlobalConfig.Kubernetes.ConfigPaths...)
+	var err error
+	if k8sClusters, err = kubernetes.NewClusterRegistry(kubeconfigs, config.GlobalConfig.Kubernetes.Context); err != nil {
+		logrus.Warnf("Kubernetes is not available: %v", err)
+	} else {
+		logrus.Infof("Kubernetes contexts: %v (default %s)", k8sClusters.Names(), k8sClusters.Default())
+		go k8sClusters.MonitorHealth(watchCtx, 30*time.Second)
+		// Changes go to subscribers of kubernetes/<context>/<namespace>/<kind>;
+		// cluster-scoped kinds use "cluster" as namespace
+		k8sClusters.StartCaches(watchCtx, func(event kubernetes.ResourceEvent) {
+			hub.PublishTopic(k8sTopic(event.Context, event.Namespace, event.Kind), "kubernetes."+event.Kind, event)
+		})
+		// Connect the default context eagerly so its cache warms up
+		if _, err := k8sClusters.Get(""); err != nil {
+			logrus.Warnf("Kubernetes default context is not available: %v", err)
+		}
+	}
+
+	// Image registries used for pushes and the registry browser
+	for _, reg := range config.GlobalConfig.Docker.Registries {
+		imageRegistries[reg.Name] = docker.NewRegistryClient(docker.RegistryConfig{
+			Name:     reg.Name,
+			URL:      reg.URL,
+			Username: reg.Username,
+			Password: reg.Password,
+			Insecure: reg.Insecure,
+		}, nil)
+	}
+
 	// Setup router
 	router := setupRouter(hub)
 
@@ -799,6 +1209,11 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	logrus.Info("Shutting down server...")
+	stopWatchers()
+	closeTerminalSessions()
+	if k8sClusters != nil {
+		k8sClusters.StopAllPortForwards()
+	}
 
 	// Give outstanding requests a deadline for completion
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+
+	"devops-unity-backend/pkg/kubernetes"
+)
+
+// terminalSession is an open exec or attach bridged to a browser socket.
+type terminalSession struct {
+	ID        string    `json:"id"`
+	Mode      string    `json:"mode"` // exec or attach
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Container string    `json:"container,omitempty"`
+	Started   time.Time `json:"started"`
+
+	cancel context.CancelFunc
+}
+
+// terminals tracks open sessions so they can be listed and closed on
+// shutdown; hijacked connections are not closed by http.Server.Shutdown.
+var terminals = struct {
+	sync.Mutex
+	sessions map[string]*terminalSession
+}{sessions: make(map[string]*terminalSession)}
+
+// terminalMessage is the JSON frame exchanged with the browser. The client
+// sends stdin and resize frames; the server sends stdout, stderr and a
+// final exit frame.
+type terminalMessage struct {
+	Type  string `json:"type"`
+	Data  string `json:"data,omitempty"`
+	Cols  uint16 `json:"cols,omitempty"`
+	Rows  uint16 `json:"rows,omitempty"`
+	Code  int    `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// terminalConn serializes writes from the stdout and stderr copiers.
+type terminalConn struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (t *terminalConn) send(msg terminalMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conn.WriteJSON(msg)
+}
+
+// terminalWriter forwards process output as frames of one type.
+type terminalWriter struct {
+	conn   *terminalConn
+	stream string
+}
+
+func (w terminalWriter) Write(p []byte) (int, error) {
+	if err := w.conn.send(terminalMessage{Type: w.stream, Data: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// podTerminal upgrades /pods/:name/exec or /pods/:name/attach to a
+// WebSocket bridged to the container. Query: namespace, container, tty
+// (default true) and, for exec, repeated command parameters.
+func podTerminal(mode string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireK8s(c) {
+			return
+		}
+		if !websocket.IsWebSocketUpgrade(c.Request) {
+			c.JSON(400, gin.H{"error": "a WebSocket upgrade is required"})
+			return
+		}
+
+		km := k8sFor(c)
+		session := &terminalSession{
+			ID:        uuid.NewString(),
+			Mode:      mode,
+			Namespace: c.DefaultQuery("namespace", "default"),
+			Pod:       c.Param("name"),
+			Container: c.Query("container"),
+			Started:   time.Now(),
+		}
+		opts := kubernetes.ExecOptions{
+			Container: session.Container,
+			Command:   c.QueryArray("command"),
+			TTY:       c.DefaultQuery("tty", "true") == "true",
+		}
+
+		ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			logrus.Errorf("WebSocket upgrade error: %v", err)
+			return
+		}
+		defer ws.Close()
+		conn := &terminalConn{conn: ws}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		session.cancel = cancel
+		terminals.Lock()
+		terminals.sessions[session.ID] = session
+		terminals.Unlock()
+		defer func() {
+			cancel()
+			terminals.Lock()
+			delete(terminals.sessions, session.ID)
+			terminals.Unlock()
+			logrus.Infof("Terminal session %s closed", session.ID)
+		}()
+
+		stdin, stdinWriter := io.Pipe()
+		resize := make(chan kubernetes.TerminalSize, 4)
+		go func() {
+			defer cancel()
+			defer stdinWriter.Close()
+			for {
+				var msg terminalMessage
+				if err := ws.ReadJSON(&msg); err != nil {
+					return
+				}
+				switch msg.Type {
+				case "stdin":
+					if _, err := stdinWriter.Write([]byte(msg.Data)); err != nil {
+						return
+					}
+				case "resize":
+					sendLatestSize(resize, kubernetes.TerminalSize{Cols: msg.Cols, Rows: msg.Rows})
+				}
+			}
+		}()
+
+		streams := kubernetes.TerminalStreams{
+			Stdin:  stdin,
+			Stdout: terminalWriter{conn: conn, stream: "stdout"},
+			Stderr: terminalWriter{conn: conn, stream: "stderr"},
+			Resize: resize,
+		}
+		if mode == "attach" {
+			err = km.Attach(ctx, session.Namespace, session.Pod, opts, streams)
+		} else {
+			err = km.Exec(ctx, session.Namespace, session.Pod, opts, streams)
+		}
+
+		exit := terminalMessage{Type: "exit"}
+		var exitErr *kubernetes.ExitError
+		switch {
+		case errors.As(err, &exitErr):
+			exit.Code = exitErr.Code
+		case err != nil && ctx.Err() == nil:
+			exit.Code = -1
+			exit.Error = err.Error()
+		}
+		conn.send(exit)
+		conn.mu.Lock()
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		conn.mu.Unlock()
+	}
+}
+
+func getTerminalSessions(c *gin.Context) {
+	terminals.Lock()
+	sessions := make([]*terminalSession, 0, len(terminals.sessions))
+	for _, session := range terminals.sessions {
+		sessions = append(sessions, session)
+	}
+	terminals.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Started.Before(sessions[j].Started) })
+	c.JSON(200, gin.H{"sessions": sessions})
+}
+
+func closeTerminalSession(c *gin.Context) {
+	terminals.Lock()
+	session, ok := terminals.sessions[c.Param("id")]
+	terminals.Unlock()
+	if !ok {
+		c.JSON(404, gin.H{"error": "terminal session not found"})
+		return
+	}
+	session.cancel()
+	c.JSON(200, gin.H{"message": "Terminal session " + session.ID + " closed"})
+}
+
+// closeTerminalSessions ends every open session, on server shutdown.
+func closeTerminalSessions() {
+	terminals.Lock()
+	defer terminals.Unlock()
+	var ids []string
+	for id, session := range terminals.sessions {
+		session.cancel()
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 {
+		logrus.Infof("Closed terminal sessions: %s", strings.Join(ids, ", "))
+	}
+}
+
+// sendLatestSize queues a terminal size without blocking. When the queue is
+// full the queued sizes are stale, so they are drained to make room for the
+// latest one.
+func sendLatestSize(resize chan kubernetes.TerminalSize, size kubernetes.TerminalSize) {
+	for {
+		select {
+		case resize <- size:
+			return
+		default:
+		}
+		select {
+		case <-resize:
+		default:
+		}
+	}
+}
@@ -11,14 +11,29 @@ type Config struct {
 		Port     string `json:"port"`
 		Host     string `json:"host"`
 		DevMode  bool   `json:"devMode"`
+		// AllowShowSecrets lets API callers unmask secret values with
+		// show_secrets=true
+		AllowShowSecrets bool `json:"allowShowSecrets"`
+		// AllowedOrigins are the browser origins allowed to open WebSockets;
+		// empty allows loopback origins only, "*" allows any origin
+		AllowedOrigins []string `json:"allowedOrigins"`
 	} `json:"server"`
 	Docker struct {
-		SocketPath string `json:"socketPath"`
-		APIVersion string `json:"apiVersion"`
+		SocketPath string           `json:"socketPath"`
+		APIVersion string           `json:"apiVersion"`
+		Endpoints  []DockerEndpoint `json:"endpoints"`
+		Registries []DockerRegistry `json:"registries"`
 	} `json:"docker"`
 	Kubernetes struct {
 		ConfigPath string `json:"configPath"`
-		Context    string `json:"context"`
+		// ConfigPaths are extra kubeconfig files merged after KUBECONFIG
+		ConfigPaths []string `json:"configPaths"`
+		// Context is the default context; empty uses current-context
+		Context string `json:"context"`
+		// FieldManager names the owner of fields set by server-side apply
+		FieldManager string `json:"fieldManager"`
+		// HelmPath is the helm executable used to change releases
+		HelmPath string `json:"helmPath"`
 	} `json:"kubernetes"`
 	Ansible struct {
 		PlaybooksPath string `json:"playbooksPath"`
@@ -26,6 +41,25 @@ type Config struct {
 	} `json:"ansible"`
 }
 
+// DockerEndpoint is an additional named Docker daemon. Host accepts
+// unix://, tcp:// and ssh:// URLs; TLS files apply to tcp:// hosts.
+type DockerEndpoint struct {
+	Name      string `json:"name"`
+	Host      string `json:"host"`
+	TLSCACert string `json:"tlsCaCert"`
+	TLSCert   string `json:"tlsCert"`
+	TLSKey    string `json:"tlsKey"`
+}
+
+// DockerRegistry is an image registry used for pushes and browsing.
+type DockerRegistry struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Insecure bool   `json:"insecure"`
+}
+
 var GlobalConfig Config
 
 func LoadConfig(configPath string) error {
@@ -0,0 +1,434 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/api/types/filters"
+	networkTypes "github.com/docker/docker/api/types/network"
+)
+
+// Prune targets accepted by Prune.
+const (
+	PruneContainers = "containers"
+	PruneImages     = "images"
+	PruneVolumes    = "volumes"
+	PruneNetworks   = "networks"
+	PruneBuildCache = "build-cache"
+)
+
+// predefinedNetworks are created by the daemon and never pruned.
+var predefinedNetworks = map[string]bool{"bridge": true, "host": true, "none": true, "default": true, "nat": true}
+
+// anonymousVolumeLabel marks volumes created without a name.
+const anonymousVolumeLabel = "com.docker.volume.anonymous"
+
+// DiskUsageReport is the equivalent of `docker system df -v`.
+type DiskUsageReport struct {
+	Images           DiskUsageCategory `json:"images"`
+	Containers       DiskUsageCategory `json:"containers"`
+	Volumes          DiskUsageCategory `json:"volumes"`
+	BuildCache       DiskUsageCategory `json:"build_cache"`
+	LayersSize       int64             `json:"layers_size"`
+	TotalSize        int64             `json:"total_size"`
+	TotalReclaimable int64             `json:"total_reclaimable"`
+}
+
+type DiskUsageCategory struct {
+	Total       int        `json:"total"`
+	Active      int        `json:"active"`
+	Size        int64      `json:"size"`
+	Reclaimable int64      `json:"reclaimable"`
+	Items       []DiskItem `json:"items"`
+}
+
+type DiskItem struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Size     int64             `json:"size"`
+	InUse    bool              `json:"in_use"`
+	Dangling bool              `json:"dangling,omitempty"`
+	Created  time.Time         `json:"created"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// PruneOptions selects what Prune removes. Until accepts a Go duration
+// ("24h") or an RFC 3339 / unix timestamp; Labels entries are "key",
+// "key=value" or the negated "!key", "!key=value".
+type PruneOptions struct {
+	Targets []string `json:"targets"`
+	All     bool     `json:"all"` // unused images and named volumes, not only dangling/anonymous
+	Until   string   `json:"until"`
+	Labels  []string `json:"labels"`
+	DryRun  bool     `json:"dry_run"`
+}
+
+type PruneResult struct {
+	DryRun         bool                `json:"dry_run"`
+	Targets        []PruneTargetResult `json:"targets"`
+	SpaceReclaimed uint64              `json:"space_reclaimed"`
+}
+
+type PruneTargetResult struct {
+	Target         string     `json:"target"`
+	Items          []DiskItem `json:"items"`
+	SpaceReclaimed uint64     `json:"space_reclaimed"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// DiskUsage reports space used by images, containers, volumes and build
+// cache, and how much of it could be reclaimed by pruning.
+func (dm *DockerManager) DiskUsage() (*DiskUsageReport, error) {
+	du, err := dm.client.DiskUsage(context.Background(), types.DiskUsageOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get disk usage: %w", err)
+	}
+
+	report := &DiskUsageReport{LayersSize: du.LayersSize}
+
+	for _, img := range du.Images {
+		item := imageDiskItem(img.ID, img.RepoTags, img.Size, img.Containers, img.Created, img.Labels)
+		report.Images.add(item, img.Size-img.SharedSize)
+	}
+
+	for _, c := range du.Containers {
+		info := toContainerInfo(*c)
+		item := DiskItem{
+			ID:      c.ID,
+			Name:    info.Name,
+			Size:    c.SizeRw,
+			InUse:   c.State == "running" || c.State == "paused" || c.State == "restarting",
+			Created: info.Created,
+			Labels:  c.Labels,
+		}
+		report.Containers.add(item, c.SizeRw)
+	}
+
+	for _, v := range du.Volumes {
+		item := DiskItem{ID: v.Name, Name: v.Name, Labels: v.Labels, Size: -1}
+		if v.UsageData != nil {
+			item.Size = v.UsageData.Size
+			item.InUse = v.UsageData.RefCount > 0
+		}
+		item.Created, _ = time.Parse(time.RFC3339, v.CreatedAt)
+		report.Volumes.add(item, item.Size)
+	}
+
+	for _, bc := range du.BuildCache {
+		item := DiskItem{
+			ID:      bc.ID,
+			Name:    bc.Description,
+			Size:    bc.Size,
+			InUse:   bc.InUse,
+			Created: bc.CreatedAt,
+		}
+		reclaimable := bc.Size
+		if bc.Shared {
+			reclaimable = 0
+		}
+		report.BuildCache.add(item, reclaimable)
+	}
+
+	for _, category := range []DiskUsageCategory{report.Images, report.Containers, report.Volumes, report.BuildCache} {
+		report.TotalSize += category.Size
+		report.TotalReclaimable += category.Reclaimable
+	}
+	return report, nil
+}
+
+func (c *DiskUsageCategory) add(item DiskItem, reclaimable int64) {
+	c.Total++
+	c.Items = append(c.Items, item)
+	if item.Size > 0 {
+		c.Size += item.Size
+	}
+	if item.InUse {
+		c.Active++
+	} else if reclaimable > 0 {
+		c.Reclaimable += reclaimable
+	}
+}
+
+func imageDiskItem(id string, tags []string, size, containers, created int64, labels map[string]string) DiskItem {
+	dangling := isDangling(tags)
+	name := id
+	if !dangling {
+		name = tags[0]
+	}
+	return DiskItem{
+		ID:       id,
+		Name:     name,
+		Size:     size,
+		InUse:    containers > 0,
+		Dangling: dangling,
+		Created:  time.Unix(created, 0),
+		Labels:   labels,
+	}
+}
+
+// isDangling reports whether an image has no repository:tag reference.
+func isDangling(tags []string) bool {
+	for _, tag := range tags {
+		if tag != "<none>:<none>" {
+			return false
+		}
+	}
+	return true
+}
+
+// Prune removes unused objects, or only lists what would be removed when
+// opts.DryRun is set. Targets default to everything but volumes.
+func (dm *DockerManager) Prune(opts PruneOptions) (*PruneResult, error) {
+	targets := opts.Targets
+	if len(targets) == 0 {
+		targets = []string{PruneContainers, PruneImages, PruneNetworks, PruneBuildCache}
+	}
+
+	// Reject unknown targets before anything is removed
+	for _, target := range targets {
+		switch target {
+		case PruneContainers, PruneImages, PruneVolumes, PruneNetworks, PruneBuildCache:
+		default:
+			return nil, fmt.Errorf("unknown prune target %q", target)
+		}
+	}
+
+	until, err := parseUntil(opts.Until)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates map[string][]DiskItem
+	if opts.DryRun {
+		if candidates, err = dm.pruneCandidates(opts, until); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &PruneResult{DryRun: opts.DryRun}
+	for _, target := range targets {
+		var tr PruneTargetResult
+		if opts.DryRun {
+			items := candidates[target]
+			tr = PruneTargetResult{Target: target, Items: items}
+			for _, item := range items {
+				if item.Size > 0 {
+					tr.SpaceReclaimed += uint64(item.Size)
+				}
+			}
+		} else {
+			tr, err = dm.pruneTarget(target, opts)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result.SpaceReclaimed += tr.SpaceReclaimed
+		result.Targets = append(result.Targets, tr)
+	}
+	return result, nil
+}
+
+func (dm *DockerManager) pruneTarget(target string, opts PruneOptions) (PruneTargetResult, error) {
+	ctx := context.Background()
+	args := pruneFilters(opts)
+	tr := PruneTargetResult{Target: target}
+
+	switch target {
+	case PruneContainers:
+		report, err := dm.client.ContainersPrune(ctx, args)
+		if err != nil {
+			tr.Error = err.Error()
+			break
+		}
+		for _, id := range report.ContainersDeleted {
+			tr.Items = append(tr.Items, DiskItem{ID: id, Name: shortID(id)})
+		}
+		tr.SpaceReclaimed = report.SpaceReclaimed
+	case PruneImages:
+		args.Add("dangling", strconv.FormatBool(!opts.All))
+		report, err := dm.client.ImagesPrune(ctx, args)
+		if err != nil {
+			tr.Error = err.Error()
+			break
+		}
+		for _, deleted := range report.ImagesDeleted {
+			if deleted.Deleted != "" {
+				tr.Items = append(tr.Items, DiskItem{ID: deleted.Deleted, Name: deleted.Deleted})
+			} else if deleted.Untagged != "" {
+				tr.Items = append(tr.Items, DiskItem{Name: deleted.Untagged})
+			}
+		}
+		tr.SpaceReclaimed = report.SpaceReclaimed
+	case PruneVolumes:
+		// The volumes prune endpoint does not support "until"
+		args.Del("until", opts.Until)
+		if opts.All {
+			args.Add("all", "true")
+		}
+		report, err := dm.client.VolumesPrune(ctx, args)
+		if err != nil {
+			tr.Error = err.Error()
+			break
+		}
+		for _, name := range report.VolumesDeleted {
+			tr.Items = append(tr.Items, DiskItem{ID: name, Name: name})
+		}
+		tr.SpaceReclaimed = report.SpaceReclaimed
+	case PruneNetworks:
+		report, err := dm.client.NetworksPrune(ctx, args)
+		if err != nil {
+			tr.Error = err.Error()
+			break
+		}
+		for _, name := range report.NetworksDeleted {
+			tr.Items = append(tr.Items, DiskItem{ID: name, Name: name})
+		}
+	case PruneBuildCache:
+		report, err := dm.client.BuildCachePrune(ctx, build.CachePruneOptions{All: opts.All, Filters: args})
+		if err != nil {
+			tr.Error = err.Error()
+			break
+		}
+		for _, id := range report.CachesDeleted {
+			tr.Items = append(tr.Items, DiskItem{ID: id, Name: id})
+		}
+		tr.SpaceReclaimed = report.SpaceReclaimed
+	default:
+		return tr, fmt.Errorf("unknown prune target %q", target)
+	}
+	return tr, nil
+}
+
+// pruneCandidates mirrors the daemon's prune rules to preview what a prune
+// with the same options would remove.
+func (dm *DockerManager) pruneCandidates(opts PruneOptions, until time.Time) (map[string][]DiskItem, error) {
+	report, err := dm.DiskUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	keep := func(item DiskItem) bool {
+		if item.InUse || !matchLabels(item.Labels, opts.Labels) {
+			return false
+		}
+		return until.IsZero() || item.Created.Before(until)
+	}
+
+	candidates := map[string][]DiskItem{
+		PruneContainers: {},
+		PruneImages:     {},
+		PruneVolumes:    {},
+		PruneNetworks:   {},
+		PruneBuildCache: {},
+	}
+	for _, item := range report.Containers.Items {
+		if keep(item) {
+			candidates[PruneContainers] = append(candidates[PruneContainers], item)
+		}
+	}
+	for _, item := range report.Images.Items {
+		if keep(item) && (opts.All || item.Dangling) {
+			candidates[PruneImages] = append(candidates[PruneImages], item)
+		}
+	}
+	for _, item := range report.Volumes.Items {
+		// until is not supported for volumes
+		anonymous := item.Labels[anonymousVolumeLabel] != ""
+		if !item.InUse && matchLabels(item.Labels, opts.Labels) && (opts.All || anonymous) {
+			candidates[PruneVolumes] = append(candidates[PruneVolumes], item)
+		}
+	}
+	for _, item := range report.BuildCache.Items {
+		if keep(item) {
+			candidates[PruneBuildCache] = append(candidates[PruneBuildCache], item)
+		}
+	}
+
+	networks, err := dm.unusedNetworks()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range networks {
+		if keep(item) {
+			candidates[PruneNetworks] = append(candidates[PruneNetworks], item)
+		}
+	}
+	return candidates, nil
+}
+
+func (dm *DockerManager) unusedNetworks() ([]DiskItem, error) {
+	networks, err := dm.client.NetworkList(context.Background(), networkTypes.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %w", err)
+	}
+	containers, err := dm.fetchContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+	for _, c := range containers {
+		for _, name := range c.NetworkNames {
+			used[name] = true
+		}
+	}
+
+	var result []DiskItem
+	for _, n := range networks {
+		if predefinedNetworks[n.Name] || used[n.Name] {
+			continue
+		}
+		result = append(result, DiskItem{ID: n.ID, Name: n.Name, Created: n.Created, Labels: n.Labels})
+	}
+	return result, nil
+}
+
+func pruneFilters(opts PruneOptions) filters.Args {
+	args := filters.NewArgs()
+	if opts.Until != "" {
+		args.Add("until", opts.Until)
+	}
+	for _, label := range opts.Labels {
+		if strings.HasPrefix(label, "!") {
+			args.Add("label!", strings.TrimPrefix(label, "!"))
+		} else {
+			args.Add("label", label)
+		}
+	}
+	return args
+}
+
+func parseUntil(until string) (time.Time, error) {
+	if until == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(until); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, until); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseInt(until, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid until value %q", until)
+}
+
+// matchLabels applies prune label filters to a set of labels.
+func matchLabels(labels map[string]string, selectors []string) bool {
+	for _, selector := range selectors {
+		negate := strings.HasPrefix(selector, "!")
+		key, value, hasValue := strings.Cut(strings.TrimPrefix(selector, "!"), "=")
+		actual, present := labels[key]
+		matched := present && (!hasValue || actual == value)
+		if matched == negate {
+			return false
+		}
+	}
+	return true
+}
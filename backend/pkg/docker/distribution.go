@@ -0,0 +1,523 @@
+package docker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/reference"
+)
+
+// RegistryConfig describes an image registry browsable through the OCI
+// distribution API. URL may omit the scheme, in which case https is used
+// unless Insecure is set.
+type RegistryConfig struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"-"`
+	Insecure bool   `json:"insecure"`
+}
+
+// Host returns the registry host as used in image references.
+func (rc RegistryConfig) Host() string {
+	host := rc.URL
+	if u, err := url.Parse(rc.URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// Auth returns the push credentials of the registry, if any.
+func (rc RegistryConfig) Auth() *RegistryAuth {
+	if rc.Username == "" {
+		return nil
+	}
+	return &RegistryAuth{Username: rc.Username, Password: rc.Password}
+}
+
+// RegistryPage is one page of a paginated registry listing. Next is the
+// cursor to pass back for the following page, empty on the last one.
+type RegistryPage struct {
+	Items []string `json:"items"`
+	Next  string   `json:"next,omitempty"`
+}
+
+// RegistryManifest is an image manifest or, for multi-platform images, an
+// image index listing one manifest per platform.
+type RegistryManifest struct {
+	Repository string               `json:"repository"`
+	Reference  string               `json:"reference"`
+	Digest     string               `json:"digest"`
+	MediaType  string               `json:"media_type"`
+	Size       int64                `json:"size"`
+	Config     *ManifestDescriptor  `json:"config,omitempty"`
+	Layers     []ManifestDescriptor `json:"layers,omitempty"`
+	Manifests  []ManifestDescriptor `json:"manifests,omitempty"`
+}
+
+type ManifestDescriptor struct {
+	MediaType string `json:"media_type"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	Platform  string `json:"platform,omitempty"` // os/architecture[/variant]
+}
+
+// manifestDescriptor is a descriptor as the distribution API encodes it.
+type manifestDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	Platform  *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+	} `json:"platform"`
+}
+
+func (d manifestDescriptor) descriptor() ManifestDescriptor {
+	result := ManifestDescriptor{MediaType: d.MediaType, Digest: d.Digest, Size: d.Size}
+	if p := d.Platform; p != nil {
+		result.Platform = p.OS + "/" + p.Architecture
+		if p.Variant != "" {
+			result.Platform += "/" + p.Variant
+		}
+	}
+	return result
+}
+
+// manifestMediaTypes are the manifest formats the client accepts: OCI and
+// Docker schema 2 manifests and indexes.
+var manifestMediaTypes = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+// maxManifestSize is the largest manifest read, as in the registry itself.
+const maxManifestSize = 4 << 20
+
+// Repository names, tags and digests are checked before they are put in
+// a request path.
+var (
+	repositoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagPattern        = regexp.MustCompile(`^` + reference.TagRegexp.String() + `$`)
+	digestPattern     = regexp.MustCompile(`^` + reference.DigestRegexp.String() + `$`)
+)
+
+// RegistryClient talks to a registry's /v2 API, handling basic and bearer
+// token authentication.
+type RegistryClient struct {
+	config  RegistryConfig
+	baseURL string
+	http    *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string // scope -> bearer token
+}
+
+// NewRegistryClient creates a client for cfg. httpClient may be nil.
+func NewRegistryClient(cfg RegistryConfig, httpClient *http.Client) *RegistryClient {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	base := strings.TrimSuffix(cfg.URL, "/")
+	if !strings.Contains(base, "://") {
+		if cfg.Insecure {
+			base = "http://" + base
+		} else {
+			base = "https://" + base
+		}
+	}
+	return &RegistryClient{
+		config:  cfg,
+		baseURL: base,
+		http:    httpClient,
+		tokens:  make(map[string]string),
+	}
+}
+
+func (rc *RegistryClient) Config() RegistryConfig {
+	return rc.config
+}
+
+// Ping checks that the registry speaks the distribution API and that the
+// configured credentials are accepted.
+func (rc *RegistryClient) Ping() error {
+	resp, err := rc.get("/v2/", "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ListRepositories returns up to n repositories after the cursor last.
+func (rc *RegistryClient) ListRepositories(last string, n int) (*RegistryPage, error) {
+	var body struct {
+		Repositories []string `json:"repositories"`
+	}
+	next, err := rc.getPage("/v2/_catalog", "registry:catalog:*", last, n, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories of %s: %w", rc.config.Name, err)
+	}
+	return &RegistryPage{Items: body.Repositories, Next: next}, nil
+}
+
+// ListTags returns up to n tags of repository after the cursor last.
+func (rc *RegistryClient) ListTags(repository string, last string, n int) (*RegistryPage, error) {
+	if !repositoryPattern.MatchString(repository) {
+		return nil, fmt.Errorf("invalid repository name %q", repository)
+	}
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	scope := "repository:" + repository + ":pull"
+	next, err := rc.getPage("/v2/"+repository+"/tags/list", scope, last, n, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of %s: %w", repository, err)
+	}
+	return &RegistryPage{Items: body.Tags, Next: next}, nil
+}
+
+// GetManifest returns the manifest of a tag or digest. For an image index
+// (multi-platform image) Manifests lists the platform images.
+func (rc *RegistryClient) GetManifest(repository, ref string) (*RegistryManifest, error) {
+	raw, mediaType, digest, err := rc.fetchManifest(repository, ref, "repository:"+repository+":pull")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest %s:%s: %w", repository, ref, err)
+	}
+
+	var body struct {
+		MediaType string               `json:"mediaType"`
+		Config    *manifestDescriptor  `json:"config"`
+		Layers    []manifestDescriptor `json:"layers"`
+		Manifests []manifestDescriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s:%s: %w", repository, ref, err)
+	}
+	if mediaType == "" {
+		mediaType = body.MediaType
+	}
+
+	manifest := &RegistryManifest{
+		Repository: repository,
+		Reference:  ref,
+		Digest:     digest,
+		MediaType:  mediaType,
+		Size:       int64(len(raw)),
+	}
+	if body.Config != nil {
+		config := body.Config.descriptor()
+		manifest.Config = &config
+	}
+	for _, layer := range body.Layers {
+		manifest.Layers = append(manifest.Layers, layer.descriptor())
+	}
+	for _, m := range body.Manifests {
+		manifest.Manifests = append(manifest.Manifests, m.descriptor())
+	}
+	return manifest, nil
+}
+
+// TagManifest points tag at the manifest of source (a tag or digest) in
+// the same repository, without pulling or pushing any layer.
+func (rc *RegistryClient) TagManifest(repository, source, tag string) (*RegistryManifest, error) {
+	if !tagPattern.MatchString(tag) {
+		return nil, fmt.Errorf("invalid tag %q", tag)
+	}
+	scope := "repository:" + repository + ":pull,push"
+	raw, mediaType, digest, err := rc.fetchManifest(repository, source, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest %s:%s: %w", repository, source, err)
+	}
+
+	header := http.Header{"Content-Type": []string{mediaType}}
+	resp, err := rc.send(http.MethodPut, "/v2/"+repository+"/manifests/"+tag, scope, header, raw, http.StatusCreated, http.StatusOK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tag %s:%s as %s: %w", repository, source, tag, err)
+	}
+	resp.Body.Close()
+	return &RegistryManifest{Repository: repository, Reference: tag, Digest: digest, MediaType: mediaType, Size: int64(len(raw))}, nil
+}
+
+// DeleteManifest deletes the manifest a tag or digest refers to and
+// returns its digest. Registries delete by digest, so every tag of the
+// manifest goes with it.
+func (rc *RegistryClient) DeleteManifest(repository, ref string) (string, error) {
+	scope := "repository:" + repository + ":pull,delete"
+	digest := ref
+	if !digestPattern.MatchString(ref) {
+		var err error
+		if _, _, digest, err = rc.fetchManifest(repository, ref, scope); err != nil {
+			return "", fmt.Errorf("failed to resolve %s:%s: %w", repository, ref, err)
+		}
+	}
+
+	resp, err := rc.send(http.MethodDelete, "/v2/"+repository+"/manifests/"+digest, scope, nil, nil, http.StatusAccepted, http.StatusOK)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete %s@%s: %w", repository, digest, err)
+	}
+	resp.Body.Close()
+	return digest, nil
+}
+
+// fetchManifest downloads a manifest as stored, with its media type and
+// digest, so it can be pushed again byte for byte.
+func (rc *RegistryClient) fetchManifest(repository, ref, scope string) ([]byte, string, string, error) {
+	if !repositoryPattern.MatchString(repository) {
+		return nil, "", "", fmt.Errorf("invalid repository name %q", repository)
+	}
+	if !tagPattern.MatchString(ref) && !digestPattern.MatchString(ref) {
+		return nil, "", "", fmt.Errorf("invalid tag or digest %q", ref)
+	}
+
+	header := http.Header{"Accept": []string{manifestMediaTypes}}
+	resp, err := rc.send(http.MethodGet, "/v2/"+repository+"/manifests/"+ref, scope, header, nil, http.StatusOK)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		sum := sha256.Sum256(raw)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	return raw, strings.TrimSpace(mediaType), digest, nil
+}
+
+// getPage fetches one page of a paginated listing into out and returns the
+// cursor of the next page from the Link header.
+func (rc *RegistryClient) getPage(path, scope, last string, n int, out interface{}) (string, error) {
+	query := url.Values{}
+	if n > 0 {
+		query.Set("n", strconv.Itoa(n))
+	}
+	if last != "" {
+		query.Set("last", last)
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	resp, err := rc.get(path, scope)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return "", fmt.Errorf("invalid registry response: %w", err)
+	}
+	return nextCursor(resp.Header.Get("Link")), nil
+}
+
+// get performs an authenticated GET, answering one auth challenge.
+func (rc *RegistryClient) get(path, scope string) (*http.Response, error) {
+	return rc.send(http.MethodGet, path, scope, nil, nil, http.StatusOK)
+}
+
+// send performs an authenticated request, answering one auth challenge,
+// and fails unless the response status is one of expected. The body is
+// sent again after the challenge.
+func (rc *RegistryClient) send(method, path, scope string, header http.Header, body []byte, expected ...int) (*http.Response, error) {
+	resp, err := rc.do(method, path, scope, header, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := rc.authorize(challenge, scope); err != nil {
+			return nil, err
+		}
+		if resp, err = rc.do(method, path, scope, header, body); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	return nil, registryError(resp)
+}
+
+func (rc *RegistryClient) do(method, path, scope string, header http.Header, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, rc.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rc.mu.Lock()
+	token, ok := rc.tokens[scope]
+	rc.mu.Unlock()
+	switch {
+	case ok && token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case ok && rc.config.Username != "":
+		// An empty token records that the registry wants basic auth
+		req.SetBasicAuth(rc.config.Username, rc.config.Password)
+	}
+
+	resp, err := rc.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach registry %s: %w", rc.config.Name, err)
+	}
+	return resp, nil
+}
+
+// authorize answers a WWW-Authenticate challenge, fetching a bearer token
+// from the realm when the registry delegates to a token service.
+func (rc *RegistryClient) authorize(challenge, scope string) error {
+	authType, params := parseChallenge(challenge)
+	switch strings.ToLower(authType) {
+	case "basic":
+		if rc.config.Username == "" {
+			return fmt.Errorf("registry %s requires credentials", rc.config.Name)
+		}
+		rc.setToken(scope, "")
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("registry %s uses unsupported authentication %q", rc.config.Name, authType)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("registry %s sent an invalid token realm", rc.config.Name)
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if rc.config.Username != "" {
+		req.SetBasicAuth(rc.config.Username, rc.config.Password)
+	}
+	resp, err := rc.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get registry token: %w", registryError(resp))
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("invalid token response: %w", err)
+	}
+	token := body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+	if token == "" {
+		return fmt.Errorf("token service of %s returned no token", rc.config.Name)
+	}
+	rc.setToken(scope, token)
+	return nil
+}
+
+func (rc *RegistryClient) setToken(scope, token string) {
+	rc.mu.Lock()
+	rc.tokens[scope] = token
+	rc.mu.Unlock()
+}
+
+// registryError extracts the message of a distribution API error response.
+func registryError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var body struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(data, &body) == nil && len(body.Errors) > 0 {
+		return fmt.Errorf("%s: %s (%s)", resp.Status, body.Errors[0].Message, body.Errors[0].Code)
+	}
+	return fmt.Errorf("unexpected registry response %s", resp.Status)
+}
+
+// parseChallenge splits a WWW-Authenticate header such as
+// `Bearer realm="https://auth",service="registry",scope="a:b:pull,push"`.
+func parseChallenge(header string) (string, map[string]string) {
+	authType, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			params[key] = value
+		}
+	}
+	return authType, params
+}
+
+// nextCursor returns the last parameter of a `<url>; rel="next"` Link header.
+func nextCursor(link string) string {
+	if !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	u, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("last")
+}
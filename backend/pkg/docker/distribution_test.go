@@ -0,0 +1,409 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testUser     = "alice"
+	testPassword = "s3cret"
+	indexType    = "application/vnd.oci.image.index.v1+json"
+	manifestType = "application/vnd.oci.image.manifest.v1+json"
+)
+
+// testRegistry is an in-process distribution API with token auth: /v2
+// answers 401 with a bearer challenge, and /token issues one token per
+// scope to the test user.
+type testRegistry struct {
+	server *httptest.Server
+
+	mu          sync.Mutex
+	blobs       map[string]testManifest      // digest -> manifest
+	tags        map[string]map[string]string // repository -> tag -> digest
+	tokens      map[string]string            // token -> scope
+	tokenCalls  int
+	scopesAsked []string
+}
+
+type testManifest struct {
+	mediaType string
+	body      []byte
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	r := &testRegistry{
+		blobs:  make(map[string]testManifest),
+		tags:   make(map[string]map[string]string),
+		tokens: make(map[string]string),
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *testRegistry) client() *RegistryClient {
+	return NewRegistryClient(RegistryConfig{
+		Name:     "test",
+		URL:      r.server.URL,
+		Username: testUser,
+		Password: testPassword,
+	}, r.server.Client())
+}
+
+// put stores a manifest under a tag and returns its digest.
+func (r *testRegistry) put(repository, tag, mediaType string, body []byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sum := sha256.Sum256(body)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	r.blobs[digest] = testManifest{mediaType: mediaType, body: body}
+	if r.tags[repository] == nil {
+		r.tags[repository] = make(map[string]string)
+	}
+	if tag != "" {
+		r.tags[repository][tag] = digest
+	}
+	return digest
+}
+
+func (r *testRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		r.issueToken(w, req)
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, "/v2/") {
+		http.NotFound(w, req)
+		return
+	}
+
+	rest := strings.TrimPrefix(req.URL.Path, "/v2/")
+	var repository, kind, ref, scope string
+	switch {
+	case rest == "":
+	case rest == "_catalog":
+		scope = "registry:catalog:*"
+	case strings.HasSuffix(rest, "/tags/list"):
+		repository, kind = strings.TrimSuffix(rest, "/tags/list"), "tags"
+		scope = "repository:" + repository + ":pull"
+	case strings.Contains(rest, "/manifests/"):
+		i := strings.LastIndex(rest, "/manifests/")
+		repository, kind, ref = rest[:i], "manifests", rest[i+len("/manifests/"):]
+		actions := map[string]string{http.MethodGet: "pull", http.MethodPut: "push", http.MethodDelete: "delete"}
+		scope = "repository:" + repository + ":" + actions[req.Method]
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if !r.authorized(req, scope) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="%s"`, r.server.URL, scope))
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case rest == "":
+		w.WriteHeader(http.StatusOK)
+	case rest == "_catalog":
+		repositories := make([]string, 0, len(r.tags))
+		for repository := range r.tags {
+			repositories = append(repositories, repository)
+		}
+		sort.Strings(repositories)
+		json.NewEncoder(w).Encode(map[string][]string{"repositories": repositories})
+	case kind == "tags":
+		r.serveTags(w, req, repository)
+	case req.Method == http.MethodGet:
+		digest := ref
+		if !strings.HasPrefix(ref, "sha256:") {
+			digest = r.tags[repository][ref]
+		}
+		m, ok := r.blobs[digest]
+		if !ok {
+			writeRegistryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Write(m.body)
+	case req.Method == http.MethodPut:
+		body, _ := io.ReadAll(req.Body)
+		sum := sha256.Sum256(body)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		r.blobs[digest] = testManifest{mediaType: req.Header.Get("Content-Type"), body: body}
+		r.tags[repository][ref] = digest
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	case req.Method == http.MethodDelete:
+		if _, ok := r.blobs[ref]; !ok {
+			writeRegistryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		delete(r.blobs, ref)
+		for tag, digest := range r.tags[repository] {
+			if digest == ref {
+				delete(r.tags[repository], tag)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// serveTags lists tags in pages of n after last, like the registry.
+func (r *testRegistry) serveTags(w http.ResponseWriter, req *http.Request, repository string) {
+	tags := make([]string, 0, len(r.tags[repository]))
+	for tag := range r.tags[repository] {
+		if tag > req.URL.Query().Get("last") {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	var n int
+	fmt.Sscanf(req.URL.Query().Get("n"), "%d", &n)
+	if n > 0 && len(tags) > n {
+		tags = tags[:n]
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?last=%s&n=%d>; rel="next"`, repository, tags[n-1], n))
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"name": repository, "tags": tags})
+}
+
+// authorized accepts a bearer token issued for a scope granting the
+// requested actions.
+func (r *testRegistry) authorized(req *http.Request, scope string) bool {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	r.mu.Lock()
+	granted, ok := r.tokens[token]
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if scope == "" {
+		return true
+	}
+	want := strings.Split(scope, ":")
+	have := strings.Split(granted, ":")
+	if len(want) != 3 || len(have) != 3 || want[0] != have[0] || want[1] != have[1] {
+		return false
+	}
+	return want[2] == "*" && have[2] == "*" || strings.Contains(","+have[2]+",", ","+want[2]+",")
+}
+
+func (r *testRegistry) issueToken(w http.ResponseWriter, req *http.Request) {
+	user, password, ok := req.BasicAuth()
+	if !ok || user != testUser || password != testPassword {
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+		return
+	}
+	if req.URL.Query().Get("service") != "test-registry" {
+		writeRegistryError(w, http.StatusBadRequest, "DENIED", "unknown service")
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokenCalls++
+	scope := req.URL.Query().Get("scope")
+	r.scopesAsked = append(r.scopesAsked, scope)
+	token := fmt.Sprintf("token-%d", r.tokenCalls)
+	r.tokens[token] = scope
+	json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+func writeRegistryError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+func testImageManifest(layer string) []byte {
+	return []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,`+
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:%064x","size":120},`+
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:%s","size":2048}]}`,
+		manifestType, 1, strings.Repeat(layer, 64)[:64]))
+}
+
+func TestRegistryTokenAuth(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.put("team/app", "v1", manifestType, testImageManifest("a"))
+	rc := reg.client()
+
+	for i := 0; i < 2; i++ {
+		page, err := rc.ListRepositories("", 0)
+		if err != nil {
+			t.Fatalf("ListRepositories: %v", err)
+		}
+		if len(page.Items) != 1 || page.Items[0] != "team/app" {
+			t.Fatalf("repositories = %v, want [team/app]", page.Items)
+		}
+	}
+	if reg.tokenCalls != 1 {
+		t.Errorf("token requested %d times, want once and then reused", reg.tokenCalls)
+	}
+	if reg.scopesAsked[0] != "registry:catalog:*" {
+		t.Errorf("token scope = %q, want registry:catalog:*", reg.scopesAsked[0])
+	}
+
+	bad := NewRegistryClient(RegistryConfig{Name: "test", URL: reg.server.URL, Username: testUser, Password: "wrong"}, reg.server.Client())
+	if _, err := bad.ListRepositories("", 0); err == nil || !strings.Contains(err.Error(), "invalid credentials") {
+		t.Errorf("ListRepositories with a wrong password: err = %v, want invalid credentials", err)
+	}
+}
+
+func TestRegistryListTagsPages(t *testing.T) {
+	reg := newTestRegistry(t)
+	for _, tag := range []string{"v1", "v2", "v3"} {
+		reg.put("app", tag, manifestType, testImageManifest(tag[1:]))
+	}
+	rc := reg.client()
+
+	page, err := rc.ListTags("app", "", 2)
+	if err != nil {
+		t.Fatalf("ListTags: %v", err)
+	}
+	if strings.Join(page.Items, ",") != "v1,v2" || page.Next != "v2" {
+		t.Fatalf("first page = %v next %q, want [v1 v2] next v2", page.Items, page.Next)
+	}
+	page, err = rc.ListTags("app", page.Next, 2)
+	if err != nil {
+		t.Fatalf("ListTags: %v", err)
+	}
+	if strings.Join(page.Items, ",") != "v3" || page.Next != "" {
+		t.Fatalf("second page = %v next %q, want [v3] and no next", page.Items, page.Next)
+	}
+
+	if _, err := rc.ListTags("../_catalog", "", 0); err == nil {
+		t.Error("ListTags accepted an invalid repository name")
+	}
+}
+
+func TestRegistryGetManifestIndex(t *testing.T) {
+	reg := newTestRegistry(t)
+	amd64 := reg.put("app", "", manifestType, testImageManifest("a"))
+	arm64 := reg.put("app", "", manifestType, testImageManifest("b"))
+	index := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"manifests":[`+
+		`{"mediaType":%q,"digest":%q,"size":400,"platform":{"os":"linux","architecture":"amd64"}},`+
+		`{"mediaType":%q,"digest":%q,"size":400,"platform":{"os":"linux","architecture":"arm64","variant":"v8"}}]}`,
+		indexType, manifestType, amd64, manifestType, arm64))
+	indexDigest := reg.put("app", "latest", indexType, index)
+	rc := reg.client()
+
+	manifest, err := rc.GetManifest("app", "latest")
+	if err != nil {
+		t.Fatalf("GetManifest: %v", err)
+	}
+	if manifest.Digest != indexDigest || manifest.MediaType != indexType || manifest.Size != int64(len(index)) {
+		t.Errorf("index = %s %s %d, want %s %s %d", manifest.Digest, manifest.MediaType, manifest.Size, indexDigest, indexType, len(index))
+	}
+	if len(manifest.Manifests) != 2 || manifest.Manifests[0].Platform != "linux/amd64" || manifest.Manifests[1].Platform != "linux/arm64/v8" {
+		t.Fatalf("platform manifests = %+v", manifest.Manifests)
+	}
+
+	image, err := rc.GetManifest("app", manifest.Manifests[1].Digest)
+	if err != nil {
+		t.Fatalf("GetManifest by digest: %v", err)
+	}
+	if image.Config == nil || len(image.Layers) != 1 || image.Layers[0].Size != 2048 {
+		t.Errorf("image manifest = %+v, want a config and one 2048 byte layer", image)
+	}
+
+	if _, err := rc.GetManifest("app", "missing"); err == nil || !strings.Contains(err.Error(), "MANIFEST_UNKNOWN") {
+		t.Errorf("GetManifest of a missing tag: err = %v, want MANIFEST_UNKNOWN", err)
+	}
+}
+
+func TestRegistryTagManifest(t *testing.T) {
+	reg := newTestRegistry(t)
+	digest := reg.put("app", "v1", manifestType, testImageManifest("a"))
+	rc := reg.client()
+
+	tagged, err := rc.TagManifest("app", "v1", "stable")
+	if err != nil {
+		t.Fatalf("TagManifest: %v", err)
+	}
+	if tagged.Digest != digest {
+		t.Errorf("tagged digest = %s, want %s", tagged.Digest, digest)
+	}
+	reg.mu.Lock()
+	stored := reg.tags["app"]["stable"]
+	mediaType := reg.blobs[stored].mediaType
+	reg.mu.Unlock()
+	if stored != digest || mediaType != manifestType {
+		t.Errorf("registry has stable -> %s (%s), want %s (%s)", stored, mediaType, digest, manifestType)
+	}
+	if want := "repository:app:pull,push"; reg.scopesAsked[len(reg.scopesAsked)-1] != want {
+		t.Errorf("token scope = %q, want %q", reg.scopesAsked[len(reg.scopesAsked)-1], want)
+	}
+
+	if _, err := rc.TagManifest("app", "v1", "-bad"); err == nil {
+		t.Error("TagManifest accepted an invalid tag")
+	}
+}
+
+func TestRegistryDeleteManifest(t *testing.T) {
+	reg := newTestRegistry(t)
+	digest := reg.put("app", "v1", manifestType, testImageManifest("a"))
+	reg.put("app", "v1-alias", manifestType, testImageManifest("a"))
+	kept := reg.put("app", "v2", manifestType, testImageManifest("b"))
+	rc := reg.client()
+
+	deleted, err := rc.DeleteManifest("app", "v1")
+	if err != nil {
+		t.Fatalf("DeleteManifest: %v", err)
+	}
+	if deleted != digest {
+		t.Errorf("deleted digest = %s, want %s", deleted, digest)
+	}
+	page, err := rc.ListTags("app", "", 0)
+	if err != nil {
+		t.Fatalf("ListTags: %v", err)
+	}
+	if strings.Join(page.Items, ",") != "v2" {
+		t.Errorf("tags after delete = %v, want [v2]", page.Items)
+	}
+
+	if _, err := rc.DeleteManifest("app", kept); err != nil {
+		t.Fatalf("DeleteManifest by digest: %v", err)
+	}
+	if _, err := rc.DeleteManifest("app", kept); err == nil {
+		t.Error("deleting a deleted manifest succeeded")
+	}
+}
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"nginx", "docker.io/library/nginx:latest"},
+		{"localhost:5000/team/app:v1", "localhost:5000/team/app:v1"},
+		{"ghcr.io/org/app@sha256:" + strings.Repeat("a", 64), "ghcr.io/org/app@sha256:" + strings.Repeat("a", 64)},
+	}
+	for _, tt := range tests {
+		got, err := ParseImageReference(tt.ref)
+		if err != nil {
+			t.Errorf("ParseImageReference(%q): %v", tt.ref, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseImageReference(%q) = %s, want %s", tt.ref, got, tt.want)
+		}
+	}
+	if _, err := ParseImageReference("Upper"); err == nil {
+		t.Error("ParseImageReference accepted an invalid reference")
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
 	containerTypes "github.com/docker/docker/api/types/container"
 	imageTypes "github.com/docker/docker/api/types/image"
 	dockerclient "github.com/docker/docker/client"
@@ -13,18 +17,28 @@ import (
 )
 
 type DockerManager struct {
-	client *dockerclient.Client
+	client   *dockerclient.Client
+	endpoint string
+
+	// cache holds containers keyed by full ID while WatchEvents is running
+	cacheMu sync.RWMutex
+	cache   map[string]ContainerInfo
 }
 
 type ContainerInfo struct {
-	ID      string            `json:"id"`
-	Name    string            `json:"name"`
-	Image   string            `json:"image"`
-	Status  string            `json:"status"`
-	State   string            `json:"state"`
-	Ports   []PortInfo        `json:"ports"`
-	Created time.Time         `json:"created"`
-	Labels  map[string]string `json:"labels"`
+	ID           string            `json:"id"` // short ID
+	FullID       string            `json:"full_id"`
+	Name         string            `json:"name"`
+	Image        string            `json:"image"`
+	ImageID      string            `json:"image_id"`
+	Command      string            `json:"command"`
+	Status       string            `json:"status"`
+	State        string            `json:"state"`
+	Ports        []PortInfo        `json:"ports"`
+	NetworkNames []string          `json:"network_names"`
+	Created      time.Time         `json:"created"`
+	Labels       map[string]string `json:"labels"`
+	Endpoint     string            `json:"endpoint,omitempty"` // set in aggregated listings
 }
 
 type PortInfo struct {
@@ -35,10 +49,13 @@ type PortInfo struct {
 
 type ImageInfo struct {
 	ID          string    `json:"id"`
+	ShortID     string    `json:"short_id"`
 	RepoTags    []string  `json:"repo_tags"`
 	Size        int64     `json:"size"`
 	Created     time.Time `json:"created"`
 	VirtualSize int64     `json:"virtual_size"`
+	Containers  int       `json:"containers"`
+	Dangling    bool      `json:"dangling"`
 }
 
 type ContainerStats struct {
@@ -58,43 +75,79 @@ func NewDockerManager() (*DockerManager, error) {
 	}
 
 	return &DockerManager{
-		client: client,
+		client:   client,
+		endpoint: DefaultEndpoint,
 	}, nil
 }
 
 func (dm *DockerManager) ListContainers() ([]ContainerInfo, error) {
-	 containers, err := dm.client.ContainerList(context.Background(), containerTypes.ListOptions{
-	 	All: true,
-	 })
+	if cached, ok := dm.cachedContainers(); ok {
+		return cached, nil
+	}
+
+	containers, err := dm.fetchContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedContainers(containers), nil
+}
+
+// fetchContainers lists all containers from the daemon, keyed by full ID.
+func (dm *DockerManager) fetchContainers() (map[string]ContainerInfo, error) {
+	containers, err := dm.client.ContainerList(context.Background(), containerTypes.ListOptions{
+		All: true,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list containers: %w", err)
 	}
 
-	var result []ContainerInfo
+	result := make(map[string]ContainerInfo, len(containers))
 	for _, c := range containers {
-		ports := make([]PortInfo, len(c.Ports))
-		for i, port := range c.Ports {
-			ports[i] = PortInfo{
-				PrivatePort: int(port.PrivatePort),
-				PublicPort:  int(port.PublicPort),
-				Type:        string(port.Type),
-			}
+		result[c.ID] = toContainerInfo(c)
+	}
+
+	return result, nil
+}
+
+func toContainerInfo(c containerTypes.Summary) ContainerInfo {
+	ports := make([]PortInfo, len(c.Ports))
+	for i, port := range c.Ports {
+		ports[i] = PortInfo{
+			PrivatePort: int(port.PrivatePort),
+			PublicPort:  int(port.PublicPort),
+			Type:        string(port.Type),
 		}
+	}
 
-		containerInfo := ContainerInfo{
-			ID:      c.ID[:12],
-			Name:    c.Names[0][1:], // Remove leading slash
-			Image:   c.Image,
-			Status:  c.Status,
-			State:   c.State,
-			Ports:   ports,
-			Created: time.Unix(c.Created, 0),
-			Labels:  c.Labels,
+	// Names is empty for containers being removed
+	name := shortID(c.ID)
+	if len(c.Names) > 0 {
+		name = strings.TrimPrefix(c.Names[0], "/")
+	}
+
+	var networks []string
+	if c.NetworkSettings != nil {
+		for network := range c.NetworkSettings.Networks {
+			networks = append(networks, network)
 		}
-		result = append(result, containerInfo)
+		sort.Strings(networks)
 	}
 
-	return result, nil
+	return ContainerInfo{
+		ID:           shortID(c.ID),
+		FullID:       c.ID,
+		Name:         name,
+		Image:        c.Image,
+		ImageID:      c.ImageID,
+		Command:      c.Command,
+		Status:       c.Status,
+		State:        string(c.State),
+		Ports:        ports,
+		NetworkNames: networks,
+		Created:      time.Unix(c.Created, 0),
+		Labels:       c.Labels,
+	}
 }
 
 func (dm *DockerManager) StartContainer(containerID string) error {
@@ -127,7 +180,7 @@ func (dm *DockerManager) RemoveContainer(containerID string) error {
 }
 
 func (dm *DockerManager) ListImages() ([]ImageInfo, error) {
-	 images, err := dm.client.ImageList(context.Background(), imageTypes.ListOptions{All: true})
+	 images, err := dm.client.ImageList(context.Background(), imageTypes.ListOptions{All: true, ContainerCount: true})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list images: %w", err)
 	}
@@ -135,11 +188,14 @@ func (dm *DockerManager) ListImages() ([]ImageInfo, error) {
 	var result []ImageInfo
 	for _, img := range images {
 		imageInfo := ImageInfo{
-			ID:          img.ID[7:19], // Short ID
+			ID:          img.ID,
+			ShortID:     shortImageID(img.ID),
 			RepoTags:    img.RepoTags,
 			Size:        img.Size,
 			Created:     time.Unix(img.Created, 0),
 			VirtualSize: img.VirtualSize,
+			Containers:  int(img.Containers),
+			Dangling:    isDangling(img.RepoTags),
 		}
 		result = append(result, imageInfo)
 	}
@@ -224,6 +280,11 @@ func (dm *DockerManager) GetContainerLogs(containerID string, tail int) ([]strin
 		return logs, nil
 }
 
+// Endpoint returns the name of the Docker endpoint this manager talks to.
+func (dm *DockerManager) Endpoint() string {
+	return dm.endpoint
+}
+
 func (dm *DockerManager) IsConnected() bool {
 	_, err := dm.client.Ping(context.Background())
 	return err == nil
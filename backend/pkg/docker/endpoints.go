@@ -0,0 +1,379 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dockerclient "github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+)
+
+const DefaultEndpoint = "default"
+
+// Endpoint describes a Docker daemon the IDE can talk to.
+type Endpoint struct {
+	Name      string `json:"name"`
+	Host      string `json:"host"` // empty means DOCKER_HOST / platform default
+	TLSCACert string `json:"tls_ca_cert,omitempty"`
+	TLSCert   string `json:"tls_cert,omitempty"`
+	TLSKey    string `json:"tls_key,omitempty"`
+	Source    string `json:"source"` // env, config or context
+}
+
+type EndpointStatus struct {
+	Endpoint
+	Connected     bool      `json:"connected"`
+	Error         string    `json:"error,omitempty"`
+	ServerVersion string    `json:"server_version,omitempty"`
+	LastChecked   time.Time `json:"last_checked"`
+}
+
+// EndpointContainers is one endpoint's share of an aggregated listing.
+type EndpointContainers struct {
+	Endpoint   string          `json:"endpoint"`
+	Containers []ContainerInfo `json:"containers"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// Registry keeps one lazily created DockerManager per named endpoint.
+type Registry struct {
+	mu        sync.RWMutex
+	endpoints map[string]Endpoint
+	managers  map[string]*DockerManager
+	status    map[string]EndpointStatus
+	// defaultName is used when no endpoint is requested: the default
+	// endpoint, or the first configured one
+	defaultName string
+}
+
+func NewRegistry(endpoints []Endpoint) *Registry {
+	r := &Registry{
+		endpoints: make(map[string]Endpoint),
+		managers:  make(map[string]*DockerManager),
+		status:    make(map[string]EndpointStatus),
+	}
+	for _, ep := range endpoints {
+		if ep.Name == "" {
+			continue
+		}
+		if _, exists := r.endpoints[ep.Name]; exists {
+			logrus.Warnf("Duplicate Docker endpoint %s from %s ignored", ep.Name, ep.Source)
+			continue
+		}
+		r.endpoints[ep.Name] = ep
+		if r.defaultName == "" || ep.Name == DefaultEndpoint {
+			r.defaultName = ep.Name
+		}
+	}
+	return r
+}
+
+// DiscoverEndpoints returns the configured endpoints, or the default
+// endpoint (DOCKER_HOST or socketPath) when there are none, followed by the
+// docker CLI contexts found under ~/.docker/contexts.
+func DiscoverEndpoints(socketPath string, configured []Endpoint) []Endpoint {
+	var endpoints []Endpoint
+	for _, ep := range configured {
+		ep.Source = "config"
+		endpoints = append(endpoints, ep)
+	}
+	// The local daemon is only assumed when no endpoint is configured
+	if len(endpoints) == 0 {
+		defaultEndpoint := Endpoint{Name: DefaultEndpoint, Source: "env"}
+		if os.Getenv("DOCKER_HOST") == "" && socketPath != "" {
+			defaultEndpoint.Host = "unix://" + socketPath
+		}
+		endpoints = append([]Endpoint{defaultEndpoint}, endpoints...)
+	}
+
+	contexts, err := loadDockerContexts()
+	if err != nil {
+		logrus.Debugf("No Docker CLI contexts loaded: %v", err)
+	}
+	return append(endpoints, contexts...)
+}
+
+// dockerContextMeta is the subset of ~/.docker/contexts/meta/*/meta.json we use.
+type dockerContextMeta struct {
+	Name      string `json:"Name"`
+	Endpoints map[string]struct {
+		Host          string `json:"Host"`
+		SkipTLSVerify bool   `json:"SkipTLSVerify"`
+	} `json:"Endpoints"`
+}
+
+func loadDockerContexts() ([]Endpoint, error) {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+
+	metaFiles, err := filepath.Glob(filepath.Join(configDir, "contexts", "meta", "*", "meta.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []Endpoint
+	for _, path := range metaFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var meta dockerContextMeta
+		if err := json.Unmarshal(data, &meta); err != nil {
+			logrus.Warnf("Invalid Docker context %s: %v", path, err)
+			continue
+		}
+		docker, ok := meta.Endpoints["docker"]
+		if !ok || meta.Name == "" || meta.Name == DefaultEndpoint {
+			continue
+		}
+
+		ep := Endpoint{Name: meta.Name, Host: docker.Host, Source: "context"}
+		digest := sha256.Sum256([]byte(meta.Name))
+		tlsDir := filepath.Join(configDir, "contexts", "tls", hex.EncodeToString(digest[:]), "docker")
+		if _, err := os.Stat(filepath.Join(tlsDir, "cert.pem")); err == nil {
+			ep.TLSCACert = filepath.Join(tlsDir, "ca.pem")
+			ep.TLSCert = filepath.Join(tlsDir, "cert.pem")
+			ep.TLSKey = filepath.Join(tlsDir, "key.pem")
+		}
+		endpoints = append(endpoints, ep)
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Name < endpoints[j].Name })
+	return endpoints, nil
+}
+
+// NewDockerManagerForEndpoint creates a manager bound to a specific daemon.
+func NewDockerManagerForEndpoint(ep Endpoint) (*DockerManager, error) {
+	opts := []dockerclient.Opt{dockerclient.WithAPIVersionNegotiation()}
+
+	switch {
+	case ep.Host == "":
+		// DOCKER_HOST / DOCKER_CERT_PATH only apply to the default endpoint
+		opts = append(opts, dockerclient.FromEnv)
+	case strings.HasPrefix(ep.Host, "ssh://"):
+		dialer, err := sshDialer(ep.Host)
+		if err != nil {
+			return nil, err
+		}
+		// The host is only used to build request URLs; the dialer does the work
+		opts = append(opts, dockerclient.WithHost("http://docker.example.com"), dockerclient.WithDialContext(dialer))
+	default:
+		opts = append(opts, dockerclient.WithHost(ep.Host))
+	}
+
+	if ep.TLSCert != "" && !strings.HasPrefix(ep.Host, "ssh://") {
+		opts = append(opts, dockerclient.WithTLSClientConfig(ep.TLSCACert, ep.TLSCert, ep.TLSKey))
+	}
+
+	client, err := dockerclient.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client for %s: %w", ep.Name, err)
+	}
+	return &DockerManager{client: client, endpoint: ep.Name}, nil
+}
+
+// Get returns the manager for the named endpoint, creating it on first use.
+// An empty name selects the default endpoint.
+func (r *Registry) Get(name string) (*DockerManager, error) {
+	if name == "" {
+		name = r.defaultName
+	}
+
+	r.mu.RLock()
+	dm, ok := r.managers[name]
+	ep, known := r.endpoints[name]
+	r.mu.RUnlock()
+	if ok {
+		return dm, nil
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown Docker endpoint %q", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if dm, ok := r.managers[name]; ok {
+		return dm, nil
+	}
+	dm, err := NewDockerManagerForEndpoint(ep)
+	if err != nil {
+		return nil, err
+	}
+	r.managers[name] = dm
+	return dm, nil
+}
+
+// Names returns the endpoint names, default first.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.endpoints))
+	for name := range r.endpoints {
+		if name != r.defaultName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if r.defaultName != "" {
+		names = append([]string{r.defaultName}, names...)
+	}
+	return names
+}
+
+// CheckHealth pings every endpoint concurrently and records its status.
+func (r *Registry) CheckHealth() []EndpointStatus {
+	names := r.Names()
+	results := make([]EndpointStatus, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = r.checkEndpoint(name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	for _, status := range results {
+		r.status[status.Name] = status
+	}
+	r.mu.Unlock()
+	return results
+}
+
+// Status returns the last recorded health of every endpoint.
+func (r *Registry) Status() []EndpointStatus {
+	names := r.Names()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []EndpointStatus
+	for _, name := range names {
+		status, ok := r.status[name]
+		if !ok {
+			status = EndpointStatus{Endpoint: r.endpoints[name]}
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+func (r *Registry) checkEndpoint(name string) EndpointStatus {
+	r.mu.RLock()
+	status := EndpointStatus{Endpoint: r.endpoints[name], LastChecked: time.Now()}
+	r.mu.RUnlock()
+
+	dm, err := r.Get(name)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	version, err := dm.client.ServerVersion(ctx)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Connected = true
+	status.ServerVersion = version.Version
+	return status
+}
+
+// Available reports whether the named endpoint answered the last health
+// check, pinging it if it has never been checked.
+func (r *Registry) Available(name string) bool {
+	if name == "" {
+		name = r.defaultName
+	}
+	r.mu.RLock()
+	status, ok := r.status[name]
+	r.mu.RUnlock()
+	if ok {
+		return status.Connected
+	}
+
+	status = r.checkEndpoint(name)
+	r.mu.Lock()
+	r.status[name] = status
+	r.mu.Unlock()
+	return status.Connected
+}
+
+// ListAllContainers lists containers on every reachable endpoint concurrently.
+func (r *Registry) ListAllContainers() []EndpointContainers {
+	names := r.Names()
+	results := make([]EndpointContainers, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = EndpointContainers{Endpoint: name}
+			if !r.Available(name) {
+				results[i].Error = "endpoint is not reachable"
+				return
+			}
+			dm, err := r.Get(name)
+			if err == nil {
+				results[i].Containers, err = dm.ListContainers()
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+			for j := range results[i].Containers {
+				results[i].Containers[j].Endpoint = name
+			}
+		}(i, name)
+	}
+	wg.Wait()
+	return results
+}
+
+// MonitorHealth refreshes endpoint health every interval until ctx is done.
+func (r *Registry) MonitorHealth(ctx context.Context, interval time.Duration) {
+	r.CheckHealth()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.CheckHealth()
+		}
+	}
+}
+
+// WatchEvents runs DockerManager.WatchEvents for every endpoint.
+func (r *Registry) WatchEvents(ctx context.Context, handler EventHandler) {
+	for _, name := range r.Names() {
+		dm, err := r.Get(name)
+		if err != nil {
+			logrus.Warnf("Not watching Docker endpoint %s: %v", name, err)
+			continue
+		}
+		go dm.WatchEvents(ctx, handler)
+	}
+}
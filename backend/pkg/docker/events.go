@@ -0,0 +1,200 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	minEventBackoff = 1 * time.Second
+	maxEventBackoff = 30 * time.Second
+)
+
+// Event is a typed Docker event forwarded to the UI.
+type Event struct {
+	Endpoint   string            `json:"endpoint"`
+	Type       string            `json:"type"` // container, image, network, volume
+	Action     string            `json:"action"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Time       time.Time         `json:"time"`
+	Container  *ContainerInfo    `json:"container,omitempty"`
+}
+
+// EventHandler receives every event produced by WatchEvents.
+type EventHandler func(event Event)
+
+// WatchEvents subscribes to the Docker events API until ctx is cancelled.
+// The container cache is resynced on every (re)connection, and the
+// subscription is retried with exponential backoff when the daemon goes away.
+func (dm *DockerManager) WatchEvents(ctx context.Context, handler EventHandler) {
+	backoff := minEventBackoff
+
+	for {
+		err := dm.watchOnce(ctx, handler, func() { backoff = minEventBackoff })
+		if ctx.Err() != nil {
+			return
+		}
+
+		dm.invalidateCache()
+		logrus.Warnf("Docker events stream for %s interrupted: %v (retrying in %s)", dm.endpoint, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxEventBackoff {
+			backoff = maxEventBackoff
+		}
+	}
+}
+
+func (dm *DockerManager) watchOnce(ctx context.Context, handler EventHandler, connected func()) error {
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("type", string(events.ImageEventType)),
+		filters.Arg("type", string(events.NetworkEventType)),
+		filters.Arg("type", string(events.VolumeEventType)),
+	)
+
+	// Subscribe before resyncing so no event is lost in between
+	messages, errs := dm.client.Events(watchCtx, events.ListOptions{Filters: args})
+
+	if err := dm.refreshCache(); err != nil {
+		return err
+	}
+	connected()
+	logrus.Infof("Docker events watcher connected to %s", dm.endpoint)
+
+	for {
+		select {
+		case msg := <-messages:
+			event := dm.handleEventMessage(msg)
+			if handler != nil {
+				handler(event)
+			}
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+func (dm *DockerManager) handleEventMessage(msg events.Message) Event {
+	event := Event{
+		Endpoint:   dm.endpoint,
+		Type:       string(msg.Type),
+		Action:     string(msg.Action),
+		ID:         msg.Actor.ID,
+		Name:       msg.Actor.Attributes["name"],
+		Attributes: msg.Actor.Attributes,
+		Time:       time.Unix(0, msg.TimeNano),
+	}
+
+	if msg.Type != events.ContainerEventType {
+		return event
+	}
+
+	// exec_* and health_status carry a suffix after the action name
+	action := strings.SplitN(event.Action, ":", 2)[0]
+	switch events.Action(action) {
+	case events.ActionDestroy:
+		dm.cacheMu.Lock()
+		delete(dm.cache, msg.Actor.ID)
+		dm.cacheMu.Unlock()
+	case events.ActionExecCreate, events.ActionExecStart, events.ActionExecDie, events.ActionExecDetach,
+		events.ActionAttach, events.ActionDetach, events.ActionResize, events.ActionTop,
+		events.ActionArchivePath, events.ActionExtractToDir, events.ActionCopy, events.ActionExport:
+		// These do not change the container summary
+	default:
+		if info, err := dm.fetchContainer(msg.Actor.ID); err == nil {
+			dm.cacheMu.Lock()
+			if dm.cache != nil {
+				dm.cache[msg.Actor.ID] = *info
+			}
+			dm.cacheMu.Unlock()
+			event.Container = info
+		} else {
+			logrus.Debugf("Failed to refresh container %s after %s event: %v", msg.Actor.ID, event.Action, err)
+		}
+	}
+
+	return event
+}
+
+// refreshCache replaces the container cache with a fresh listing.
+func (dm *DockerManager) refreshCache() error {
+	containers, err := dm.fetchContainers()
+	if err != nil {
+		return err
+	}
+
+	dm.cacheMu.Lock()
+	dm.cache = containers
+	dm.cacheMu.Unlock()
+	return nil
+}
+
+// invalidateCache drops the cache so lists go back to the daemon while the
+// events stream is down.
+func (dm *DockerManager) invalidateCache() {
+	dm.cacheMu.Lock()
+	dm.cache = nil
+	dm.cacheMu.Unlock()
+}
+
+// cachedContainers returns the cached containers sorted by creation time
+// (newest first), or false when the cache is not populated.
+func (dm *DockerManager) cachedContainers() ([]ContainerInfo, bool) {
+	dm.cacheMu.RLock()
+	defer dm.cacheMu.RUnlock()
+
+	if dm.cache == nil {
+		return nil, false
+	}
+
+	return sortedContainers(dm.cache), true
+}
+
+// sortedContainers flattens a container map, newest first.
+func sortedContainers(containers map[string]ContainerInfo) []ContainerInfo {
+	result := make([]ContainerInfo, 0, len(containers))
+	for _, info := range containers {
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created.After(result[j].Created)
+	})
+	return result
+}
+
+func (dm *DockerManager) fetchContainer(id string) (*ContainerInfo, error) {
+	containers, err := dm.client.ContainerList(context.Background(), containerTypes.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("id", id)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range containers {
+		if c.ID == id {
+			info := toContainerInfo(c)
+			return &info, nil
+		}
+	}
+	return nil, fmt.Errorf("container %s not found", id)
+}
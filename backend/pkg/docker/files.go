@@ -0,0 +1,380 @@
+package docker
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/sirupsen/logrus"
+)
+
+type FileEntry struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"`
+	IsDir      bool      `json:"is_dir"`
+	IsLink     bool      `json:"is_link"`
+	LinkTarget string    `json:"link_target,omitempty"`
+	ModTime    time.Time `json:"mod_time"`
+}
+
+type FileChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"` // modified, added, deleted
+}
+
+// listConcurrency bounds the stat requests made to list a directory.
+const listConcurrency = 8
+
+// ListDirectory lists the direct children of dir inside a container. Names
+// come from ls run in the container and each child is then stat'ed, so only
+// one level is read. Stopped containers and images without ls fall back to
+// the tar archive of dir, which the daemon always builds for the whole
+// subtree.
+func (dm *DockerManager) ListDirectory(ref, dir string) ([]FileEntry, error) {
+	id, err := dm.ResolveContainer(ref)
+	if err != nil {
+		return nil, err
+	}
+	dir = cleanContainerPath(dir)
+
+	ctx := context.Background()
+	stat, err := dm.client.ContainerStatPath(ctx, id, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", dir, err)
+	}
+	if !stat.Mode.IsDir() {
+		return []FileEntry{fileEntryFromStat(dir, stat)}, nil
+	}
+
+	var entries []FileEntry
+	names, err := dm.listChildNames(ctx, id, dir)
+	if err == nil {
+		entries = dm.statChildren(ctx, id, dir, names)
+	} else {
+		logrus.Debugf("Listing %s in container %s from its archive: %v", dir, shortID(id), err)
+		if entries, err = dm.listDirectoryArchive(ctx, id, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// listChildNames runs ls in the container to get the names in dir.
+func (dm *DockerManager) listChildNames(ctx context.Context, id, dir string) ([]string, error) {
+	exec, err := dm.client.ContainerExecCreate(ctx, id, containerTypes.ExecOptions{
+		Cmd:          []string{"ls", "-1A", "--", dir},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := dm.client.ContainerExecAttach(ctx, exec.ID, containerTypes.ExecAttachOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, resp.Reader); err != nil {
+		return nil, err
+	}
+	result, err := dm.client.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("ls exited with %d: %s", result.ExitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	var names []string
+	for _, name := range strings.Split(stdout.String(), "\n") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// statChildren stats the named children of dir concurrently. Children
+// removed in the meantime are left out.
+func (dm *DockerManager) statChildren(ctx context.Context, id, dir string, names []string) []FileEntry {
+	found := make([]*FileEntry, len(names))
+	sem := make(chan struct{}, listConcurrency)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, name string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			p := path.Join(dir, name)
+			stat, err := dm.client.ContainerStatPath(ctx, id, p)
+			if err != nil {
+				return
+			}
+			entry := fileEntryFromStat(p, stat)
+			entry.Name = name
+			found[i] = &entry
+		}(i, name)
+	}
+	wg.Wait()
+
+	entries := make([]FileEntry, 0, len(names))
+	for _, entry := range found {
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries
+}
+
+// listDirectoryArchive lists dir from its tar archive, reading it header by
+// header without buffering file contents.
+func (dm *DockerManager) listDirectoryArchive(ctx context.Context, id, dir string) ([]FileEntry, error) {
+	reader, _, err := dm.client.CopyFromContainer(ctx, id, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	defer reader.Close()
+
+	// Entries are prefixed with the directory's base name
+	var entries []FileEntry
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive of %s: %w", dir, err)
+		}
+
+		name := strings.Trim(strings.TrimPrefix(header.Name, "./"), "/")
+		if dir != "/" {
+			// Drop the archive root; "/" is archived without one
+			_, name, _ = strings.Cut(name, "/")
+		}
+		if name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		info := header.FileInfo()
+		entries = append(entries, FileEntry{
+			Name:       name,
+			Path:       path.Join(dir, name),
+			Size:       header.Size,
+			Mode:       info.Mode().String(),
+			IsDir:      info.IsDir(),
+			IsLink:     header.Typeflag == tar.TypeSymlink,
+			LinkTarget: header.Linkname,
+			ModTime:    header.ModTime,
+		})
+	}
+	return entries, nil
+}
+
+// StatPath returns the entry for a single path inside a container.
+func (dm *DockerManager) StatPath(ref, p string) (*FileEntry, error) {
+	id, err := dm.ResolveContainer(ref)
+	if err != nil {
+		return nil, err
+	}
+	p = cleanContainerPath(p)
+	stat, err := dm.client.ContainerStatPath(context.Background(), id, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", p, err)
+	}
+	entry := fileEntryFromStat(p, stat)
+	return &entry, nil
+}
+
+// DownloadPath writes a file or directory from a container to w, either as
+// the tar archive produced by the daemon or converted to a zip archive.
+func (dm *DockerManager) DownloadPath(ref, p, format string, w io.Writer) error {
+	id, err := dm.ResolveContainer(ref)
+	if err != nil {
+		return err
+	}
+	if format != "tar" && format != "zip" {
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+
+	reader, _, err := dm.client.CopyFromContainer(context.Background(), id, cleanContainerPath(p))
+	if err != nil {
+		return fmt.Errorf("failed to copy %s from container: %w", p, err)
+	}
+	defer reader.Close()
+
+	if format == "tar" {
+		_, err = io.Copy(w, reader)
+		return err
+	}
+	return tarToZip(reader, w)
+}
+
+// UploadFile writes content to dst inside a container, creating or
+// replacing a single regular file.
+func (dm *DockerManager) UploadFile(ref, dst string, content io.Reader, size int64, mode os.FileMode) error {
+	id, err := dm.ResolveContainer(ref)
+	if err != nil {
+		return err
+	}
+	dst = cleanContainerPath(dst)
+	if dst == "/" {
+		return fmt.Errorf("destination must be a file path")
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+
+	// The archive is written while the daemon reads it; size is known, so
+	// the header can precede the content
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(&tar.Header{
+			Name:    path.Base(dst),
+			Mode:    int64(mode.Perm()),
+			Size:    size,
+			ModTime: time.Now(),
+		})
+		if err == nil {
+			if _, err = io.CopyN(tw, content, size); err != nil {
+				err = fmt.Errorf("failed to read upload: %w", err)
+			}
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	// Unblocks the writer when the daemon stops reading early
+	defer pr.Close()
+
+	err = dm.client.CopyToContainer(context.Background(), id, path.Dir(dst), pr, containerTypes.CopyToContainerOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to copy %s into container: %w", dst, err)
+	}
+	return nil
+}
+
+// UploadArchive extracts a tar archive into dir inside a container.
+func (dm *DockerManager) UploadArchive(ref, dir string, archive io.Reader) error {
+	id, err := dm.ResolveContainer(ref)
+	if err != nil {
+		return err
+	}
+	err = dm.client.CopyToContainer(context.Background(), id, cleanContainerPath(dir), archive, containerTypes.CopyToContainerOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to extract archive into %s: %w", dir, err)
+	}
+	return nil
+}
+
+// DiffContainer lists the changes made to the container filesystem
+// relative to its image.
+func (dm *DockerManager) DiffContainer(ref string) ([]FileChange, error) {
+	id, err := dm.ResolveContainer(ref)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := dm.client.ContainerDiff(context.Background(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff container %s: %w", ref, err)
+	}
+
+	result := make([]FileChange, 0, len(changes))
+	for _, change := range changes {
+		kind := "modified"
+		switch change.Kind {
+		case containerTypes.ChangeAdd:
+			kind = "added"
+		case containerTypes.ChangeDelete:
+			kind = "deleted"
+		}
+		result = append(result, FileChange{Path: change.Path, Kind: kind})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+func tarToZip(r io.Reader, w io.Writer) error {
+	tr := tar.NewReader(r)
+	zw := zip.NewWriter(w)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir, tar.TypeReg:
+		default:
+			// zip has no portable representation for links and devices
+			continue
+		}
+
+		fh, err := zip.FileInfoHeader(header.FileInfo())
+		if err != nil {
+			return err
+		}
+		fh.Name = header.Name
+		if header.Typeflag == tar.TypeDir {
+			fh.Name = strings.TrimSuffix(fh.Name, "/") + "/"
+		} else {
+			fh.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(fh)
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(fw, tr); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+func fileEntryFromStat(p string, stat containerTypes.PathStat) FileEntry {
+	return FileEntry{
+		Name:       stat.Name,
+		Path:       p,
+		Size:       stat.Size,
+		Mode:       stat.Mode.String(),
+		IsDir:      stat.Mode.IsDir(),
+		IsLink:     stat.Mode&os.ModeSymlink != 0,
+		LinkTarget: stat.LinkTarget,
+		ModTime:    stat.Mtime,
+	}
+}
+
+func cleanContainerPath(p string) string {
+	return path.Clean("/" + p)
+}
@@ -0,0 +1,232 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	imageTypes "github.com/docker/docker/api/types/image"
+	dockerclient "github.com/docker/docker/client"
+)
+
+// ImageDetails is the inspect view of an image.
+type ImageDetails struct {
+	ImageInfo
+	RepoDigests   []string          `json:"repo_digests"`
+	Parent        string            `json:"parent,omitempty"`
+	Author        string            `json:"author,omitempty"`
+	Comment       string            `json:"comment,omitempty"`
+	Architecture  string            `json:"architecture"`
+	Variant       string            `json:"variant,omitempty"`
+	Os            string            `json:"os"`
+	ExposedPorts  []string          `json:"exposed_ports"`
+	Env           []EnvVar          `json:"env"`
+	Entrypoint    []string          `json:"entrypoint"`
+	Cmd           []string          `json:"cmd"`
+	WorkingDir    string            `json:"working_dir"`
+	User          string            `json:"user"`
+	Volumes       []string          `json:"volumes"`
+	Labels        map[string]string `json:"labels"`
+	Layers        []ImageLayer      `json:"layers"`
+	RootFSLayers  []string          `json:"rootfs_layers"`
+	UsedBy        []ContainerInfo   `json:"used_by"`
+	LastTagTime   *time.Time        `json:"last_tag_time,omitempty"`
+	DockerVersion string            `json:"docker_version,omitempty"`
+}
+
+// ImageLayer is one entry of the image history, newest first.
+type ImageLayer struct {
+	ID         string    `json:"id"`
+	Created    time.Time `json:"created"`
+	CreatedBy  string    `json:"created_by"`
+	Size       int64     `json:"size"`
+	Comment    string    `json:"comment,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	EmptyLayer bool      `json:"empty_layer"` // metadata-only step (ENV, CMD, ...)
+}
+
+// InspectImage returns the configuration, layer history and consumers of
+// an image referenced by ID, short ID or name. Values of secret-looking
+// environment variables are masked unless showSecrets is set.
+func (dm *DockerManager) InspectImage(ref string, showSecrets bool) (*ImageDetails, error) {
+	ctx := context.Background()
+	inspect, err := dm.client.ImageInspect(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect image %s: %w", ref, err)
+	}
+
+	history, err := dm.client.ImageHistory(ctx, inspect.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history of image %s: %w", ref, err)
+	}
+
+	created, _ := time.Parse(time.RFC3339Nano, inspect.Created)
+	details := &ImageDetails{
+		ImageInfo: ImageInfo{
+			ID:       inspect.ID,
+			ShortID:  shortImageID(inspect.ID),
+			RepoTags: inspect.RepoTags,
+			Size:     inspect.Size,
+			Created:  created,
+			Dangling: isDangling(inspect.RepoTags),
+		},
+		RepoDigests:   inspect.RepoDigests,
+		Parent:        inspect.Parent,
+		Author:        inspect.Author,
+		Comment:       inspect.Comment,
+		Architecture:  inspect.Architecture,
+		Variant:       inspect.Variant,
+		Os:            inspect.Os,
+		RootFSLayers:  inspect.RootFS.Layers,
+		DockerVersion: inspect.DockerVersion,
+	}
+	if !inspect.Metadata.LastTagTime.IsZero() {
+		details.LastTagTime = &inspect.Metadata.LastTagTime
+	}
+
+	if cfg := inspect.Config; cfg != nil {
+		for port := range cfg.ExposedPorts {
+			details.ExposedPorts = append(details.ExposedPorts, port)
+		}
+		sort.Strings(details.ExposedPorts)
+		for volume := range cfg.Volumes {
+			details.Volumes = append(details.Volumes, volume)
+		}
+		sort.Strings(details.Volumes)
+		details.Env = parseEnv(cfg.Env, showSecrets)
+		details.Entrypoint = cfg.Entrypoint
+		details.Cmd = cfg.Cmd
+		details.WorkingDir = cfg.WorkingDir
+		details.User = cfg.User
+		details.Labels = cfg.Labels
+	}
+
+	for _, item := range history {
+		layer := ImageLayer{
+			Created:    time.Unix(item.Created, 0),
+			CreatedBy:  item.CreatedBy,
+			Size:       item.Size,
+			Comment:    item.Comment,
+			Tags:       item.Tags,
+			EmptyLayer: item.Size == 0,
+		}
+		// Intermediate layers of pulled images report "<missing>"
+		if item.ID != "<missing>" {
+			layer.ID = item.ID
+		}
+		details.Layers = append(details.Layers, layer)
+	}
+
+	containers, err := dm.fetchContainers()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range sortedContainers(containers) {
+		if c.ImageID == inspect.ID {
+			details.UsedBy = append(details.UsedBy, c)
+		}
+	}
+	details.Containers = len(details.UsedBy)
+
+	return details, nil
+}
+
+// TagImage adds target as a new reference to the source image.
+func (dm *DockerManager) TagImage(source, target string) error {
+	if err := dm.client.ImageTag(context.Background(), source, target); err != nil {
+		return fmt.Errorf("failed to tag %s as %s: %w", source, target, err)
+	}
+	return nil
+}
+
+// UntagImage removes a single repository:tag reference. The image itself is
+// only deleted by the daemon when that was its last reference.
+func (dm *DockerManager) UntagImage(reference string) ([]string, error) {
+	if strings.HasPrefix(reference, "sha256:") {
+		return nil, fmt.Errorf("%s is an image ID, not a tag", reference)
+	}
+	return dm.RemoveImage(reference, false, false)
+}
+
+// RemoveImage deletes an image and returns the untagged and deleted
+// references reported by the daemon.
+func (dm *DockerManager) RemoveImage(ref string, force, pruneChildren bool) ([]string, error) {
+	responses, err := dm.client.ImageRemove(context.Background(), ref, imageTypes.RemoveOptions{
+		Force:         force,
+		PruneChildren: pruneChildren,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove image %s: %w", ref, err)
+	}
+
+	var result []string
+	for _, r := range responses {
+		if r.Untagged != "" {
+			result = append(result, "untagged: "+r.Untagged)
+		}
+		if r.Deleted != "" {
+			result = append(result, "deleted: "+r.Deleted)
+		}
+	}
+	return result, nil
+}
+
+// SaveImages writes the given images as a docker-archive tar to w.
+func (dm *DockerManager) SaveImages(refs []string, w io.Writer) error {
+	if len(refs) == 0 {
+		return fmt.Errorf("no image to save")
+	}
+	reader, err := dm.client.ImageSave(context.Background(), refs)
+	if err != nil {
+		return fmt.Errorf("failed to save images: %w", err)
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(w, reader); err != nil {
+		return fmt.Errorf("failed to write image archive: %w", err)
+	}
+	return nil
+}
+
+// LoadImages imports a docker-archive tar and returns the daemon's
+// "Loaded image" messages.
+func (dm *DockerManager) LoadImages(archive io.Reader) ([]string, error) {
+	resp, err := dm.client.ImageLoad(context.Background(), archive, dockerclient.ImageLoadWithQuiet(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load images: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var loaded []string
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		if err := decoder.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return loaded, fmt.Errorf("failed to read load response: %w", err)
+		}
+		if msg.Error != "" {
+			return loaded, fmt.Errorf("failed to load images: %s", msg.Error)
+		}
+		if line := strings.TrimSpace(msg.Stream); line != "" {
+			loaded = append(loaded, line)
+		}
+	}
+	return loaded, nil
+}
+
+// shortImageID strips the digest algorithm and truncates to 12 characters.
+func shortImageID(id string) string {
+	if _, hex, ok := strings.Cut(id, ":"); ok {
+		id = hex
+	}
+	return shortID(id)
+}
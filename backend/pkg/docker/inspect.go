@@ -0,0 +1,313 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	containerTypes "github.com/docker/docker/api/types/container"
+)
+
+const maskedValue = "********"
+
+// secretEnvPattern matches environment variable names whose values are
+// masked in inspect output. Words must stand between underscores, so
+// DB_PWD is masked but the shell's PWD and OLDPWD are not.
+var secretEnvPattern = regexp.MustCompile(`(?i)((^|_)(pass(word|wd)?|secrets?|tokens?|api_?key|private_?key|access_?key|credentials?|auth)|_pwd)(_|$)`)
+
+type ContainerDetails struct {
+	ContainerInfo
+	Entrypoint    []string       `json:"entrypoint"`
+	Cmd           []string       `json:"cmd"`
+	WorkingDir    string         `json:"working_dir"`
+	User          string         `json:"user"`
+	Hostname      string         `json:"hostname"`
+	Env           []EnvVar       `json:"env"`
+	Mounts        []MountInfo    `json:"mounts"`
+	Networks      []NetworkInfo  `json:"networks"`
+	RestartPolicy RestartPolicy  `json:"restart_policy"`
+	RestartCount  int            `json:"restart_count"`
+	Health        *HealthInfo    `json:"health,omitempty"`
+	Resources     ResourceLimits `json:"resources"`
+	Privileged    bool           `json:"privileged"`
+	Platform      string         `json:"platform"`
+	Driver        string         `json:"driver"`
+	SizeRw        int64          `json:"size_rw"`
+	SizeRootFs    int64          `json:"size_root_fs"`
+	StartedAt     string         `json:"started_at"`
+	FinishedAt    string         `json:"finished_at"`
+	ExitCode      int            `json:"exit_code"`
+	OOMKilled     bool           `json:"oom_killed"`
+	Error         string         `json:"error,omitempty"`
+}
+
+type EnvVar struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Masked bool   `json:"masked"`
+}
+
+type MountInfo struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Mode        string `json:"mode"`
+	RW          bool   `json:"rw"`
+}
+
+type NetworkInfo struct {
+	Name        string   `json:"name"`
+	NetworkID   string   `json:"network_id"`
+	IPAddress   string   `json:"ip_address"`
+	IPv6Address string   `json:"ipv6_address,omitempty"`
+	Gateway     string   `json:"gateway"`
+	MacAddress  string   `json:"mac_address"`
+	Aliases     []string `json:"aliases,omitempty"`
+}
+
+type RestartPolicy struct {
+	Name              string `json:"name"`
+	MaximumRetryCount int    `json:"maximum_retry_count"`
+}
+
+type HealthInfo struct {
+	Status        string        `json:"status"`
+	FailingStreak int           `json:"failing_streak"`
+	Log           []HealthProbe `json:"log"`
+}
+
+type HealthProbe struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	ExitCode int       `json:"exit_code"`
+	Output   string    `json:"output"`
+}
+
+type ResourceLimits struct {
+	NanoCPUs          int64  `json:"nano_cpus"`
+	CPUShares         int64  `json:"cpu_shares"`
+	CPUQuota          int64  `json:"cpu_quota"`
+	CPUPeriod         int64  `json:"cpu_period"`
+	CpusetCpus        string `json:"cpuset_cpus,omitempty"`
+	Memory            int64  `json:"memory"`
+	MemoryReservation int64  `json:"memory_reservation"`
+	MemorySwap        int64  `json:"memory_swap"`
+	PidsLimit         int64  `json:"pids_limit"`
+}
+
+// ResolveContainer returns the full ID of the container referenced by a full
+// ID, a unique ID prefix or a name (with or without the leading slash).
+func (dm *DockerManager) ResolveContainer(ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return "", fmt.Errorf("empty container reference")
+	}
+
+	containers, ok := dm.cachedContainers()
+	if !ok {
+		all, err := dm.fetchContainers()
+		if err != nil {
+			return "", err
+		}
+		containers = sortedContainers(all)
+	}
+
+	name := strings.TrimPrefix(ref, "/")
+	var matches []string
+	for _, c := range containers {
+		if c.FullID == ref || c.Name == name {
+			return c.FullID, nil
+		}
+		if strings.HasPrefix(c.FullID, ref) {
+			matches = append(matches, c.FullID)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", cerrdefs.ErrNotFound.WithMessage(fmt.Sprintf("container %s not found", ref))
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("container reference %s is ambiguous (%d matches)", ref, len(matches))
+	}
+}
+
+// InspectContainer returns the detailed view of a container. Values of
+// secret-looking environment variables are masked unless showSecrets is set.
+func (dm *DockerManager) InspectContainer(ref string, showSecrets bool) (*ContainerDetails, error) {
+	id, err := dm.ResolveContainer(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	inspect, _, err := dm.client.ContainerInspectWithRaw(context.Background(), id, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %w", ref, err)
+	}
+
+	return toContainerDetails(inspect, showSecrets), nil
+}
+
+func toContainerDetails(inspect containerTypes.InspectResponse, showSecrets bool) *ContainerDetails {
+	details := &ContainerDetails{}
+	if inspect.ContainerJSONBase != nil {
+		base := inspect.ContainerJSONBase
+		created, _ := time.Parse(time.RFC3339Nano, base.Created)
+		details.ContainerInfo = ContainerInfo{
+			ID:      shortID(base.ID),
+			FullID:  base.ID,
+			Name:    strings.TrimPrefix(base.Name, "/"),
+			ImageID: base.Image,
+			Created: created,
+		}
+		details.RestartCount = base.RestartCount
+		details.Platform = base.Platform
+		details.Driver = base.Driver
+		if base.SizeRw != nil {
+			details.SizeRw = *base.SizeRw
+		}
+		if base.SizeRootFs != nil {
+			details.SizeRootFs = *base.SizeRootFs
+		}
+		if state := base.State; state != nil {
+			details.State = string(state.Status)
+			details.Status = string(state.Status)
+			details.StartedAt = state.StartedAt
+			details.FinishedAt = state.FinishedAt
+			details.ExitCode = state.ExitCode
+			details.OOMKilled = state.OOMKilled
+			details.Error = state.Error
+			if state.Health != nil {
+				details.Health = toHealthInfo(state.Health)
+			}
+		}
+		if hc := base.HostConfig; hc != nil {
+			details.RestartPolicy = RestartPolicy{
+				Name:              string(hc.RestartPolicy.Name),
+				MaximumRetryCount: hc.RestartPolicy.MaximumRetryCount,
+			}
+			details.Privileged = hc.Privileged
+			details.Resources = ResourceLimits{
+				NanoCPUs:          hc.NanoCPUs,
+				CPUShares:         hc.CPUShares,
+				CPUQuota:          hc.CPUQuota,
+				CPUPeriod:         hc.CPUPeriod,
+				CpusetCpus:        hc.CpusetCpus,
+				Memory:            hc.Memory,
+				MemoryReservation: hc.MemoryReservation,
+				MemorySwap:        hc.MemorySwap,
+			}
+			if hc.PidsLimit != nil {
+				details.Resources.PidsLimit = *hc.PidsLimit
+			}
+		}
+	}
+
+	if cfg := inspect.Config; cfg != nil {
+		details.Image = cfg.Image
+		details.Labels = cfg.Labels
+		details.Entrypoint = cfg.Entrypoint
+		details.Cmd = cfg.Cmd
+		details.Command = strings.Join(append(append([]string{}, cfg.Entrypoint...), cfg.Cmd...), " ")
+		details.WorkingDir = cfg.WorkingDir
+		details.User = cfg.User
+		details.Hostname = cfg.Hostname
+		details.Env = parseEnv(cfg.Env, showSecrets)
+	}
+
+	for _, m := range inspect.Mounts {
+		details.Mounts = append(details.Mounts, MountInfo{
+			Type:        string(m.Type),
+			Name:        m.Name,
+			Source:      m.Source,
+			Destination: m.Destination,
+			Mode:        m.Mode,
+			RW:          m.RW,
+		})
+	}
+
+	if ns := inspect.NetworkSettings; ns != nil {
+		for port, bindings := range ns.Ports {
+			for _, binding := range bindings {
+				details.Ports = append(details.Ports, PortInfo{
+					PrivatePort: port.Int(),
+					PublicPort:  parsePort(binding.HostPort),
+					Type:        port.Proto(),
+				})
+			}
+		}
+		for name, endpoint := range ns.Networks {
+			if endpoint == nil {
+				continue
+			}
+			details.Networks = append(details.Networks, NetworkInfo{
+				Name:        name,
+				NetworkID:   endpoint.NetworkID,
+				IPAddress:   endpoint.IPAddress,
+				IPv6Address: endpoint.GlobalIPv6Address,
+				Gateway:     endpoint.Gateway,
+				MacAddress:  endpoint.MacAddress,
+				Aliases:     endpoint.Aliases,
+			})
+			details.NetworkNames = append(details.NetworkNames, name)
+		}
+		sort.Slice(details.Networks, func(i, j int) bool {
+			return details.Networks[i].Name < details.Networks[j].Name
+		})
+		sort.Strings(details.NetworkNames)
+	}
+
+	return details
+}
+
+func toHealthInfo(health *containerTypes.Health) *HealthInfo {
+	info := &HealthInfo{
+		Status:        health.Status,
+		FailingStreak: health.FailingStreak,
+	}
+	for _, result := range health.Log {
+		if result == nil {
+			continue
+		}
+		info.Log = append(info.Log, HealthProbe{
+			Start:    result.Start,
+			End:      result.End,
+			ExitCode: result.ExitCode,
+			Output:   result.Output,
+		})
+	}
+	return info
+}
+
+func parseEnv(env []string, showSecrets bool) []EnvVar {
+	result := make([]EnvVar, 0, len(env))
+	for _, entry := range env {
+		name, value, _ := strings.Cut(entry, "=")
+		v := EnvVar{Name: name, Value: value}
+		if !showSecrets && value != "" && secretEnvPattern.MatchString(name) {
+			v.Value = maskedValue
+			v.Masked = true
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+func parsePort(port string) int {
+	var p int
+	fmt.Sscanf(port, "%d", &p)
+	return p
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,176 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/distribution/reference"
+	imageTypes "github.com/docker/docker/api/types/image"
+	registryTypes "github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/sirupsen/logrus"
+)
+
+// RegistryAuth holds the credentials sent to the daemon for a push.
+type RegistryAuth struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identity_token,omitempty"`
+}
+
+// PushProgress is one progress update of a push, per layer when ID is set.
+type PushProgress struct {
+	Image   string `json:"image"`
+	ID      string `json:"id,omitempty"`
+	Status  string `json:"status"`
+	Current int64  `json:"current,omitempty"`
+	Total   int64  `json:"total,omitempty"`
+}
+
+type PushResult struct {
+	Image  string `json:"image"`
+	Tag    string `json:"tag"`
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// ImageReference is a parsed, normalized image reference.
+type ImageReference struct {
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// String returns the reference in its canonical form.
+func (r ImageReference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// ParseImageReference normalizes ref the way the docker CLI does, so
+// "nginx" becomes docker.io/library/nginx:latest.
+func ParseImageReference(ref string) (ImageReference, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ImageReference{}, fmt.Errorf("invalid image reference %s: %w", ref, err)
+	}
+
+	result := ImageReference{
+		Registry:   reference.Domain(named),
+		Repository: reference.Path(named),
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		result.Digest = digested.Digest().String()
+	}
+	if tagged, ok := named.(reference.Tagged); ok {
+		result.Tag = tagged.Tag()
+	} else if result.Digest == "" {
+		result.Tag = "latest"
+	}
+	return result, nil
+}
+
+// TagForRegistry tags source for pushing to registryHost. Repository and tag
+// default to those of the source image and the new reference is returned.
+func (dm *DockerManager) TagForRegistry(source, registryHost, repository, tag string) (string, error) {
+	src, err := ParseImageReference(source)
+	if err != nil {
+		return "", err
+	}
+	if repository == "" {
+		// Images from Docker Hub lose their implicit library/ prefix
+		repository = strings.TrimPrefix(src.Repository, "library/")
+	}
+	if tag == "" {
+		tag = src.Tag
+	}
+	if tag == "" {
+		tag = "latest"
+	}
+
+	target := strings.TrimSuffix(registryHost, "/") + "/" + repository + ":" + tag
+	if _, err := reference.ParseNormalizedNamed(target); err != nil {
+		return "", fmt.Errorf("invalid target reference %s: %w", target, err)
+	}
+	if err := dm.TagImage(source, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// PushImage pushes ref to its registry, reporting daemon progress to
+// progress as it arrives. The returned result carries the pushed digest.
+func (dm *DockerManager) PushImage(ref string, auth *RegistryAuth, progress func(PushProgress)) (*PushResult, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference %s: %w", ref, err)
+	}
+	named = reference.TagNameOnly(named)
+
+	opts := imageTypes.PushOptions{}
+	// The daemon rejects pushes without an auth header, even anonymous ones
+	authConfig := registryTypes.AuthConfig{ServerAddress: reference.Domain(named)}
+	if auth != nil {
+		authConfig.Username = auth.Username
+		authConfig.Password = auth.Password
+		authConfig.IdentityToken = auth.IdentityToken
+	}
+	if opts.RegistryAuth, err = registryTypes.EncodeAuthConfig(authConfig); err != nil {
+		return nil, fmt.Errorf("failed to encode registry credentials: %w", err)
+	}
+
+	reader, err := dm.client.ImagePush(context.Background(), reference.FamiliarString(named), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to push image %s: %w", ref, err)
+	}
+	defer reader.Close()
+
+	result := &PushResult{Image: reference.FamiliarString(named)}
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := decoder.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read push response: %w", err)
+		}
+		if msg.Error != nil {
+			return nil, fmt.Errorf("failed to push image %s: %s", ref, msg.Error.Message)
+		}
+
+		// The final auxiliary message reports what was pushed
+		if msg.Aux != nil {
+			var aux struct {
+				Tag    string `json:"Tag"`
+				Digest string `json:"Digest"`
+				Size   int64  `json:"Size"`
+			}
+			if err := json.Unmarshal(*msg.Aux, &aux); err == nil {
+				result.Tag, result.Digest, result.Size = aux.Tag, aux.Digest, aux.Size
+			}
+			continue
+		}
+
+		if progress != nil {
+			update := PushProgress{Image: result.Image, ID: msg.ID, Status: msg.Status}
+			if msg.Progress != nil {
+				update.Current = msg.Progress.Current
+				update.Total = msg.Progress.Total
+			}
+			progress(update)
+		}
+	}
+
+	logrus.Infof("Successfully pushed image: %s (%s)", result.Image, result.Digest)
+	return result, nil
+}
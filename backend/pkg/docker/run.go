@@ -0,0 +1,501 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	containerTypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	networkTypes "github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/sirupsen/logrus"
+)
+
+// ContainerSpec is the declarative description of a container to run.
+type ContainerSpec struct {
+	Image         string            `json:"image"`
+	Name          string            `json:"name"`
+	Command       []string          `json:"command"`
+	Entrypoint    []string          `json:"entrypoint"`
+	Env           map[string]string `json:"env"`
+	Ports         []PortMapping     `json:"ports"`
+	Volumes       []VolumeMount     `json:"volumes"`
+	Network       string            `json:"network"`
+	RestartPolicy RestartPolicy     `json:"restart_policy"`
+	Resources     ResourceLimits    `json:"resources"`
+	Labels        map[string]string `json:"labels"`
+	WorkingDir    string            `json:"working_dir"`
+	User          string            `json:"user"`
+	CreateOnly    bool              `json:"create_only"` // create without starting
+}
+
+type PortMapping struct {
+	ContainerPort int    `json:"container_port"`
+	HostPort      int    `json:"host_port"` // 0 picks a random host port
+	HostIP        string `json:"host_ip"`
+	Protocol      string `json:"protocol"` // tcp (default), udp, sctp
+}
+
+type VolumeMount struct {
+	Type     string `json:"type"` // bind, volume (default) or tmpfs
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// RunContainer creates a container from spec, pulling the image first if it
+// is not present locally, and starts it unless spec.CreateOnly is set.
+func (dm *DockerManager) RunContainer(spec ContainerSpec) (*ContainerInfo, error) {
+	config, hostConfig, networkingConfig, err := spec.toConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	id, err := dm.createContainer(ctx, config, hostConfig, networkingConfig, spec.Name, !spec.CreateOnly)
+	if err != nil {
+		// Do not leave behind a container that was created but not started
+		if id != "" {
+			if removeErr := dm.client.ContainerRemove(ctx, id, containerTypes.RemoveOptions{Force: true}); removeErr != nil {
+				logrus.Warnf("Failed to remove container %s after a failed start: %v", shortID(id), removeErr)
+			}
+		}
+		return nil, err
+	}
+	return dm.fetchContainer(id)
+}
+
+// createContainer creates a container, pulling its image if needed, and
+// optionally starts it. The ID of the created container is returned even
+// when starting it fails, so the caller can clean up exactly that one.
+func (dm *DockerManager) createContainer(ctx context.Context, config *containerTypes.Config, hostConfig *containerTypes.HostConfig, networkingConfig *networkTypes.NetworkingConfig, name string, start bool) (string, error) {
+	if err := dm.ensureImage(config.Image); err != nil {
+		return "", err
+	}
+
+	created, err := dm.client.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create container: %w", err)
+	}
+	for _, warning := range created.Warnings {
+		logrus.Warnf("Container %s: %s", shortID(created.ID), warning)
+	}
+
+	if start {
+		if err := dm.client.ContainerStart(ctx, created.ID, containerTypes.StartOptions{}); err != nil {
+			return created.ID, fmt.Errorf("container %s created but failed to start: %w", shortID(created.ID), err)
+		}
+	}
+	return created.ID, nil
+}
+
+// RecreateContainer replaces an existing container with a copy of its
+// configuration with the non-empty fields of changes applied. The old
+// container is kept (renamed) until the new one is running, and restored if
+// the replacement fails.
+func (dm *DockerManager) RecreateContainer(ref string, changes ContainerSpec) (*ContainerInfo, error) {
+	id, err := dm.ResolveContainer(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	inspect, err := dm.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %w", ref, err)
+	}
+	if inspect.ContainerJSONBase == nil || inspect.Config == nil || inspect.HostConfig == nil {
+		return nil, fmt.Errorf("incomplete inspect data for container %s", ref)
+	}
+
+	config, hostConfig, networkingConfig := cloneContainerConfig(inspect)
+	if changes.Image != "" && changes.Image != config.Image {
+		dm.dropImageDefaults(ctx, inspect.Image, config)
+	}
+	if err := changes.applyTo(config, hostConfig, &networkingConfig); err != nil {
+		return nil, err
+	}
+
+	originalName := strings.TrimPrefix(inspect.Name, "/")
+	name := originalName
+	if changes.Name != "" {
+		name = changes.Name
+	}
+	wasRunning := inspect.State != nil && inspect.State.Running
+	start := !changes.CreateOnly && wasRunning
+
+	backupName := fmt.Sprintf("%s-old-%d", originalName, time.Now().Unix())
+	if wasRunning {
+		if err := dm.StopContainer(id); err != nil {
+			return nil, err
+		}
+	}
+	if err := dm.client.ContainerRename(ctx, id, backupName); err != nil {
+		if wasRunning {
+			dm.StartContainer(id)
+		}
+		return nil, fmt.Errorf("failed to rename container %s: %w", ref, err)
+	}
+
+	newID, err := dm.createContainer(ctx, config, hostConfig, networkingConfig, name, start)
+	if err != nil {
+		logrus.Warnf("Recreating %s failed, restoring original container: %v", name, err)
+		// Only the container created here is removed; the name may belong to
+		// another container when creation failed on a conflict
+		if newID != "" {
+			dm.client.ContainerRemove(ctx, newID, containerTypes.RemoveOptions{Force: true})
+		}
+		if renameErr := dm.client.ContainerRename(ctx, id, originalName); renameErr != nil {
+			return nil, fmt.Errorf("failed to recreate container: %w (and failed to restore original: %v)", err, renameErr)
+		}
+		if wasRunning {
+			dm.StartContainer(id)
+		}
+		return nil, fmt.Errorf("failed to recreate container: %w", err)
+	}
+
+	if err := dm.RemoveContainer(id); err != nil {
+		logrus.Warnf("Recreated %s but failed to remove previous container: %v", name, err)
+	}
+	return dm.fetchContainer(newID)
+}
+
+// ensureImage pulls image unless it is already present locally.
+func (dm *DockerManager) ensureImage(image string) error {
+	_, err := dm.client.ImageInspect(context.Background(), image)
+	if err == nil {
+		return nil
+	}
+	if !cerrdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+	return dm.PullImage(image)
+}
+
+func (spec ContainerSpec) toConfig() (*containerTypes.Config, *containerTypes.HostConfig, *networkTypes.NetworkingConfig, error) {
+	if spec.Image == "" {
+		return nil, nil, nil, fmt.Errorf("image is required")
+	}
+
+	config := &containerTypes.Config{
+		Image:        spec.Image,
+		Cmd:          spec.Command,
+		Entrypoint:   spec.Entrypoint,
+		Labels:       spec.Labels,
+		WorkingDir:   spec.WorkingDir,
+		User:         spec.User,
+		ExposedPorts: nat.PortSet{},
+	}
+
+	envNames := make([]string, 0, len(spec.Env))
+	for name := range spec.Env {
+		envNames = append(envNames, name)
+	}
+	sort.Strings(envNames)
+	for _, name := range envNames {
+		config.Env = append(config.Env, name+"="+spec.Env[name])
+	}
+
+	hostConfig := &containerTypes.HostConfig{
+		PortBindings: nat.PortMap{},
+		RestartPolicy: containerTypes.RestartPolicy{
+			Name:              containerTypes.RestartPolicyMode(spec.RestartPolicy.Name),
+			MaximumRetryCount: spec.RestartPolicy.MaximumRetryCount,
+		},
+		Resources: containerTypes.Resources{
+			NanoCPUs:          spec.Resources.NanoCPUs,
+			CPUShares:         spec.Resources.CPUShares,
+			CPUQuota:          spec.Resources.CPUQuota,
+			CPUPeriod:         spec.Resources.CPUPeriod,
+			CpusetCpus:        spec.Resources.CpusetCpus,
+			Memory:            spec.Resources.Memory,
+			MemoryReservation: spec.Resources.MemoryReservation,
+			MemorySwap:        spec.Resources.MemorySwap,
+		},
+	}
+	if err := containerTypes.ValidateRestartPolicy(hostConfig.RestartPolicy); err != nil {
+		return nil, nil, nil, err
+	}
+	if spec.Resources.PidsLimit != 0 {
+		pids := spec.Resources.PidsLimit
+		hostConfig.PidsLimit = &pids
+	}
+
+	if err := addPorts(config, hostConfig, spec.Ports); err != nil {
+		return nil, nil, nil, err
+	}
+	mounts, err := toMounts(spec.Volumes)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hostConfig.Mounts = mounts
+
+	var networkingConfig *networkTypes.NetworkingConfig
+	if spec.Network != "" {
+		hostConfig.NetworkMode = containerTypes.NetworkMode(spec.Network)
+		networkingConfig = &networkTypes.NetworkingConfig{
+			EndpointsConfig: map[string]*networkTypes.EndpointSettings{spec.Network: {}},
+		}
+	}
+
+	return config, hostConfig, networkingConfig, nil
+}
+
+func addPorts(config *containerTypes.Config, hostConfig *containerTypes.HostConfig, ports []PortMapping) error {
+	for _, p := range ports {
+		protocol := p.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		port, err := nat.NewPort(protocol, strconv.Itoa(p.ContainerPort))
+		if err != nil {
+			return fmt.Errorf("invalid port %d/%s: %w", p.ContainerPort, protocol, err)
+		}
+		config.ExposedPorts[port] = struct{}{}
+
+		hostPort := ""
+		if p.HostPort > 0 {
+			hostPort = strconv.Itoa(p.HostPort)
+		}
+		hostConfig.PortBindings[port] = append(hostConfig.PortBindings[port], nat.PortBinding{
+			HostIP:   p.HostIP,
+			HostPort: hostPort,
+		})
+	}
+	return nil
+}
+
+func toMounts(volumes []VolumeMount) ([]mount.Mount, error) {
+	var mounts []mount.Mount
+	for _, v := range volumes {
+		if v.Target == "" {
+			return nil, fmt.Errorf("volume target is required")
+		}
+		mountType := mount.TypeVolume
+		switch v.Type {
+		case "", "volume":
+		case "bind":
+			mountType = mount.TypeBind
+		case "tmpfs":
+			mountType = mount.TypeTmpfs
+		default:
+			return nil, fmt.Errorf("unsupported volume type %q", v.Type)
+		}
+		mounts = append(mounts, mount.Mount{
+			Type:     mountType,
+			Source:   v.Source,
+			Target:   v.Target,
+			ReadOnly: v.ReadOnly,
+		})
+	}
+	return mounts, nil
+}
+
+// cloneContainerConfig copies the configuration an existing container was
+// created with, so a replacement keeps every setting, including those
+// ContainerSpec does not describe (capabilities, devices, healthcheck, DNS,
+// ...). Values the daemon filled in for the old container are left out.
+func cloneContainerConfig(inspect containerTypes.InspectResponse) (*containerTypes.Config, *containerTypes.HostConfig, *networkTypes.NetworkingConfig) {
+	config := *inspect.Config
+	config.Env = append([]string(nil), config.Env...)
+	config.Labels = make(map[string]string, len(inspect.Config.Labels))
+	for k, v := range inspect.Config.Labels {
+		config.Labels[k] = v
+	}
+	config.ExposedPorts = nat.PortSet{}
+	for port := range inspect.Config.ExposedPorts {
+		config.ExposedPorts[port] = struct{}{}
+	}
+	// The daemon sets the hostname to the short ID unless one was given
+	if config.Hostname == shortID(inspect.ID) {
+		config.Hostname = ""
+	}
+
+	hostConfig := *inspect.HostConfig
+	hostConfig.PortBindings = nat.PortMap{}
+	for port, bindings := range inspect.HostConfig.PortBindings {
+		hostConfig.PortBindings[port] = append([]nat.PortBinding(nil), bindings...)
+	}
+	hostConfig.Mounts = append([]mount.Mount(nil), inspect.HostConfig.Mounts...)
+	// Anonymous volumes are not in the host config; mount them by name so
+	// their data is kept
+	declared := make(map[string]bool)
+	for _, bind := range hostConfig.Binds {
+		if parts := strings.Split(bind, ":"); len(parts) > 1 {
+			declared[parts[1]] = true
+		}
+	}
+	for _, m := range hostConfig.Mounts {
+		declared[m.Target] = true
+	}
+	for _, m := range inspect.Mounts {
+		if m.Type == mount.TypeVolume && !declared[m.Destination] {
+			hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+				Type:     mount.TypeVolume,
+				Source:   m.Name,
+				Target:   m.Destination,
+				ReadOnly: !m.RW,
+			})
+		}
+	}
+
+	var networkingConfig *networkTypes.NetworkingConfig
+	if inspect.NetworkSettings != nil && len(inspect.NetworkSettings.Networks) > 0 {
+		networkingConfig = &networkTypes.NetworkingConfig{EndpointsConfig: map[string]*networkTypes.EndpointSettings{}}
+		for name, endpoint := range inspect.NetworkSettings.Networks {
+			if endpoint == nil {
+				continue
+			}
+			var aliases []string
+			for _, alias := range endpoint.Aliases {
+				if alias != shortID(inspect.ID) {
+					aliases = append(aliases, alias)
+				}
+			}
+			networkingConfig.EndpointsConfig[name] = &networkTypes.EndpointSettings{
+				IPAMConfig: endpoint.IPAMConfig,
+				Links:      endpoint.Links,
+				Aliases:    aliases,
+				DriverOpts: endpoint.DriverOpts,
+			}
+		}
+	}
+	return &config, &hostConfig, networkingConfig
+}
+
+// dropImageDefaults removes the env entries and labels a container got from
+// its old image, so they do not override those of a new image.
+func (dm *DockerManager) dropImageDefaults(ctx context.Context, imageID string, config *containerTypes.Config) {
+	image, err := dm.client.ImageInspect(ctx, imageID)
+	if err != nil || image.Config == nil {
+		return
+	}
+	inherited := make(map[string]bool, len(image.Config.Env))
+	for _, entry := range image.Config.Env {
+		inherited[entry] = true
+	}
+	env := config.Env[:0]
+	for _, entry := range config.Env {
+		if !inherited[entry] {
+			env = append(env, entry)
+		}
+	}
+	config.Env = env
+	for k, v := range image.Config.Labels {
+		if config.Labels[k] == v {
+			delete(config.Labels, k)
+		}
+	}
+}
+
+// applyTo applies the non-empty fields of changes on top of a cloned
+// configuration. Env and labels are merged key by key; an empty value
+// removes the key. Ports and volumes replace the existing ones.
+func (changes ContainerSpec) applyTo(config *containerTypes.Config, hostConfig *containerTypes.HostConfig, networkingConfig **networkTypes.NetworkingConfig) error {
+	if changes.Image != "" {
+		config.Image = changes.Image
+	}
+	if changes.Command != nil {
+		config.Cmd = changes.Command
+	}
+	if changes.Entrypoint != nil {
+		config.Entrypoint = changes.Entrypoint
+	}
+	if changes.WorkingDir != "" {
+		config.WorkingDir = changes.WorkingDir
+	}
+	if changes.User != "" {
+		config.User = changes.User
+	}
+
+	env := make(map[string]string)
+	var names []string
+	for _, entry := range config.Env {
+		name, value, _ := strings.Cut(entry, "=")
+		if _, seen := env[name]; !seen {
+			names = append(names, name)
+		}
+		env[name] = value
+	}
+	for name := range changes.Env {
+		if _, seen := env[name]; !seen {
+			names = append(names, name)
+		}
+	}
+	config.Env = nil
+	for _, name := range names {
+		value, changed := changes.Env[name]
+		if !changed {
+			value = env[name]
+		} else if value == "" {
+			continue
+		}
+		config.Env = append(config.Env, name+"="+value)
+	}
+	for k, v := range changes.Labels {
+		if v == "" {
+			delete(config.Labels, k)
+		} else {
+			config.Labels[k] = v
+		}
+	}
+
+	if changes.Ports != nil {
+		// Ports exposed by the image are merged back in by the daemon
+		config.ExposedPorts = nat.PortSet{}
+		hostConfig.PortBindings = nat.PortMap{}
+		if err := addPorts(config, hostConfig, changes.Ports); err != nil {
+			return err
+		}
+	}
+	if changes.Volumes != nil {
+		mounts, err := toMounts(changes.Volumes)
+		if err != nil {
+			return err
+		}
+		hostConfig.Binds = nil
+		hostConfig.Mounts = mounts
+	}
+	if changes.Network != "" {
+		hostConfig.NetworkMode = containerTypes.NetworkMode(changes.Network)
+		*networkingConfig = &networkTypes.NetworkingConfig{
+			EndpointsConfig: map[string]*networkTypes.EndpointSettings{changes.Network: {}},
+		}
+	}
+	if changes.RestartPolicy.Name != "" {
+		hostConfig.RestartPolicy = containerTypes.RestartPolicy{
+			Name:              containerTypes.RestartPolicyMode(changes.RestartPolicy.Name),
+			MaximumRetryCount: changes.RestartPolicy.MaximumRetryCount,
+		}
+		if err := containerTypes.ValidateRestartPolicy(hostConfig.RestartPolicy); err != nil {
+			return err
+		}
+	}
+	// Only the limits that are set change; the others are kept
+	r := changes.Resources
+	setIfNonZero(&hostConfig.NanoCPUs, r.NanoCPUs)
+	setIfNonZero(&hostConfig.CPUShares, r.CPUShares)
+	setIfNonZero(&hostConfig.CPUQuota, r.CPUQuota)
+	setIfNonZero(&hostConfig.CPUPeriod, r.CPUPeriod)
+	setIfNonZero(&hostConfig.CpusetCpus, r.CpusetCpus)
+	setIfNonZero(&hostConfig.Memory, r.Memory)
+	setIfNonZero(&hostConfig.MemoryReservation, r.MemoryReservation)
+	setIfNonZero(&hostConfig.MemorySwap, r.MemorySwap)
+	if r.PidsLimit != 0 {
+		pids := r.PidsLimit
+		hostConfig.PidsLimit = &pids
+	}
+	return nil
+}
+
+func setIfNonZero[T comparable](field *T, value T) {
+	var zero T
+	if value != zero {
+		*field = value
+	}
+}
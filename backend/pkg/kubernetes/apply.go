@@ -0,0 +1,167 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// DefaultFieldManager owns the fields set by applies from the IDE.
+const DefaultFieldManager = "devops-unity"
+
+// Apply outcomes reported per object
+const (
+	ApplyCreated    = "created"
+	ApplyConfigured = "configured"
+	ApplyUnchanged  = "unchanged"
+	ApplyError      = "error"
+)
+
+type ApplyOptions struct {
+	Namespace    string `json:"namespace"`     // default for namespaced objects without one
+	FieldManager string `json:"field_manager"` // defaults to DefaultFieldManager
+	DryRun       bool   `json:"dry_run"`       // server-side dry run
+	Force        bool   `json:"force"`         // take over fields owned by other managers
+}
+
+type ApplyResult struct {
+	APIVersion string `json:"api_version"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace,omitempty"`
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ApplyManifest server-side applies every object of a multi-document
+// manifest. Objects are applied independently, so one failure does not stop
+// the others; only an unparsable manifest returns an error.
+func (km *K8sManager) ApplyManifest(manifest string, opts ApplyOptions) ([]ApplyResult, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	if opts.FieldManager == "" {
+		opts.FieldManager = DefaultFieldManager
+	}
+
+	objects, err := decodeManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	sortForApply(objects)
+
+	results := make([]ApplyResult, 0, len(objects))
+	for _, obj := range objects {
+		result := km.applyObject(obj, opts)
+		if result.Error != "" {
+			logrus.Warnf("Failed to apply %s: %s", objectRef(obj.GroupVersionKind(), obj.GetName()), result.Error)
+		} else {
+			logrus.Infof("Applied %s: %s", objectRef(obj.GroupVersionKind(), obj.GetName()), result.Result)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (km *K8sManager) applyObject(obj *unstructured.Unstructured, opts ApplyOptions) ApplyResult {
+	result := ApplyResult{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Name:       obj.GetName(),
+		Result:     ApplyError,
+	}
+	client, live, err := km.prepareApply(obj, opts)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Namespace = obj.GetNamespace()
+
+	applied, err := client.Apply(context.TODO(), obj.GetName(), obj, opts.applyOptions(opts.DryRun))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	switch {
+	case live == nil:
+		result.Result = ApplyCreated
+	case reflect.DeepEqual(sanitizeObject(live), sanitizeObject(applied)):
+		result.Result = ApplyUnchanged
+	default:
+		result.Result = ApplyConfigured
+	}
+	return result
+}
+
+// prepareApply resolves the resource of an object to apply, setting its
+// namespace, and fetches the live object, nil when it does not exist yet.
+func (km *K8sManager) prepareApply(obj *unstructured.Unstructured, opts ApplyOptions) (dynamic.ResourceInterface, *unstructured.Unstructured, error) {
+	if obj.GetName() == "" {
+		// Server-side apply needs a name to identify the object
+		return nil, nil, fmt.Errorf("metadata.name is required")
+	}
+	client, _, err := km.resourceFor(obj, opts.Namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	live, err := client.Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return client, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, live, nil
+}
+
+func (opts ApplyOptions) applyOptions(dryRun bool) metav1.ApplyOptions {
+	applyOpts := metav1.ApplyOptions{FieldManager: opts.FieldManager, Force: opts.Force}
+	if dryRun {
+		applyOpts.DryRun = []string{metav1.DryRunAll}
+	}
+	return applyOpts
+}
+
+// sanitizeObject returns a copy of obj without server-maintained metadata
+// and status, suitable for comparing and diffing desired state.
+func sanitizeObject(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	clean := obj.DeepCopy()
+	unstructured.RemoveNestedField(clean.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(clean.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(clean.Object, "metadata", "generation")
+	unstructured.RemoveNestedField(clean.Object, "metadata", "uid")
+	unstructured.RemoveNestedField(clean.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(clean.Object, "status")
+	return clean
+}
+
+// applyOrder puts the kinds other objects depend on first.
+var applyOrder = map[string]int{
+	"Namespace":                0,
+	"CustomResourceDefinition": 1,
+	"ServiceAccount":           2,
+	"ClusterRole":              2,
+	"Role":                     2,
+	"ConfigMap":                3,
+	"Secret":                   3,
+	"PersistentVolumeClaim":    3,
+}
+
+func sortForApply(objects []*unstructured.Unstructured) {
+	rank := func(obj *unstructured.Unstructured) int {
+		if r, ok := applyOrder[obj.GetKind()]; ok {
+			return r
+		}
+		return len(applyOrder)
+	}
+	sort.SliceStable(objects, func(i, j int) bool { return rank(objects[i]) < rank(objects[j]) })
+}
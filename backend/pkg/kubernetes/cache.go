@@ -0,0 +1,294 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// cacheResync replays every cached object to the handlers periodically;
+// replays with an unchanged resourceVersion are not published.
+const cacheResync = 10 * time.Minute
+
+// Watch event types
+const (
+	WatchAdded    = "added"
+	WatchModified = "modified"
+	WatchDeleted  = "deleted"
+)
+
+// ResourceEvent is a change to a cached object. Object holds the matching
+// Info struct (PodInfo, DeploymentInfo, ...).
+type ResourceEvent struct {
+	Context   string      `json:"context,omitempty"` // kubeconfig context of the cluster
+	Type      string      `json:"type"`
+	Kind      string      `json:"kind"` // pods, deployments, services, nodes, events, namespaces
+	Namespace string      `json:"namespace,omitempty"`
+	Name      string      `json:"name"`
+	Object    interface{} `json:"object"`
+}
+
+type ResourceEventHandler func(ResourceEvent)
+
+// resourceCache holds the shared informers backing the List methods.
+type resourceCache struct {
+	factory informers.SharedInformerFactory
+	synced  atomic.Bool
+
+	pods        corelisters.PodLister
+	services    corelisters.ServiceLister
+	nodes       corelisters.NodeLister
+	events      corelisters.EventLister
+	namespaces  corelisters.NamespaceLister
+	deployments appslisters.DeploymentLister
+}
+
+// StartCache starts shared informers for pods, deployments, services,
+// nodes, events and namespaces and calls handler for every change once the
+// initial listing has synced. Reflectors relist and rewatch on their own
+// after connection losses; List methods use the API until the cache syncs.
+func (km *K8sManager) StartCache(ctx context.Context, handler ResourceEventHandler) error {
+	if !km.connected {
+		return fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	if km.cache != nil {
+		return fmt.Errorf("cache already started")
+	}
+
+	factory := informers.NewSharedInformerFactory(km.clientset, cacheResync)
+	rc := &resourceCache{
+		factory:     factory,
+		pods:        factory.Core().V1().Pods().Lister(),
+		services:    factory.Core().V1().Services().Lister(),
+		nodes:       factory.Core().V1().Nodes().Lister(),
+		events:      factory.Core().V1().Events().Lister(),
+		namespaces:  factory.Core().V1().Namespaces().Lister(),
+		deployments: factory.Apps().V1().Deployments().Lister(),
+	}
+
+	watched := map[string]cache.SharedIndexInformer{
+		"pods":        factory.Core().V1().Pods().Informer(),
+		"services":    factory.Core().V1().Services().Informer(),
+		"nodes":       factory.Core().V1().Nodes().Informer(),
+		"events":      factory.Core().V1().Events().Informer(),
+		"namespaces":  factory.Core().V1().Namespaces().Informer(),
+		"deployments": factory.Apps().V1().Deployments().Informer(),
+	}
+	for kind, informer := range watched {
+		kind := kind
+		informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+			logrus.Warnf("Kubernetes %s watch interrupted, retrying: %v", kind, err)
+			km.invalidateHealth()
+		})
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if rc.synced.Load() {
+					publishResourceEvent(handler, km.context, WatchAdded, kind, obj)
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldMeta, err1 := metaAccessor(oldObj)
+				newMeta, err2 := metaAccessor(newObj)
+				if err1 == nil && err2 == nil && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+					return // resync
+				}
+				publishResourceEvent(handler, km.context, WatchModified, kind, newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				publishResourceEvent(handler, km.context, WatchDeleted, kind, obj)
+			},
+		})
+	}
+
+	km.cache = rc
+	factory.Start(ctx.Done())
+	go func() {
+		for informerType, ok := range factory.WaitForCacheSync(ctx.Done()) {
+			if !ok {
+				logrus.Warnf("Kubernetes cache for %v did not sync", informerType)
+				return
+			}
+		}
+		rc.synced.Store(true)
+		logrus.Info("Kubernetes resource cache synced")
+	}()
+	return nil
+}
+
+// cacheReady reports whether List calls can be served from the cache.
+func (km *K8sManager) cacheReady() bool {
+	return km.cache != nil && km.cache.synced.Load()
+}
+
+func publishResourceEvent(handler ResourceEventHandler, contextName, eventType, kind string, obj interface{}) {
+	if handler == nil {
+		return
+	}
+	event := ResourceEvent{Context: contextName, Type: eventType, Kind: kind}
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		event.Object = toPodInfo(o)
+	case *corev1.Service:
+		event.Object = toServiceInfo(o)
+	case *corev1.Node:
+		event.Object = toNodeInfo(o)
+	case *corev1.Event:
+		event.Object = toEventInfo(o)
+	case *corev1.Namespace:
+		event.Object = toNamespaceInfo(o)
+	case *appsv1.Deployment:
+		event.Object = toDeploymentInfo(o)
+	default:
+		return
+	}
+	if m, err := metaAccessor(obj); err == nil {
+		event.Namespace = m.GetNamespace()
+		event.Name = m.GetName()
+	}
+	handler(event)
+}
+
+func metaAccessor(obj interface{}) (metav1.Object, error) {
+	m, ok := obj.(metav1.Object)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T", obj)
+	}
+	return m, nil
+}
+
+// The list helpers below read from the cache once synced and from the API
+// server otherwise. An empty namespace means all namespaces.
+
+func (km *K8sManager) listPods(namespace string) ([]*corev1.Pod, error) {
+	if km.cacheReady() {
+		pods, err := km.cache.pods.Pods(namespace).List(labels.Everything())
+		sortByName(pods)
+		return pods, err
+	}
+	list, err := km.clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return pointers(list.Items), nil
+}
+
+func (km *K8sManager) listServices(namespace string) ([]*corev1.Service, error) {
+	if km.cacheReady() {
+		services, err := km.cache.services.Services(namespace).List(labels.Everything())
+		sortByName(services)
+		return services, err
+	}
+	list, err := km.clientset.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return pointers(list.Items), nil
+}
+
+func (km *K8sManager) listDeployments(namespace string) ([]*appsv1.Deployment, error) {
+	if km.cacheReady() {
+		deployments, err := km.cache.deployments.Deployments(namespace).List(labels.Everything())
+		sortByName(deployments)
+		return deployments, err
+	}
+	list, err := km.clientset.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return pointers(list.Items), nil
+}
+
+func (km *K8sManager) listNodes() ([]*corev1.Node, error) {
+	if km.cacheReady() {
+		nodes, err := km.cache.nodes.List(labels.Everything())
+		sortByName(nodes)
+		return nodes, err
+	}
+	list, err := km.clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return pointers(list.Items), nil
+}
+
+func (km *K8sManager) listNamespaces() ([]*corev1.Namespace, error) {
+	if km.cacheReady() {
+		namespaces, err := km.cache.namespaces.List(labels.Everything())
+		sortByName(namespaces)
+		return namespaces, err
+	}
+	list, err := km.clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return pointers(list.Items), nil
+}
+
+// listEvents filters events with selector on the involvedObject.* and type
+// fields, in memory when served from the cache.
+func (km *K8sManager) listEvents(namespace string, selector fields.Selector) ([]*corev1.Event, error) {
+	if km.cacheReady() {
+		events, err := km.cache.events.Events(namespace).List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		var result []*corev1.Event
+		for _, event := range events {
+			if selector.Matches(eventFields(event)) {
+				result = append(result, event)
+			}
+		}
+		return result, nil
+	}
+	list, err := km.clientset.CoreV1().Events(namespace).List(context.TODO(), metav1.ListOptions{FieldSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	return pointers(list.Items), nil
+}
+
+func eventFields(event *corev1.Event) fields.Set {
+	return fields.Set{
+		"involvedObject.kind":      event.InvolvedObject.Kind,
+		"involvedObject.name":      event.InvolvedObject.Name,
+		"involvedObject.namespace": event.InvolvedObject.Namespace,
+		"involvedObject.uid":       string(event.InvolvedObject.UID),
+		"reason":                   event.Reason,
+		"type":                     event.Type,
+	}
+}
+
+// pointers converts an API list to the pointer slice listers return.
+func pointers[T any](items []T) []*T {
+	result := make([]*T, len(items))
+	for i := range items {
+		result[i] = &items[i]
+	}
+	return result
+}
+
+// sortByName orders lister output, which comes in map order, like the API.
+func sortByName[T metav1.Object](items []T) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].GetNamespace() != items[j].GetNamespace() {
+			return items[i].GetNamespace() < items[j].GetNamespace()
+		}
+		return items[i].GetName() < items[j].GetName()
+	})
+}
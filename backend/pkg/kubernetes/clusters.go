@@ -0,0 +1,359 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// InClusterContext names the service account context available when the
+// server runs in a pod.
+const InClusterContext = "in-cluster"
+
+// ClusterContext describes a kubeconfig context the IDE can talk to.
+type ClusterContext struct {
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster"`
+	User      string `json:"user"`
+	Namespace string `json:"namespace,omitempty"` // context default namespace
+	Server    string `json:"server"`
+	Source    string `json:"source"` // kubeconfig file or in-cluster
+}
+
+type ClusterStatus struct {
+	ClusterContext
+	Default       bool      `json:"default"`
+	Connected     bool      `json:"connected"`
+	Error         string    `json:"error,omitempty"`
+	ServerVersion string    `json:"server_version,omitempty"`
+	LastChecked   time.Time `json:"last_checked"`
+}
+
+// ClusterRegistry keeps one lazily created K8sManager per kubeconfig
+// context.
+type ClusterRegistry struct {
+	mu             sync.RWMutex
+	raw            clientcmdapi.Config
+	kubeconfig     []string // merged files, in precedence order
+	inCluster      *rest.Config
+	contexts       map[string]ClusterContext
+	managers       map[string]*K8sManager
+	status         map[string]ClusterStatus
+	defaultContext string
+
+	// Set by StartCaches; managers created later start their cache too
+	cacheCtx     context.Context
+	cacheHandler ResourceEventHandler
+}
+
+// NewClusterRegistry merges the files of KUBECONFIG (or ~/.kube/config)
+// with extraPaths, like kubectl: the first file to set a value wins and
+// missing files are skipped. preferred selects the default context and
+// falls back to the kubeconfig current-context.
+func NewClusterRegistry(extraPaths []string, preferred string) (*ClusterRegistry, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	seen := make(map[string]bool)
+	for _, path := range rules.Precedence {
+		seen[filepath.Clean(path)] = true
+	}
+	for _, path := range extraPaths {
+		if path != "" && !seen[filepath.Clean(path)] {
+			seen[filepath.Clean(path)] = true
+			rules.Precedence = append(rules.Precedence, path)
+		}
+	}
+
+	raw, err := rules.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	r := &ClusterRegistry{
+		raw:        *raw,
+		kubeconfig: rules.Precedence,
+		contexts:   make(map[string]ClusterContext),
+		managers:   make(map[string]*K8sManager),
+		status:     make(map[string]ClusterStatus),
+	}
+	for name, kc := range raw.Contexts {
+		cc := ClusterContext{
+			Name:      name,
+			Cluster:   kc.Cluster,
+			User:      kc.AuthInfo,
+			Namespace: kc.Namespace,
+			Source:    kc.LocationOfOrigin,
+		}
+		if cluster, ok := raw.Clusters[kc.Cluster]; ok {
+			cc.Server = cluster.Server
+		}
+		r.contexts[name] = cc
+	}
+	if config, err := rest.InClusterConfig(); err == nil {
+		if _, exists := r.contexts[InClusterContext]; exists {
+			logrus.Warnf("Kubeconfig context %s shadows the in-cluster config", InClusterContext)
+		} else {
+			r.inCluster = config
+			r.contexts[InClusterContext] = ClusterContext{
+				Name:   InClusterContext,
+				Server: config.Host,
+				Source: InClusterContext,
+			}
+		}
+	}
+
+	switch {
+	case preferred != "" && r.has(preferred):
+		r.defaultContext = preferred
+	case raw.CurrentContext != "" && r.has(raw.CurrentContext):
+		if preferred != "" {
+			logrus.Warnf("Kubernetes context %s not found, using %s", preferred, raw.CurrentContext)
+		}
+		r.defaultContext = raw.CurrentContext
+	case r.inCluster != nil:
+		r.defaultContext = InClusterContext
+	default:
+		if names := r.Names(); len(names) > 0 {
+			r.defaultContext = names[0]
+		}
+	}
+	return r, nil
+}
+
+func (r *ClusterRegistry) has(name string) bool {
+	_, ok := r.contexts[name]
+	return ok
+}
+
+// Get returns the manager for the named context, creating it on first use.
+// An empty name selects the default context.
+func (r *ClusterRegistry) Get(name string) (*K8sManager, error) {
+	r.mu.RLock()
+	if name == "" {
+		name = r.defaultContext
+	}
+	km, ok := r.managers[name]
+	_, known := r.contexts[name]
+	r.mu.RUnlock()
+	if ok {
+		return km, nil
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no Kubernetes context configured")
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown Kubernetes context %q", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if km, ok := r.managers[name]; ok {
+		return km, nil
+	}
+
+	config, err := r.restConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	km, err = NewK8sManagerForConfig(name, config)
+	if err != nil {
+		return nil, err
+	}
+	if name != InClusterContext || r.inCluster == nil {
+		km.kubeconfig = r.kubeconfig
+	}
+	if r.cacheCtx != nil {
+		if err := km.StartCache(r.cacheCtx, r.cacheHandler); err != nil {
+			logrus.Warnf("Kubernetes cache for %s not started: %v", name, err)
+		}
+	}
+	r.managers[name] = km
+	return km, nil
+}
+
+// restConfig builds the client config of a context.
+func (r *ClusterRegistry) restConfig(name string) (*rest.Config, error) {
+	if name == InClusterContext && r.inCluster != nil {
+		return r.inCluster, nil
+	}
+	config, err := clientcmd.NewNonInteractiveClientConfig(r.raw, name, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Kubernetes context %s: %w", name, err)
+	}
+	return config, nil
+}
+
+// Default returns the name of the default context.
+func (r *ClusterRegistry) Default() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultContext
+}
+
+// SetDefault changes the context used by requests that do not name one.
+func (r *ClusterRegistry) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.contexts[name]; !ok {
+		return fmt.Errorf("unknown Kubernetes context %q", name)
+	}
+	r.defaultContext = name
+	logrus.Infof("Default Kubernetes context set to %s", name)
+	return nil
+}
+
+// Names returns the context names, sorted.
+func (r *ClusterRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.contexts))
+	for name := range r.contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckHealth asks every context for its server version concurrently and
+// records its status.
+func (r *ClusterRegistry) CheckHealth() []ClusterStatus {
+	names := r.Names()
+	results := make([]ClusterStatus, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = r.checkContext(name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	for _, status := range results {
+		r.status[status.Name] = status
+	}
+	r.mu.Unlock()
+	return r.Status()
+}
+
+// Status returns the last recorded health of every context.
+func (r *ClusterRegistry) Status() []ClusterStatus {
+	names := r.Names()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]ClusterStatus, 0, len(names))
+	for _, name := range names {
+		status, ok := r.status[name]
+		if !ok {
+			status = ClusterStatus{ClusterContext: r.contexts[name]}
+		}
+		status.Default = name == r.defaultContext
+		result = append(result, status)
+	}
+	return result
+}
+
+func (r *ClusterRegistry) checkContext(name string) ClusterStatus {
+	r.mu.RLock()
+	status := ClusterStatus{ClusterContext: r.contexts[name], LastChecked: time.Now()}
+	km := r.managers[name]
+	r.mu.RUnlock()
+
+	// Contexts nobody uses are probed with a throwaway client, so a health
+	// check neither keeps a manager nor starts its cache
+	var client rest.Interface
+	if km != nil && km.IsConnected() {
+		client = km.clientset.Discovery().RESTClient()
+	} else {
+		config, err := r.restConfig(name)
+		if err != nil {
+			status.Error = err.Error()
+			return status
+		}
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			status.Error = err.Error()
+			return status
+		}
+		client = clientset.Discovery().RESTClient()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	version, err := serverVersion(ctx, client)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Connected = true
+	status.ServerVersion = version
+	return status
+}
+
+// MonitorHealth refreshes the health of contexts that are in use every
+// interval until ctx is done. Contexts nobody asked for are not contacted.
+func (r *ClusterRegistry) MonitorHealth(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.mu.RLock()
+			var names []string
+			for name := range r.managers {
+				names = append(names, name)
+			}
+			r.mu.RUnlock()
+
+			for _, name := range names {
+				status := r.checkContext(name)
+				r.mu.Lock()
+				r.status[name] = status
+				r.mu.Unlock()
+			}
+		}
+	}
+}
+
+// StartCaches starts the resource cache of every manager, now and as they
+// are created, until ctx is done. Events carry the context name.
+func (r *ClusterRegistry) StartCaches(ctx context.Context, handler ResourceEventHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cacheCtx = ctx
+	r.cacheHandler = handler
+	for name, km := range r.managers {
+		if err := km.StartCache(ctx, handler); err != nil {
+			logrus.Warnf("Kubernetes cache for %s not started: %v", name, err)
+		}
+	}
+}
+
+// StopAllPortForwards closes the port-forwards of every context.
+func (r *ClusterRegistry) StopAllPortForwards() {
+	r.mu.RLock()
+	managers := make([]*K8sManager, 0, len(r.managers))
+	for _, km := range r.managers {
+		managers = append(managers, km)
+	}
+	r.mu.RUnlock()
+
+	for _, km := range managers {
+		km.StopAllPortForwards()
+	}
+}
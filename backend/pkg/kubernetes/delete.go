@@ -0,0 +1,164 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+// Deletion phases reported through DeleteProgress
+const (
+	DeletePhaseDeleting = "deleting"
+	DeletePhaseWaiting  = "waiting" // deletion accepted, finalizers pending
+	DeletePhaseDeleted  = "deleted" // object is gone, or accepted without wait
+	DeletePhaseDryRun   = "dry-run" // would be deleted
+	DeletePhaseTimeout  = "timeout" // still present when the wait expired
+	DeletePhaseError    = "error"
+)
+
+type DeleteOptions struct {
+	Namespace          string        `json:"namespace"` // empty for all namespaces with a selector
+	Name               string        `json:"name"`
+	LabelSelector      string        `json:"label_selector"` // bulk delete when Name is empty
+	Propagation        string        `json:"propagation"`    // Foreground, Background or Orphan
+	GracePeriodSeconds *int64        `json:"grace_period_seconds"`
+	DryRun             bool          `json:"dry_run"`
+	Wait               bool          `json:"wait"`    // wait until finalizers have run
+	Timeout            time.Duration `json:"timeout"` // wait limit, one minute by default
+}
+
+// DeleteProgress is one step of a deletion, also used as its final result.
+type DeleteProgress struct {
+	Resource   string   `json:"resource"`
+	Name       string   `json:"name"`
+	Namespace  string   `json:"namespace,omitempty"`
+	Phase      string   `json:"phase"`
+	Finalizers []string `json:"finalizers,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// DeleteResource deletes one object by name, or every object matching
+// LabelSelector, of any resource type known to the cluster including
+// CRDs. progress, when set, receives every step and the returned slice
+// holds the final state of each object.
+func (km *K8sManager) DeleteResource(resourceType string, opts DeleteOptions, progress func(DeleteProgress)) ([]DeleteProgress, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	if opts.Name == "" && opts.LabelSelector == "" {
+		return nil, apierrors.NewBadRequest("a name or a label selector is required")
+	}
+	if progress == nil {
+		progress = func(DeleteProgress) {}
+	}
+
+	mapping, err := km.resolveResource(resourceType)
+	if err != nil {
+		return nil, err
+	}
+	// Objects are deleted by name in one namespace
+	if opts.Namespace == "" && opts.Name != "" {
+		opts.Namespace = "default"
+	}
+	client := km.clientFor(mapping, opts.Namespace)
+
+	deleteOpts := metav1.DeleteOptions{GracePeriodSeconds: opts.GracePeriodSeconds}
+	if opts.Propagation != "" {
+		policy := metav1.DeletionPropagation(opts.Propagation)
+		switch policy {
+		case metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan:
+		default:
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid propagation policy %q", opts.Propagation))
+		}
+		deleteOpts.PropagationPolicy = &policy
+	}
+	if opts.DryRun {
+		deleteOpts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	targets := []DeleteProgress{{Resource: mapping.Resource.Resource, Name: opts.Name, Namespace: opts.Namespace}}
+	if opts.Name == "" {
+		list, err := client.List(context.TODO(), metav1.ListOptions{LabelSelector: opts.LabelSelector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", mapping.Resource.Resource, err)
+		}
+		targets = targets[:0]
+		for _, item := range list.Items {
+			targets = append(targets, DeleteProgress{Resource: mapping.Resource.Resource, Name: item.GetName(), Namespace: item.GetNamespace()})
+		}
+	}
+
+	for i := range targets {
+		target := &targets[i]
+		target.Phase = DeletePhaseDeleting
+		progress(*target)
+
+		err := km.clientFor(mapping, target.Namespace).Delete(context.TODO(), target.Name, deleteOpts)
+		switch {
+		case err != nil:
+			target.Phase = DeletePhaseError
+			target.Error = err.Error()
+		case opts.DryRun:
+			target.Phase = DeletePhaseDryRun
+		default:
+			target.Phase = DeletePhaseDeleted
+			logrus.Infof("Deleted %s/%s in namespace %s", target.Resource, target.Name, target.Namespace)
+		}
+		if target.Phase != DeletePhaseDeleted || !opts.Wait {
+			progress(*target)
+		}
+	}
+
+	if opts.Wait && !opts.DryRun {
+		timeout := opts.Timeout
+		if timeout <= 0 {
+			timeout = time.Minute
+		}
+		deadline := time.Now().Add(timeout)
+		for i := range targets {
+			if targets[i].Phase == DeletePhaseDeleted {
+				km.waitForDeletion(km.clientFor(mapping, targets[i].Namespace), &targets[i], deadline, progress)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// waitForDeletion polls until the object is gone or the deadline passes,
+// reporting the pending finalizers whenever they change.
+func (km *K8sManager) waitForDeletion(client dynamic.ResourceInterface, target *DeleteProgress, deadline time.Time, progress func(DeleteProgress)) {
+	var reported []string
+	for {
+		obj, err := client.Get(context.TODO(), target.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			target.Phase = DeletePhaseDeleted
+			target.Finalizers = nil
+			progress(*target)
+			return
+		}
+		if err != nil {
+			target.Phase = DeletePhaseError
+			target.Error = err.Error()
+			progress(*target)
+			return
+		}
+
+		target.Finalizers = obj.GetFinalizers()
+		if time.Now().After(deadline) {
+			target.Phase = DeletePhaseTimeout
+			progress(*target)
+			return
+		}
+		if target.Phase != DeletePhaseWaiting || fmt.Sprint(reported) != fmt.Sprint(target.Finalizers) {
+			target.Phase = DeletePhaseWaiting
+			reported = target.Finalizers
+			progress(*target)
+		}
+		time.Sleep(time.Second)
+	}
+}
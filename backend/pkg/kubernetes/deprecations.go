@@ -0,0 +1,98 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// apiDeprecation is a beta API version scheduled for removal, from the
+// Kubernetes deprecated API migration guide.
+type apiDeprecation struct {
+	groupVersion string
+	kinds        []string // all kinds of the group version when empty
+	deprecated   string   // minor release, e.g. 1.19
+	removed      string
+	replacement  string
+}
+
+var apiDeprecations = []apiDeprecation{
+	{"extensions/v1beta1", []string{"Deployment", "DaemonSet", "ReplicaSet"}, "1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", []string{"NetworkPolicy"}, "1.9", "1.16", "networking.k8s.io/v1"},
+	{"extensions/v1beta1", []string{"PodSecurityPolicy"}, "1.11", "1.16", "policy/v1beta1"},
+	{"apps/v1beta1", nil, "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", nil, "1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", []string{"Ingress"}, "1.14", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", []string{"Ingress", "IngressClass"}, "1.19", "1.22", "networking.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", nil, "1.16", "1.22", "apiextensions.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", nil, "1.16", "1.22", "admissionregistration.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", nil, "1.19", "1.22", "apiregistration.k8s.io/v1"},
+	{"authentication.k8s.io/v1beta1", nil, "1.19", "1.22", "authentication.k8s.io/v1"},
+	{"authorization.k8s.io/v1beta1", nil, "1.19", "1.22", "authorization.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", nil, "1.19", "1.22", "certificates.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", nil, "1.19", "1.22", "coordination.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", nil, "1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", nil, "1.14", "1.22", "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", []string{"CSIDriver", "CSINode", "StorageClass", "VolumeAttachment"}, "1.19", "1.22", "storage.k8s.io/v1"},
+	{"batch/v1beta1", []string{"CronJob"}, "1.21", "1.25", "batch/v1"},
+	{"discovery.k8s.io/v1beta1", nil, "1.21", "1.25", "discovery.k8s.io/v1"},
+	{"events.k8s.io/v1beta1", nil, "1.21", "1.25", "events.k8s.io/v1"},
+	{"autoscaling/v2beta1", nil, "1.22", "1.25", "autoscaling/v2"},
+	{"policy/v1beta1", []string{"PodDisruptionBudget"}, "1.21", "1.25", "policy/v1"},
+	{"policy/v1beta1", []string{"PodSecurityPolicy"}, "1.21", "1.25", "Pod Security Admission"},
+	{"node.k8s.io/v1beta1", nil, "1.20", "1.25", "node.k8s.io/v1"},
+	{"autoscaling/v2beta2", nil, "1.23", "1.26", "autoscaling/v2"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", nil, "1.23", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", []string{"CSIStorageCapacity"}, "1.24", "1.27", "storage.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", nil, "1.26", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", nil, "1.29", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+}
+
+// findDeprecation returns the deprecation of an API version and kind, if
+// any.
+func findDeprecation(apiVersion, kind string) *apiDeprecation {
+	for i := range apiDeprecations {
+		d := &apiDeprecations[i]
+		if d.groupVersion != apiVersion {
+			continue
+		}
+		if len(d.kinds) == 0 {
+			return d
+		}
+		for _, k := range d.kinds {
+			if k == kind {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// check rates the API against a server version: an error once removed, a
+// warning once deprecated or when the version is unknown.
+func (d *apiDeprecation) check(apiVersion, kind, serverVersion string) (severity, message string) {
+	server, known := minorVersion(serverVersion)
+	removed, _ := minorVersion(d.removed)
+	deprecated, _ := minorVersion(d.deprecated)
+	switch {
+	case known && server >= removed:
+		return SeverityError, fmt.Sprintf("%s %s was removed in Kubernetes %s and is not served by this cluster (%s); use %s", apiVersion, kind, d.removed, serverVersion, d.replacement)
+	case known && server < deprecated:
+		return "", ""
+	default:
+		return SeverityWarning, fmt.Sprintf("%s %s is deprecated since Kubernetes %s and removed in %s; use %s", apiVersion, kind, d.deprecated, d.removed, d.replacement)
+	}
+}
+
+var versionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// minorVersion turns "v1.29.3" or "1.29" into 1029 for comparisons.
+func minorVersion(version string) (int, bool) {
+	m := versionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return 0, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return major*1000 + minor, true
+}
@@ -0,0 +1,522 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Finding severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Finding categories
+const (
+	CategoryScheduling = "scheduling"
+	CategoryImage      = "image"
+	CategoryCrash      = "crash"
+	CategoryProbe      = "probe"
+	CategoryConfig     = "config"
+	CategoryVolume     = "volume"
+	CategoryResources  = "resources"
+	CategoryQuota      = "quota"
+	CategoryNetwork    = "network"
+	CategoryNode       = "node"
+	CategoryRollout    = "rollout"
+)
+
+// diagnosedPodLimit bounds how many unhealthy pods of a deployment are
+// examined.
+const diagnosedPodLimit = 5
+
+// Finding is one problem found while diagnosing an object, with the causes
+// that usually explain it.
+type Finding struct {
+	Severity  string   `json:"severity"`
+	Category  string   `json:"category"`
+	Object    string   `json:"object"` // kind/name, comma separated when shared by several pods
+	Container string   `json:"container,omitempty"`
+	Reason    string   `json:"reason"`
+	Message   string   `json:"message"`
+	Causes    []string `json:"likely_causes,omitempty"`
+}
+
+type Diagnosis struct {
+	Kind      string      `json:"kind"`
+	Namespace string      `json:"namespace"`
+	Name      string      `json:"name"`
+	Status    string      `json:"status"`
+	Healthy   bool        `json:"healthy"`
+	Summary   string      `json:"summary"`
+	Findings  []Finding   `json:"findings"`
+	Events    []EventInfo `json:"events"`
+}
+
+// DiagnosePod explains why a pod is not running or ready, from its
+// container statuses, conditions and events.
+func (km *K8sManager) DiagnosePod(namespace, name string) (*Diagnosis, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	pod, err := km.clientset.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod %s: %w", name, err)
+	}
+	events, err := km.ListEvents(EventFilter{Namespace: namespace, Kind: "Pod", Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	diagnosis := &Diagnosis{
+		Kind:      "Pod",
+		Namespace: namespace,
+		Name:      name,
+		Status:    string(pod.Status.Phase),
+		Findings:  podFindings(pod, events),
+		Events:    events,
+	}
+	diagnosis.summarize("Pod is running and ready")
+	return diagnosis, nil
+}
+
+// DiagnoseDeployment explains a stalled or degraded deployment from its
+// rollout state, ReplicaSet failures, namespace quotas and the findings of
+// its unhealthy pods.
+func (km *K8sManager) DiagnoseDeployment(namespace, name string) (*Diagnosis, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	ctx := context.TODO()
+	deployment, err := km.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment %s: %w", name, err)
+	}
+	status, err := km.rolloutStatus(ctx, KindDeployment, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnosis := &Diagnosis{Kind: "Deployment", Namespace: namespace, Name: name, Status: status.Message}
+	object := "deployment/" + name
+	switch {
+	case status.Failed:
+		diagnosis.add(Finding{Severity: SeverityError, Category: CategoryRollout, Object: object, Reason: "ProgressDeadlineExceeded",
+			Message: status.Message, Causes: []string{"New pods never became available; see the pod findings below"}})
+	case status.Paused:
+		diagnosis.add(Finding{Severity: SeverityInfo, Category: CategoryRollout, Object: object, Reason: "Paused",
+			Message: "The rollout is paused; template changes are not rolled out until it is resumed"})
+	}
+	// Quotas only matter when pods are missing or were rejected for them
+	quotaRejected := false
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentReplicaFailure && condition.Status == corev1.ConditionTrue {
+			diagnosis.add(creationFailure(object, condition.Reason, condition.Message))
+			quotaRejected = quotaRejected || strings.Contains(condition.Message, "exceeded quota")
+		}
+	}
+
+	// Events of the deployment and of the ReplicaSets creating its pods
+	events, err := km.ListEvents(EventFilter{Namespace: namespace, Kind: "Deployment", Name: name})
+	if err != nil {
+		return nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector on deployment %s: %w", name, err)
+	}
+	sets, err := km.clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicasets of %s: %w", name, err)
+	}
+	for i := range sets.Items {
+		rs := &sets.Items[i]
+		if !metav1.IsControlledBy(rs, deployment) || (rs.Status.Replicas == 0 && (rs.Spec.Replicas == nil || *rs.Spec.Replicas == 0)) {
+			continue
+		}
+		rsEvents, err := km.ListEvents(EventFilter{Namespace: namespace, Kind: "ReplicaSet", Name: rs.Name})
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range rsEvents {
+			if event.Type == corev1.EventTypeWarning && event.Reason == "FailedCreate" {
+				diagnosis.add(creationFailure("replicaset/"+rs.Name, event.Reason, event.Message))
+				quotaRejected = quotaRejected || strings.Contains(event.Message, "exceeded quota")
+			}
+		}
+		events = append(events, rsEvents...)
+	}
+
+	quotaSeverity := SeverityInfo
+	if quotaRejected || !status.Done {
+		quotaSeverity = SeverityWarning
+	}
+	quotaFindings, err := km.quotaFindings(namespace, quotaSeverity)
+	if err != nil {
+		return nil, err
+	}
+	for _, finding := range quotaFindings {
+		diagnosis.add(finding)
+	}
+
+	// Findings of the unhealthy pods, merged when pods share a problem
+	pods, err := km.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of %s: %w", name, err)
+	}
+	examined := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if podReady(pod) || examined == diagnosedPodLimit {
+			continue
+		}
+		examined++
+		podEvents, err := km.ListEvents(EventFilter{Namespace: namespace, Kind: "Pod", Name: pod.Name})
+		if err != nil {
+			return nil, err
+		}
+		for _, finding := range podFindings(pod, podEvents) {
+			diagnosis.add(finding)
+		}
+		events = append(events, podEvents...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].LastSeen.After(events[j].LastSeen) })
+	diagnosis.Events = events
+	diagnosis.summarize(status.Message)
+	return diagnosis, nil
+}
+
+// add records a finding, merging it into an identical one about another pod.
+func (d *Diagnosis) add(finding Finding) {
+	for i := range d.Findings {
+		existing := &d.Findings[i]
+		if existing.Category == finding.Category && existing.Reason == finding.Reason &&
+			existing.Container == finding.Container && existing.Message == finding.Message {
+			if !strings.Contains(existing.Object, finding.Object) {
+				existing.Object += ", " + finding.Object
+			}
+			return
+		}
+	}
+	d.Findings = append(d.Findings, finding)
+}
+
+// summarize orders findings by severity and sets Healthy and Summary.
+func (d *Diagnosis) summarize(healthyMessage string) {
+	rank := map[string]int{SeverityError: 0, SeverityWarning: 1, SeverityInfo: 2}
+	sort.SliceStable(d.Findings, func(i, j int) bool { return rank[d.Findings[i].Severity] < rank[d.Findings[j].Severity] })
+	if d.Findings == nil {
+		d.Findings = []Finding{}
+	}
+	if d.Events == nil {
+		d.Events = []EventInfo{}
+	}
+
+	d.Healthy = true
+	d.Summary = healthyMessage
+	for _, finding := range d.Findings {
+		if finding.Severity != SeverityInfo {
+			d.Healthy = false
+			d.Summary = finding.Message
+			break
+		}
+	}
+}
+
+func podFindings(pod *corev1.Pod, events []EventInfo) []Finding {
+	object := "pod/" + pod.Name
+	var findings []Finding
+
+	if pod.Status.Reason == "Evicted" {
+		findings = append(findings, Finding{Severity: SeverityError, Category: CategoryNode, Object: object, Reason: "Evicted", Message: pod.Status.Message,
+			Causes: []string{"The node ran low on memory or disk and evicted the pod", "The pod exceeded its ephemeral-storage limit"}})
+	}
+	if pod.DeletionTimestamp != nil && time.Since(pod.DeletionTimestamp.Time) > 2*time.Minute {
+		causes := []string{"The node running the pod is unreachable"}
+		if len(pod.Finalizers) > 0 {
+			causes = append([]string{fmt.Sprintf("Finalizers %v have not been removed", pod.Finalizers)}, causes...)
+		}
+		findings = append(findings, Finding{Severity: SeverityWarning, Category: CategoryNode, Object: object, Reason: "Terminating",
+			Message: fmt.Sprintf("Pod has been terminating since %s", pod.DeletionTimestamp.Format(time.RFC3339)), Causes: causes})
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			findings = append(findings, Finding{Severity: SeverityError, Category: CategoryScheduling, Object: object,
+				Reason: condition.Reason, Message: condition.Message, Causes: schedulingCauses(condition.Message)})
+		}
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		findings = append(findings, containerFindings(pod, object, status, events)...)
+	}
+
+	// Warning events not explained by the statuses above
+	probes := make(map[string]bool)
+	for _, event := range events {
+		if event.Type != corev1.EventTypeWarning {
+			continue
+		}
+		switch event.Reason {
+		case "Unhealthy":
+			probe := strings.SplitN(event.Message, " ", 2)[0] // Liveness, Readiness or Startup
+			if probes[probe] {
+				continue
+			}
+			probes[probe] = true
+			findings = append(findings, Finding{Severity: SeverityWarning, Category: CategoryProbe, Object: object, Reason: probe + "ProbeFailed",
+				Message: event.Message, Causes: probeCauses(probe)})
+		case "FailedMount", "FailedAttachVolume":
+			findings = append(findings, Finding{Severity: SeverityError, Category: CategoryVolume, Object: object, Reason: event.Reason,
+				Message: event.Message, Causes: volumeCauses(event.Message)})
+		case "FailedCreatePodSandBox":
+			findings = append(findings, Finding{Severity: SeverityError, Category: CategoryNetwork, Object: object, Reason: event.Reason,
+				Message: event.Message, Causes: []string{"The CNI plugin failed to set up the pod network", "The node has run out of pod IP addresses"}})
+		case "NodeNotReady":
+			findings = append(findings, Finding{Severity: SeverityWarning, Category: CategoryNode, Object: object, Reason: event.Reason, Message: event.Message})
+		}
+	}
+	return findings
+}
+
+func containerFindings(pod *corev1.Pod, object string, status corev1.ContainerStatus, events []EventInfo) []Finding {
+	var findings []Finding
+	finding := func(severity, category, reason, message string, causes []string) {
+		findings = append(findings, Finding{Severity: severity, Category: category, Object: object, Container: status.Name,
+			Reason: reason, Message: message, Causes: causes})
+	}
+	last := status.LastTerminationState.Terminated
+
+	if waiting := status.State.Waiting; waiting != nil {
+		switch waiting.Reason {
+		case "ImagePullBackOff", "ErrImagePull", "InvalidImageName", "ErrImageNeverPull":
+			// The pull error itself is in the events, the status only says back-off
+			image := specImage(pod, status.Name, status.Image)
+			detail := waiting.Message
+			for _, event := range events {
+				if event.Reason == "Failed" && strings.Contains(event.Message, image) {
+					detail = event.Message
+					break
+				}
+			}
+			finding(SeverityError, CategoryImage, waiting.Reason, fmt.Sprintf("Cannot pull image %s: %s", image, detail),
+				imagePullCauses(waiting.Reason, detail))
+		case "CrashLoopBackOff":
+			message := fmt.Sprintf("Container %s keeps crashing (%d restarts)", status.Name, status.RestartCount)
+			var causes []string
+			if last != nil {
+				message += fmt.Sprintf(", last exit: %s (code %d)", last.Reason, last.ExitCode)
+				causes = exitCodeCauses(last.Reason, last.ExitCode)
+			}
+			finding(SeverityError, CategoryCrash, waiting.Reason, message, causes)
+		case "CreateContainerConfigError":
+			finding(SeverityError, CategoryConfig, waiting.Reason, waiting.Message,
+				[]string{"A ConfigMap, Secret or key referenced by env or envFrom does not exist", "runAsNonRoot is set but the image runs as root"})
+		case "CreateContainerError", "RunContainerError":
+			finding(SeverityError, CategoryConfig, waiting.Reason, waiting.Message,
+				[]string{"The command or entrypoint does not exist in the image", "A volume mount or subPath cannot be created"})
+		}
+	}
+
+	if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 && pod.Spec.RestartPolicy != corev1.RestartPolicyAlways {
+		finding(SeverityError, CategoryCrash, terminated.Reason,
+			fmt.Sprintf("Container %s exited with code %d", status.Name, terminated.ExitCode), exitCodeCauses(terminated.Reason, terminated.ExitCode))
+	}
+
+	if last != nil && last.Reason == "OOMKilled" && status.State.Waiting == nil {
+		limit := "no memory limit"
+		for _, container := range pod.Spec.Containers {
+			if container.Name == status.Name {
+				if memory, ok := container.Resources.Limits[corev1.ResourceMemory]; ok {
+					limit = "memory limit " + memory.String()
+				}
+			}
+		}
+		finding(SeverityWarning, CategoryResources, "OOMKilled",
+			fmt.Sprintf("Container %s was killed for running out of memory (%s)", status.Name, limit),
+			[]string{"The memory limit is below the application's working set", "The application leaks memory"})
+	}
+
+	if status.State.Running != nil && !status.Ready && len(findings) == 0 && pod.DeletionTimestamp == nil {
+		started := status.Started != nil && *status.Started
+		reason := "NotReady"
+		if !started {
+			reason = "NotStarted"
+		}
+		finding(SeverityWarning, CategoryProbe, reason, fmt.Sprintf("Container %s is running but not ready", status.Name),
+			[]string{"The readiness probe is failing; see the probe events", "The application is still starting"})
+	} else if status.State.Running != nil && status.RestartCount > 0 && len(findings) == 0 {
+		message := fmt.Sprintf("Container %s restarted %d times", status.Name, status.RestartCount)
+		if last != nil {
+			message += fmt.Sprintf(", last exit: %s (code %d)", last.Reason, last.ExitCode)
+		}
+		finding(SeverityInfo, CategoryCrash, "Restarted", message, nil)
+	}
+	return findings
+}
+
+// specImage returns the image as written in the pod spec; statuses report
+// it normalized, e.g. docker.io/library/nginx:latest.
+func specImage(pod *corev1.Pod, container, fallback string) string {
+	for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if c.Name == container {
+			return c.Image
+		}
+	}
+	return fallback
+}
+
+// creationFailure explains pods a controller could not create.
+func creationFailure(object, reason, message string) Finding {
+	finding := Finding{Severity: SeverityError, Category: CategoryConfig, Object: object, Reason: reason, Message: message}
+	switch {
+	case strings.Contains(message, "exceeded quota"):
+		finding.Category = CategoryQuota
+		finding.Causes = []string{"The namespace ResourceQuota is exhausted; lower requests or raise the quota"}
+	case strings.Contains(message, "must specify") && strings.Contains(message, "limits"):
+		finding.Category = CategoryQuota
+		finding.Causes = []string{"A ResourceQuota requires requests and limits that the pod template does not set"}
+	case strings.Contains(message, "forbidden"):
+		finding.Causes = []string{"An admission policy (Pod Security, webhook or LimitRange) rejected the pod template"}
+	case strings.Contains(message, "serviceaccount"):
+		finding.Causes = []string{"The service account referenced by the pod template does not exist"}
+	}
+	return finding
+}
+
+// quotaFindings reports ResourceQuotas of the namespace that are used up,
+// with the given severity.
+func (km *K8sManager) quotaFindings(namespace, severity string) ([]Finding, error) {
+	quotas, err := km.clientset.CoreV1().ResourceQuotas(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource quotas: %w", err)
+	}
+
+	var findings []Finding
+	for _, quota := range quotas.Items {
+		for resource, hard := range quota.Status.Hard {
+			used, ok := quota.Status.Used[resource]
+			if !ok || used.Cmp(hard) < 0 {
+				continue
+			}
+			findings = append(findings, Finding{
+				Severity: severity,
+				Category: CategoryQuota,
+				Object:   "resourcequota/" + quota.Name,
+				Reason:   "QuotaExhausted",
+				Message:  fmt.Sprintf("Quota %s is used up for %s (%s/%s)", quota.Name, resource, used.String(), hard.String()),
+				Causes:   []string{"New pods are rejected until usage drops or the quota is raised"},
+			})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Message < findings[j].Message })
+	return findings, nil
+}
+
+func schedulingCauses(message string) []string {
+	checks := []struct{ match, cause string }{
+		{"Insufficient cpu", "No node has enough allocatable CPU for the pod's requests"},
+		{"Insufficient memory", "No node has enough allocatable memory for the pod's requests"},
+		{"Insufficient ephemeral-storage", "No node has enough ephemeral storage for the pod's requests"},
+		{"didn't match Pod's node affinity/selector", "The nodeSelector or node affinity matches no schedulable node"},
+		{"untolerated taint", "Nodes are tainted and the pod has no matching toleration"},
+		{"unbound immediate PersistentVolumeClaims", "A PersistentVolumeClaim of the pod is not bound"},
+		{"volume node affinity conflict", "The pod's volumes live in a zone without schedulable nodes"},
+		{"didn't match pod anti-affinity", "Pod anti-affinity rules exclude every node"},
+		{"didn't match pod affinity", "No node runs the pods required by pod affinity"},
+		{"Too many pods", "Nodes have reached their maximum pod count"},
+		{"node(s) were unschedulable", "Nodes are cordoned"},
+		{"didn't have free ports", "The requested hostPort is already taken on every node"},
+	}
+	var causes []string
+	for _, check := range checks {
+		if strings.Contains(message, check.match) {
+			causes = append(causes, check.cause)
+		}
+	}
+	if len(causes) == 0 {
+		causes = []string{"The scheduler found no node matching the pod's requirements"}
+	}
+	return causes
+}
+
+func imagePullCauses(reason, message string) []string {
+	lower := strings.ToLower(message)
+	switch {
+	case reason == "InvalidImageName":
+		return []string{"The image reference is malformed"}
+	case reason == "ErrImageNeverPull":
+		return []string{"imagePullPolicy is Never and the image is not present on the node"}
+	case strings.Contains(lower, "unauthorized"), strings.Contains(lower, "authentication required"),
+		strings.Contains(lower, "access denied"), strings.Contains(lower, "403 forbidden"):
+		return []string{"The registry requires credentials: add or fix imagePullSecrets", "The image is private or the repository name is wrong"}
+	case strings.Contains(lower, "not found"), strings.Contains(lower, "manifest unknown"):
+		return []string{"The image or tag does not exist in the registry", "The image was not built for the node's platform"}
+	case strings.Contains(lower, "toomanyrequests"), strings.Contains(lower, "rate limit"):
+		return []string{"The registry is rate limiting pulls; authenticate or use a mirror"}
+	case strings.Contains(lower, "no such host"), strings.Contains(lower, "i/o timeout"),
+		strings.Contains(lower, "connection refused"), strings.Contains(lower, "dial tcp"):
+		return []string{"The node cannot reach the registry (DNS, proxy or firewall)"}
+	case strings.Contains(lower, "x509"), strings.Contains(lower, "certificate"):
+		return []string{"The registry certificate is not trusted by the node"}
+	}
+	return []string{"Check the image reference and that the node can pull from the registry"}
+}
+
+func exitCodeCauses(reason string, code int32) []string {
+	switch {
+	case reason == "OOMKilled":
+		return []string{"The container exceeded its memory limit"}
+	case reason == "ContainerCannotRun", reason == "StartError":
+		return []string{"The command or entrypoint cannot be started"}
+	case code == 0:
+		return []string{"The main process exits immediately; it must run in the foreground"}
+	case code == 1, code == 2:
+		return []string{"The application failed on startup; check the logs of the previous instance", "Required configuration or environment variables are missing"}
+	case code == 126:
+		return []string{"The command is not executable"}
+	case code == 127:
+		return []string{"The command is not found in the image"}
+	case code == 137:
+		return []string{"The container was killed (SIGKILL): out of memory or a failing liveness probe"}
+	case code == 143:
+		return []string{"The container was stopped (SIGTERM), usually by a failing liveness probe"}
+	case code > 128:
+		return []string{fmt.Sprintf("The process was killed by signal %d", code-128)}
+	}
+	return []string{"The application exited with an error; check the logs of the previous instance"}
+}
+
+func probeCauses(probe string) []string {
+	causes := []string{"The probe path, port or command is wrong", "The probe timeout is too short for the application"}
+	switch probe {
+	case "Liveness":
+		causes = append(causes, "The application starts slower than the probe allows; add a startupProbe or raise initialDelaySeconds")
+	case "Readiness":
+		causes = append(causes, "A dependency of the application (database, downstream service) is unavailable")
+	}
+	return causes
+}
+
+func volumeCauses(message string) []string {
+	switch {
+	case strings.Contains(message, "not found") && (strings.Contains(message, "configmap") || strings.Contains(message, "secret")):
+		return []string{"A ConfigMap or Secret mounted as a volume does not exist"}
+	case strings.Contains(message, "Multi-Attach"):
+		return []string{"The volume is still attached to another node (ReadWriteOnce)"}
+	case strings.Contains(message, "not bound"), strings.Contains(message, "persistentvolumeclaim"):
+		return []string{"The PersistentVolumeClaim is not bound"}
+	}
+	return []string{"The volume could not be attached or mounted on the node"}
+}
@@ -0,0 +1,180 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Diff actions reported per object
+const (
+	DiffCreate    = "create"
+	DiffUpdate    = "update"
+	DiffUnchanged = "unchanged"
+	DiffDelete    = "delete" // only in Helm upgrade diffs
+	DiffError     = "error"
+)
+
+type ObjectDiff struct {
+	APIVersion string `json:"api_version"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace,omitempty"`
+	Action     string `json:"action"`
+	Diff       string `json:"diff,omitempty"` // unified diff, live -> merged
+	Error      string `json:"error,omitempty"`
+}
+
+type DiffSummary struct {
+	Create    int `json:"create"`
+	Update    int `json:"update"`
+	Unchanged int `json:"unchanged"`
+	Delete    int `json:"delete,omitempty"`
+	Errors    int `json:"errors"`
+}
+
+// DiffManifest shows what ApplyManifest would change: every object is
+// server-side applied in dry-run mode and the result is diffed against the
+// live object, both without managed fields and status. Secret values are
+// replaced by digests.
+func (km *K8sManager) DiffManifest(manifest string, opts ApplyOptions) ([]ObjectDiff, DiffSummary, error) {
+	var summary DiffSummary
+	if !km.IsConnected() {
+		return nil, summary, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	if opts.FieldManager == "" {
+		opts.FieldManager = DefaultFieldManager
+	}
+
+	objects, err := decodeManifest(manifest)
+	if err != nil {
+		return nil, summary, err
+	}
+	sortForApply(objects)
+
+	diffs := make([]ObjectDiff, 0, len(objects))
+	for _, obj := range objects {
+		diff := km.diffObject(obj, opts)
+		switch diff.Action {
+		case DiffCreate:
+			summary.Create++
+		case DiffUpdate:
+			summary.Update++
+		case DiffUnchanged:
+			summary.Unchanged++
+		default:
+			summary.Errors++
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, summary, nil
+}
+
+func (km *K8sManager) diffObject(obj *unstructured.Unstructured, opts ApplyOptions) ObjectDiff {
+	diff := ObjectDiff{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Name:       obj.GetName(),
+		Action:     DiffError,
+	}
+	client, live, err := km.prepareApply(obj, opts)
+	if err != nil {
+		diff.Error = err.Error()
+		return diff
+	}
+	diff.Namespace = obj.GetNamespace()
+
+	merged, err := client.Apply(context.TODO(), obj.GetName(), obj, opts.applyOptions(true))
+	if err != nil {
+		diff.Error = err.Error()
+		return diff
+	}
+
+	var liveYAML string
+	if live != nil {
+		if liveYAML, err = objectYAML(maskSecretValues(live)); err != nil {
+			diff.Error = err.Error()
+			return diff
+		}
+	}
+	mergedYAML, err := objectYAML(maskSecretValues(merged))
+	if err != nil {
+		diff.Error = err.Error()
+		return diff
+	}
+
+	switch {
+	case live == nil:
+		diff.Action = DiffCreate
+	case liveYAML == mergedYAML:
+		diff.Action = DiffUnchanged
+		return diff
+	default:
+		diff.Action = DiffUpdate
+	}
+
+	ref := objectRef(obj.GroupVersionKind(), obj.GetName())
+	diff.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(liveYAML),
+		B:        difflib.SplitLines(mergedYAML),
+		FromFile: "live/" + ref,
+		ToFile:   "merged/" + ref,
+		Context:  3,
+	})
+	if err != nil {
+		diff.Action = DiffError
+		diff.Error = err.Error()
+	}
+	return diff
+}
+
+// objectYAML renders an object for diffing, without server-maintained fields.
+func objectYAML(obj *unstructured.Unstructured) (string, error) {
+	data, err := yaml.Marshal(sanitizeObject(obj).Object)
+	if err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", obj.GetName(), err)
+	}
+	return string(data), nil
+}
+
+// maskSecretValues replaces the values of a Secret with a keyed digest, so
+// a diff shows which keys change without revealing them.
+func maskSecretValues(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	if obj.GetKind() != "Secret" {
+		return obj
+	}
+	masked := obj.DeepCopy()
+	for _, field := range []string{"data", "stringData"} {
+		values, found, _ := unstructured.NestedMap(masked.Object, field)
+		if !found {
+			continue
+		}
+		for key, value := range values {
+			values[key] = maskValue(value)
+		}
+		unstructured.SetNestedMap(masked.Object, values, field)
+	}
+	return masked
+}
+
+// maskKey keys the digests of masked values. It is random per process, so
+// equal values compare equal within a run but a digest cannot be checked
+// against guessed values.
+var maskKey = func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+// maskValue replaces a secret value with a short HMAC of it.
+func maskValue(value interface{}) string {
+	mac := hmac.New(sha256.New, maskKey)
+	mac.Write([]byte(fmt.Sprint(value)))
+	return fmt.Sprintf("masked:%x", mac.Sum(nil)[:8])
+}
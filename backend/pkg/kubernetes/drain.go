@@ -0,0 +1,265 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// mirrorPodAnnotation marks the API copy of a static pod run by the kubelet
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// evictionRetryInterval spaces eviction attempts a PodDisruptionBudget refused
+const evictionRetryInterval = 5 * time.Second
+
+// Drain phases reported through DrainProgress
+const (
+	DrainPhaseSkipped  = "skipped"  // DaemonSet or mirror pod, left running
+	DrainPhaseEvicting = "evicting" // eviction requested
+	DrainPhaseBlocked  = "blocked"  // refused by a PodDisruptionBudget, retrying
+	DrainPhaseWaiting  = "waiting"  // eviction accepted, pod terminating
+	DrainPhaseEvicted  = "evicted"  // pod is gone
+	DrainPhaseDryRun   = "dry-run"  // would be evicted
+	DrainPhaseTimeout  = "timeout"  // still present when the drain timed out
+	DrainPhaseError    = "error"
+)
+
+type DrainOptions struct {
+	Force              bool          `json:"force"`                // evict pods no controller recreates
+	DeleteEmptyDirData bool          `json:"delete_emptydir_data"` // evict pods whose emptyDir data is lost
+	GracePeriodSeconds *int64        `json:"grace_period_seconds"` // pod default when nil
+	Timeout            time.Duration `json:"timeout"`              // five minutes by default
+	DryRun             bool          `json:"dry_run"`
+}
+
+// DrainProgress is one step of a pod's eviction, also used as its final
+// result.
+type DrainProgress struct {
+	Node      string `json:"node"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Phase     string `json:"phase"`
+	Reason    string `json:"reason,omitempty"` // why the pod is skipped or blocked
+	Error     string `json:"error,omitempty"`
+}
+
+type DrainResult struct {
+	Node    string          `json:"node"`
+	Drained bool            `json:"drained"` // every evictable pod is gone
+	Pods    []DrainProgress `json:"pods"`
+}
+
+// CordonNode marks a node unschedulable; its pods keep running.
+func (km *K8sManager) CordonNode(name string) error {
+	return km.setUnschedulable(name, true)
+}
+
+func (km *K8sManager) UncordonNode(name string) error {
+	return km.setUnschedulable(name, false)
+}
+
+func (km *K8sManager) setUnschedulable(name string, unschedulable bool) error {
+	if !km.IsConnected() {
+		return fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	if _, err := km.clientset.CoreV1().Nodes().Patch(context.TODO(), name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to update node %s: %w", name, err)
+	}
+	logrus.Infof("Set node %s unschedulable=%t", name, unschedulable)
+	return nil
+}
+
+// DrainNode cordons a node and evicts its pods through the eviction API,
+// so PodDisruptionBudgets are respected; evictions a budget refuses are
+// retried until the timeout. DaemonSet and mirror pods are skipped. Like
+// kubectl, nothing is evicted when a pod without controller needs Force or
+// a pod with emptyDir volumes needs DeleteEmptyDirData. progress, when
+// set, receives every step.
+func (km *K8sManager) DrainNode(ctx context.Context, name string, opts DrainOptions, progress func(DrainProgress)) (*DrainResult, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	if progress == nil {
+		progress = func(DrainProgress) {}
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if !opts.DryRun {
+		if err := km.CordonNode(name); err != nil {
+			return nil, err
+		}
+	}
+
+	list, err := km.clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", name).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods on node %s: %w", name, err)
+	}
+
+	result := &DrainResult{Node: name, Pods: make([]DrainProgress, 0, len(list.Items))}
+	var evict []*corev1.Pod
+	var refused []string
+	for i := range list.Items {
+		pod := &list.Items[i]
+		p := DrainProgress{Node: name, Namespace: pod.Namespace, Pod: pod.Name}
+		skip, problem := drainFilter(pod, opts)
+		switch {
+		case skip != "":
+			p.Phase = DrainPhaseSkipped
+			p.Reason = skip
+		case problem != "":
+			p.Phase = DrainPhaseError
+			p.Error = problem
+			refused = append(refused, fmt.Sprintf("%s/%s (%s)", pod.Namespace, pod.Name, problem))
+		case opts.DryRun:
+			p.Phase = DrainPhaseDryRun
+		default:
+			evict = append(evict, pod)
+			continue
+		}
+		result.Pods = append(result.Pods, p)
+		progress(p)
+	}
+	if len(refused) > 0 {
+		return result, fmt.Errorf("cannot drain node %s: %s", name, strings.Join(refused, ", "))
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	report := func(p DrainProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress(p)
+	}
+	results := make([]DrainProgress, len(evict))
+	for i, pod := range evict {
+		wg.Add(1)
+		go func(i int, pod *corev1.Pod) {
+			defer wg.Done()
+			results[i] = km.evictPod(ctx, name, pod, opts.GracePeriodSeconds, report)
+			report(results[i])
+		}(i, pod)
+	}
+	wg.Wait()
+
+	result.Drained = true
+	for _, p := range results {
+		if p.Phase != DrainPhaseEvicted {
+			result.Drained = false
+		}
+		result.Pods = append(result.Pods, p)
+	}
+	if result.Drained {
+		logrus.Infof("Drained node %s, %d pods evicted", name, len(results))
+	}
+	return result, nil
+}
+
+// drainFilter tells why a pod is left on the node, or why it blocks the
+// drain.
+func drainFilter(pod *corev1.Pod, opts DrainOptions) (skip, problem string) {
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return "mirror pod", ""
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return "", "" // finished pods are always safe to remove
+	}
+	controller := metav1.GetControllerOf(pod)
+	if controller != nil && controller.Kind == "DaemonSet" {
+		return "DaemonSet pod", ""
+	}
+	if controller == nil && !opts.Force {
+		return "", "not managed by a controller, use force"
+	}
+	if !opts.DeleteEmptyDirData {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.EmptyDir != nil {
+				return "", fmt.Sprintf("uses emptyDir volume %s, use delete_emptydir_data", volume.Name)
+			}
+		}
+	}
+	return "", ""
+}
+
+// evictPod evicts one pod, retrying while a disruption budget refuses,
+// and waits until it is gone. The final state is returned, not reported.
+func (km *K8sManager) evictPod(ctx context.Context, node string, pod *corev1.Pod, gracePeriod *int64, report func(DrainProgress)) DrainProgress {
+	p := DrainProgress{Node: node, Namespace: pod.Namespace, Pod: pod.Name, Phase: DrainPhaseEvicting}
+	report(p)
+
+	eviction := &policyv1.Eviction{
+		ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: gracePeriod},
+	}
+	pods := km.clientset.CoreV1().Pods(pod.Namespace)
+	for {
+		err := km.clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+		if err == nil || apierrors.IsNotFound(err) {
+			break
+		}
+		if !apierrors.IsTooManyRequests(err) {
+			return drainFailed(ctx, p, err)
+		}
+		if p.Phase != DrainPhaseBlocked {
+			p.Phase = DrainPhaseBlocked
+			p.Reason = err.Error()
+			report(p)
+		}
+		select {
+		case <-ctx.Done():
+			return drainFailed(ctx, p, ctx.Err())
+		case <-time.After(evictionRetryInterval):
+		}
+	}
+
+	p.Phase = DrainPhaseWaiting
+	p.Reason = ""
+	report(p)
+	for {
+		current, err := pods.Get(ctx, pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) || (err == nil && current.UID != pod.UID) {
+			p.Phase = DrainPhaseEvicted
+			return p
+		}
+		if err != nil {
+			return drainFailed(ctx, p, err)
+		}
+		select {
+		case <-ctx.Done():
+			return drainFailed(ctx, p, ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// drainFailed is the final state of an eviction that did not complete.
+func drainFailed(ctx context.Context, p DrainProgress, err error) DrainProgress {
+	if ctx.Err() == context.DeadlineExceeded {
+		p.Phase = DrainPhaseTimeout
+	} else {
+		p.Phase = DrainPhaseError
+		p.Error = err.Error()
+	}
+	return p
+}
@@ -0,0 +1,78 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// EventFilter selects events; empty fields match everything.
+type EventFilter struct {
+	Namespace string `json:"namespace"` // empty for all namespaces
+	Kind      string `json:"kind"`      // involved object kind, e.g. Pod
+	Name      string `json:"name"`      // involved object name
+	UID       string `json:"uid"`       // involved object UID, tells apart recreated objects
+	Type      string `json:"type"`      // Normal or Warning
+}
+
+// ListEvents returns the matching events, most recent first.
+func (km *K8sManager) ListEvents(filter EventFilter) ([]EventInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	set := fields.Set{}
+	if filter.Kind != "" {
+		set["involvedObject.kind"] = eventKind(filter.Kind)
+	}
+	if filter.Name != "" {
+		set["involvedObject.name"] = filter.Name
+	}
+	if filter.UID != "" {
+		set["involvedObject.uid"] = filter.UID
+	}
+	if filter.Type != "" {
+		set["type"] = filter.Type
+	}
+
+	events, err := km.listEvents(filter.Namespace, fields.SelectorFromSet(set))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	result := make([]EventInfo, 0, len(events))
+	for _, event := range events {
+		result = append(result, toEventInfo(event))
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].LastSeen.After(result[j].LastSeen) })
+	return result, nil
+}
+
+// eventKind turns a resource name or lowercase kind into the Kind recorded
+// on events ("pods", "pod" and "Pod" all become "Pod").
+func eventKind(kind string) string {
+	known := map[string]string{
+		"po": "Pod", "pod": "Pod", "pods": "Pod",
+		"deploy": "Deployment", "deployment": "Deployment", "deployments": "Deployment",
+		"rs": "ReplicaSet", "replicaset": "ReplicaSet", "replicasets": "ReplicaSet",
+		"sts": "StatefulSet", "statefulset": "StatefulSet", "statefulsets": "StatefulSet",
+		"ds": "DaemonSet", "daemonset": "DaemonSet", "daemonsets": "DaemonSet",
+		"job": "Job", "jobs": "Job",
+		"cj": "CronJob", "cronjob": "CronJob", "cronjobs": "CronJob",
+		"svc": "Service", "service": "Service", "services": "Service",
+		"no": "Node", "node": "Node", "nodes": "Node",
+		"pvc": "PersistentVolumeClaim", "persistentvolumeclaim": "PersistentVolumeClaim", "persistentvolumeclaims": "PersistentVolumeClaim",
+		"hpa": "HorizontalPodAutoscaler", "horizontalpodautoscaler": "HorizontalPodAutoscaler", "horizontalpodautoscalers": "HorizontalPodAutoscaler",
+		"ing": "Ingress", "ingress": "Ingress", "ingresses": "Ingress",
+		"cm": "ConfigMap", "configmap": "ConfigMap", "configmaps": "ConfigMap",
+		"secret": "Secret", "secrets": "Secret",
+		"pv": "PersistentVolume", "persistentvolume": "PersistentVolume", "persistentvolumes": "PersistentVolume",
+		"endpointslice": "EndpointSlice", "endpointslices": "EndpointSlice",
+	}
+	if k, ok := known[strings.ToLower(kind)]; ok {
+		return k
+	}
+	return kind
+}
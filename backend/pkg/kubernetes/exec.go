@@ -0,0 +1,172 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// defaultShell starts bash when the image has it and sh otherwise.
+var defaultShell = []string{"/bin/sh", "-c", "command -v bash >/dev/null && exec bash || exec sh"}
+
+type TerminalSize struct {
+	Cols uint16 `json:"cols"`
+	Rows uint16 `json:"rows"`
+}
+
+// TerminalStreams connects a remote process to the caller. Nil streams are
+// not attached; Stderr is unused with a TTY.
+type TerminalStreams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	Resize <-chan TerminalSize
+}
+
+type ExecOptions struct {
+	Container string   `json:"container"` // defaults to the pod's default container
+	Command   []string `json:"command"`   // defaults to a shell; ignored by Attach
+	TTY       bool     `json:"tty"`
+}
+
+// ExitError reports a remote process that exited with a non-zero code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command terminated with exit code %d", e.Code)
+}
+
+// Exec runs a command in a pod container and connects it to streams until
+// it exits or ctx is cancelled.
+func (km *K8sManager) Exec(ctx context.Context, namespace, pod string, opts ExecOptions, streams TerminalStreams) error {
+	container, err := km.execContainer(ctx, namespace, pod, opts.Container)
+	if err != nil {
+		return err
+	}
+	command := opts.Command
+	if len(command) == 0 {
+		command = defaultShell
+	}
+
+	req := km.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(namespace).Name(pod).SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     streams.Stdin != nil,
+			Stdout:    streams.Stdout != nil,
+			Stderr:    streams.Stderr != nil && !opts.TTY,
+			TTY:       opts.TTY,
+		}, scheme.ParameterCodec)
+
+	logrus.Infof("Exec in %s/%s (%s): %v", namespace, pod, container, command)
+	return km.streamTerminal(ctx, req, opts.TTY, streams)
+}
+
+// Attach connects streams to the main process of a running container.
+func (km *K8sManager) Attach(ctx context.Context, namespace, pod string, opts ExecOptions, streams TerminalStreams) error {
+	container, err := km.execContainer(ctx, namespace, pod, opts.Container)
+	if err != nil {
+		return err
+	}
+
+	req := km.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(namespace).Name(pod).SubResource("attach").
+		VersionedParams(&corev1.PodAttachOptions{
+			Container: container,
+			Stdin:     streams.Stdin != nil,
+			Stdout:    streams.Stdout != nil,
+			Stderr:    streams.Stderr != nil && !opts.TTY,
+			TTY:       opts.TTY,
+		}, scheme.ParameterCodec)
+
+	logrus.Infof("Attach to %s/%s (%s)", namespace, pod, container)
+	return km.streamTerminal(ctx, req, opts.TTY, streams)
+}
+
+// execContainer validates the pod is running and resolves the container.
+func (km *K8sManager) execContainer(ctx context.Context, namespace, pod, container string) (string, error) {
+	if !km.IsConnected() {
+		return "", fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	p, err := km.clientset.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get pod %s: %w", pod, err)
+	}
+	if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+		return "", fmt.Errorf("pod %s has terminated (%s)", pod, p.Status.Phase)
+	}
+	if container == "" {
+		container = defaultContainer(p)
+	}
+	return container, nil
+}
+
+// streamTerminal opens the request over WebSocket, falling back to SPDY
+// for API servers that do not support it.
+func (km *K8sManager) streamTerminal(ctx context.Context, req *rest.Request, tty bool, streams TerminalStreams) error {
+	wsExec, err := remotecommand.NewWebSocketExecutor(km.config, "GET", req.URL().String())
+	if err != nil {
+		return fmt.Errorf("failed to create WebSocket executor: %w", err)
+	}
+	spdyExec, err := remotecommand.NewSPDYExecutor(km.config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create SPDY executor: %w", err)
+	}
+	executor, err := remotecommand.NewFallbackExecutor(wsExec, spdyExec, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return err
+	}
+
+	opts := remotecommand.StreamOptions{
+		Stdin:  streams.Stdin,
+		Stdout: streams.Stdout,
+		Stderr: streams.Stderr,
+		Tty:    tty,
+	}
+	if tty && streams.Resize != nil {
+		opts.TerminalSizeQueue = &sizeQueue{ctx: ctx, resize: streams.Resize}
+	}
+	if tty {
+		opts.Stderr = nil
+	}
+
+	err = executor.StreamWithContext(ctx, opts)
+	var exitErr utilexec.CodeExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{Code: exitErr.Code}
+	}
+	return err
+}
+
+// sizeQueue adapts a resize channel to remotecommand.TerminalSizeQueue.
+type sizeQueue struct {
+	ctx    context.Context
+	resize <-chan TerminalSize
+}
+
+func (q *sizeQueue) Next() *remotecommand.TerminalSize {
+	select {
+	case size, ok := <-q.resize:
+		if !ok {
+			return nil
+		}
+		return &remotecommand.TerminalSize{Width: size.Cols, Height: size.Rows}
+	case <-q.ctx.Done():
+		return nil
+	}
+}
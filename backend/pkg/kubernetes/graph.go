@@ -0,0 +1,392 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Relationship types of graph edges
+const (
+	EdgeOwns    = "owns"    // ownerReferences
+	EdgeSelects = "selects" // label selector, e.g. Service to Pods
+	EdgeTargets = "targets" // EndpointSlice endpoint to Pod
+	EdgeRoutes  = "routes"  // Ingress backend to Service
+	EdgeMounts  = "mounts"  // Pod volume
+	EdgeUses    = "uses"    // env, envFrom, imagePullSecrets, ingress TLS
+	EdgeBinds   = "binds"   // PersistentVolumeClaim to PersistentVolume
+)
+
+// upstreamEdges are followed backwards from every object in the graph, so
+// a Pod shows its ReplicaSet, Deployment and Services but a shared Secret
+// does not pull in every Pod mounting it.
+var upstreamEdges = map[string]bool{EdgeOwns: true, EdgeSelects: true, EdgeTargets: true, EdgeRoutes: true}
+
+type GraphNode struct {
+	ID        string `json:"id"` // Kind/namespace/name
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Root      bool   `json:"root,omitempty"`
+	Missing   bool   `json:"missing,omitempty"` // referenced but not found
+}
+
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+}
+
+type ResourceGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type graphBuilder struct {
+	nodes map[string]*GraphNode
+	out   map[string][]GraphEdge
+	in    map[string][]GraphEdge
+}
+
+func nodeID(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func (g *graphBuilder) node(kind, namespace, name, status string) string {
+	id := nodeID(kind, namespace, name)
+	if n, ok := g.nodes[id]; ok {
+		n.Missing = false
+		if status != "" {
+			n.Status = status
+		}
+		return id
+	}
+	g.nodes[id] = &GraphNode{ID: id, Kind: kind, Name: name, Namespace: namespace, Status: status}
+	return id
+}
+
+// ref adds an edge to an object that may not exist; it is marked missing
+// until listed.
+func (g *graphBuilder) ref(from, kind, namespace, name, edgeType string) {
+	id := nodeID(kind, namespace, name)
+	if _, ok := g.nodes[id]; !ok {
+		g.nodes[id] = &GraphNode{ID: id, Kind: kind, Name: name, Namespace: namespace, Missing: true}
+	}
+	g.edge(from, id, edgeType)
+}
+
+func (g *graphBuilder) edge(from, to, edgeType string) {
+	for _, e := range g.out[from] {
+		if e.To == to && e.Type == edgeType {
+			return
+		}
+	}
+	e := GraphEdge{From: from, To: to, Type: edgeType}
+	g.out[from] = append(g.out[from], e)
+	g.in[to] = append(g.in[to], e)
+}
+
+// object adds a listed object and the edge from its controller.
+func (g *graphBuilder) object(kind string, obj metav1.Object, status string) string {
+	id := g.node(kind, obj.GetNamespace(), obj.GetName(), status)
+	if owner := metav1.GetControllerOf(obj); owner != nil {
+		ownerID := nodeID(owner.Kind, obj.GetNamespace(), owner.Name)
+		if _, ok := g.nodes[ownerID]; !ok {
+			g.nodes[ownerID] = &GraphNode{ID: ownerID, Kind: owner.Kind, Name: owner.Name, Namespace: obj.GetNamespace(), Missing: true}
+		}
+		g.edge(ownerID, id, EdgeOwns)
+	}
+	return id
+}
+
+// BuildGraph returns the objects related to one object of a namespace:
+// everything it owns, selects, routes to or mounts, transitively, plus the
+// owners, Services and Ingresses leading to those objects.
+func (km *K8sManager) BuildGraph(kind, namespace, name string) (*ResourceGraph, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	g, err := km.namespaceGraph(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	kind = eventKind(kind)
+	rootID := nodeID(kind, namespace, name)
+	if kind == "PersistentVolume" {
+		rootID = nodeID(kind, "", name)
+	}
+	root, ok := g.nodes[rootID]
+	if !ok || root.Missing {
+		return nil, notFoundError(fmt.Sprintf("%s %s not found in namespace %s", kind, name, namespace))
+	}
+	root.Root = true
+
+	// Everything downstream of the root, then the upstream chains of all of it
+	visited := map[string]bool{rootID: true}
+	queue := []string{rootID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range g.out[id] {
+			if !visited[e.To] {
+				visited[e.To] = true
+				queue = append(queue, e.To)
+			}
+		}
+	}
+	for id := range visited {
+		queue = append(queue, id)
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range g.in[id] {
+			if upstreamEdges[e.Type] && !visited[e.From] {
+				visited[e.From] = true
+				queue = append(queue, e.From)
+			}
+		}
+	}
+
+	graph := &ResourceGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for id := range visited {
+		graph.Nodes = append(graph.Nodes, *g.nodes[id])
+		for _, e := range g.out[id] {
+			if visited[e.To] {
+				graph.Edges = append(graph.Edges, e)
+			}
+		}
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+	return graph, nil
+}
+
+// namespaceGraph links every workload, networking and storage object of a
+// namespace. Pods, Services and Deployments come from the cache once synced.
+func (km *K8sManager) namespaceGraph(namespace string) (*graphBuilder, error) {
+	ctx := context.TODO()
+	opts := metav1.ListOptions{}
+	g := &graphBuilder{
+		nodes: make(map[string]*GraphNode),
+		out:   make(map[string][]GraphEdge),
+		in:    make(map[string][]GraphEdge),
+	}
+
+	// Config and storage first so references from pods resolve. Only the
+	// metadata of ConfigMaps and Secrets is listed, never their data
+	configMaps, err := km.metadata.Resource(corev1.SchemeGroupVersion.WithResource("configmaps")).Namespace(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list configmaps: %w", err)
+	}
+	for i := range configMaps.Items {
+		g.object("ConfigMap", &configMaps.Items[i], "")
+	}
+	secrets, err := km.metadata.Resource(corev1.SchemeGroupVersion.WithResource("secrets")).Namespace(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	for i := range secrets.Items {
+		g.object("Secret", &secrets.Items[i], "")
+	}
+	claims, err := km.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistentvolumeclaims: %w", err)
+	}
+	for i := range claims.Items {
+		pvc := &claims.Items[i]
+		id := g.object("PersistentVolumeClaim", pvc, string(pvc.Status.Phase))
+		if pvc.Spec.VolumeName != "" {
+			g.ref(id, "PersistentVolume", "", pvc.Spec.VolumeName, EdgeBinds)
+		}
+	}
+	if volumes, err := km.clientset.CoreV1().PersistentVolumes().List(ctx, opts); err == nil {
+		for i := range volumes.Items {
+			pv := &volumes.Items[i]
+			if claim := pv.Spec.ClaimRef; claim != nil && claim.Namespace == namespace {
+				g.node("PersistentVolume", "", pv.Name, string(pv.Status.Phase))
+			}
+		}
+	}
+
+	// Workloads, controllers first
+	apps := km.clientset.AppsV1()
+	deployments, err := km.listDeployments(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, d := range deployments {
+		g.object("Deployment", d, fmt.Sprintf("%d/%d ready", d.Status.ReadyReplicas, d.Status.Replicas))
+	}
+	statefulSets, err := apps.StatefulSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for i := range statefulSets.Items {
+		s := &statefulSets.Items[i]
+		g.object("StatefulSet", s, fmt.Sprintf("%d/%d ready", s.Status.ReadyReplicas, s.Status.Replicas))
+	}
+	daemonSets, err := apps.DaemonSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	for i := range daemonSets.Items {
+		ds := &daemonSets.Items[i]
+		g.object("DaemonSet", ds, fmt.Sprintf("%d/%d ready", ds.Status.NumberReady, ds.Status.DesiredNumberScheduled))
+	}
+	replicaSets, err := apps.ReplicaSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicasets: %w", err)
+	}
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		g.object("ReplicaSet", rs, fmt.Sprintf("%d/%d ready", rs.Status.ReadyReplicas, rs.Status.Replicas))
+	}
+	cronJobs, err := km.clientset.BatchV1().CronJobs(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cronjobs: %w", err)
+	}
+	for i := range cronJobs.Items {
+		g.object("CronJob", &cronJobs.Items[i], "")
+	}
+	jobs, err := km.clientset.BatchV1().Jobs(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		g.object("Job", job, toJobInfo(job).Status)
+	}
+
+	pods, err := km.listPods(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	for _, pod := range pods {
+		id := g.object("Pod", pod, string(pod.Status.Phase))
+		podReferences(g, id, pod)
+	}
+
+	// Networking
+	services, err := km.listServices(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, svc := range services {
+		id := g.object("Service", svc, string(svc.Spec.Type))
+		if len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		selector := labels.SelectorFromSet(svc.Spec.Selector)
+		for _, pod := range pods {
+			if selector.Matches(labels.Set(pod.Labels)) {
+				g.edge(id, nodeID("Pod", namespace, pod.Name), EdgeSelects)
+			}
+		}
+	}
+	slices, err := km.clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list endpointslices: %w", err)
+	}
+	for i := range slices.Items {
+		slice := &slices.Items[i]
+		id := g.object("EndpointSlice", slice, fmt.Sprintf("%d endpoints", len(slice.Endpoints)))
+		for _, endpoint := range slice.Endpoints {
+			if target := endpoint.TargetRef; target != nil && target.Kind == "Pod" {
+				g.ref(id, "Pod", namespace, target.Name, EdgeTargets)
+			}
+		}
+	}
+	ingresses, err := km.clientset.NetworkingV1().Ingresses(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+	for i := range ingresses.Items {
+		ing := &ingresses.Items[i]
+		id := g.object("Ingress", ing, "")
+		if backend := ing.Spec.DefaultBackend; backend != nil && backend.Service != nil {
+			g.ref(id, "Service", namespace, backend.Service.Name, EdgeRoutes)
+		}
+		for _, rule := range ing.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				if path.Backend.Service != nil {
+					g.ref(id, "Service", namespace, path.Backend.Service.Name, EdgeRoutes)
+				}
+			}
+		}
+		for _, tls := range ing.Spec.TLS {
+			if tls.SecretName != "" {
+				g.ref(id, "Secret", namespace, tls.SecretName, EdgeUses)
+			}
+		}
+	}
+	return g, nil
+}
+
+// podReferences links a pod to the ConfigMaps, Secrets and claims it needs.
+func podReferences(g *graphBuilder, id string, pod *corev1.Pod) {
+	ns := pod.Namespace
+	for _, volume := range pod.Spec.Volumes {
+		switch {
+		case volume.ConfigMap != nil:
+			g.ref(id, "ConfigMap", ns, volume.ConfigMap.Name, EdgeMounts)
+		case volume.Secret != nil:
+			g.ref(id, "Secret", ns, volume.Secret.SecretName, EdgeMounts)
+		case volume.PersistentVolumeClaim != nil:
+			g.ref(id, "PersistentVolumeClaim", ns, volume.PersistentVolumeClaim.ClaimName, EdgeMounts)
+		case volume.Projected != nil:
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					g.ref(id, "ConfigMap", ns, source.ConfigMap.Name, EdgeMounts)
+				}
+				if source.Secret != nil {
+					g.ref(id, "Secret", ns, source.Secret.Name, EdgeMounts)
+				}
+			}
+		}
+	}
+
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+				g.ref(id, "ConfigMap", ns, ref.Name, EdgeUses)
+			}
+			if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+				g.ref(id, "Secret", ns, ref.Name, EdgeUses)
+			}
+		}
+		for _, source := range container.EnvFrom {
+			if source.ConfigMapRef != nil {
+				g.ref(id, "ConfigMap", ns, source.ConfigMapRef.Name, EdgeUses)
+			}
+			if source.SecretRef != nil {
+				g.ref(id, "Secret", ns, source.SecretRef.Name, EdgeUses)
+			}
+		}
+	}
+	for _, ref := range pod.Spec.ImagePullSecrets {
+		g.ref(id, "Secret", ns, ref.Name, EdgeUses)
+	}
+}
@@ -0,0 +1,375 @@
+package kubernetes
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// helmReleaseSecretType is the type of the secrets Helm 3 stores each
+// release revision in, as base64 of gzipped JSON under "release".
+const helmReleaseSecretType = "helm.sh/release.v1"
+
+type HelmRelease struct {
+	Name         string    `json:"name"`
+	Namespace    string    `json:"namespace"`
+	Revision     int       `json:"revision"`
+	Status       string    `json:"status"` // deployed, failed, superseded, uninstalled, pending-*
+	Chart        string    `json:"chart"`  // name-version, like helm list
+	ChartName    string    `json:"chart_name"`
+	ChartVersion string    `json:"chart_version"`
+	AppVersion   string    `json:"app_version"`
+	Updated      time.Time `json:"updated"`
+	Description  string    `json:"description"`
+}
+
+type HelmHook struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"`
+	Path     string   `json:"path"` // template in the chart
+	Events   []string `json:"events"`
+	Manifest string   `json:"manifest"`
+}
+
+// HelmReleaseDetail is one revision of a release. Values are the values
+// supplied by the user; ComputedValues merges them over the chart defaults.
+// Unless secrets are shown, Secret values in manifests and values under
+// secret-like keys are replaced by digests.
+type HelmReleaseDetail struct {
+	HelmRelease
+	Values         map[string]interface{} `json:"values"`
+	ComputedValues map[string]interface{} `json:"computed_values"`
+	Manifest       string                 `json:"manifest"`
+	Notes          string                 `json:"notes"`
+	Hooks          []HelmHook             `json:"hooks"`
+}
+
+// helmRecord is the part of Helm's release JSON the IDE reads.
+type helmRecord struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int    `json:"version"`
+	Info      struct {
+		LastDeployed helmTime `json:"last_deployed"`
+		Description  string   `json:"description"`
+		Status       string   `json:"status"`
+		Notes        string   `json:"notes"`
+	} `json:"info"`
+	Chart struct {
+		Metadata struct {
+			Name       string `json:"name"`
+			Version    string `json:"version"`
+			AppVersion string `json:"appVersion"`
+		} `json:"metadata"`
+		Values map[string]interface{} `json:"values"`
+	} `json:"chart"`
+	Config   map[string]interface{} `json:"config"`
+	Manifest string                 `json:"manifest"`
+	Hooks    []struct {
+		Name     string   `json:"name"`
+		Kind     string   `json:"kind"`
+		Path     string   `json:"path"`
+		Manifest string   `json:"manifest"`
+		Events   []string `json:"events"`
+	} `json:"hooks"`
+}
+
+// helmTime accepts the empty string Helm writes for unset times.
+type helmTime struct {
+	time.Time
+}
+
+func (t *helmTime) UnmarshalJSON(data []byte) error {
+	if string(data) == `""` || string(data) == "null" {
+		return nil
+	}
+	return t.Time.UnmarshalJSON(data)
+}
+
+// ListHelmReleases returns the latest revision of every release in a
+// namespace, or all namespaces, uninstalled releases kept with
+// --keep-history included.
+func (km *K8sManager) ListHelmReleases(namespace string) ([]HelmRelease, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	records, err := km.helmRecords(namespace, "")
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]*helmRecord)
+	for _, r := range records {
+		key := r.Namespace + "/" + r.Name
+		if current, ok := latest[key]; !ok || r.Version > current.Version {
+			latest[key] = r
+		}
+	}
+
+	result := make([]HelmRelease, 0, len(latest))
+	for _, r := range latest {
+		result = append(result, r.release())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// HelmHistory returns every stored revision of a release, oldest first.
+func (km *K8sManager) HelmHistory(namespace, name string) ([]HelmRelease, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	records, err := km.helmRecords(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, notFoundError(fmt.Sprintf("release %s not found in namespace %s", name, namespace))
+	}
+	result := make([]HelmRelease, 0, len(records))
+	for _, r := range records {
+		result = append(result, r.release())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Revision < result[j].Revision })
+	return result, nil
+}
+
+// GetHelmRelease returns one revision of a release, with secrets masked
+// unless showSecrets is set; revision 0 is the
+// latest.
+func (km *K8sManager) GetHelmRelease(namespace, name string, revision int, showSecrets bool) (*HelmReleaseDetail, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	records, err := km.helmRecords(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	var found *helmRecord
+	for _, r := range records {
+		if (revision == 0 && (found == nil || r.Version > found.Version)) || r.Version == revision {
+			found = r
+		}
+	}
+	if found == nil {
+		if revision == 0 {
+			return nil, notFoundError(fmt.Sprintf("release %s not found in namespace %s", name, namespace))
+		}
+		return nil, notFoundError(fmt.Sprintf("revision %d of release %s not found in namespace %s", revision, name, namespace))
+	}
+	return found.detail(showSecrets), nil
+}
+
+// helmRecords decodes the stored revisions of one release, or of all
+// releases when name is empty. Secrets that fail to decode are skipped.
+func (km *K8sManager) helmRecords(namespace, name string) ([]*helmRecord, error) {
+	set := labels.Set{"owner": "helm"}
+	if name != "" {
+		set["name"] = name
+	}
+	secrets, err := km.clientset.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: set.String(),
+		FieldSelector: "type=" + helmReleaseSecretType,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list helm release secrets: %w", err)
+	}
+
+	records := make([]*helmRecord, 0, len(secrets.Items))
+	for i := range secrets.Items {
+		r, err := decodeHelmRelease(&secrets.Items[i])
+		if err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func decodeHelmRelease(secret *corev1.Secret) (*helmRecord, error) {
+	data, err := base64.StdEncoding.DecodeString(string(secret.Data["release"]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode release %s: %w", secret.Name, err)
+	}
+	// Helm gzips releases; very old ones were stored plain
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress release %s: %w", secret.Name, err)
+		}
+		defer reader.Close()
+		if data, err = io.ReadAll(reader); err != nil {
+			return nil, fmt.Errorf("failed to decompress release %s: %w", secret.Name, err)
+		}
+	}
+
+	var r helmRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse release %s: %w", secret.Name, err)
+	}
+	if r.Namespace == "" {
+		r.Namespace = secret.Namespace
+	}
+	// The status label is updated in place, e.g. to superseded
+	if status := secret.Labels["status"]; status != "" {
+		r.Info.Status = status
+	}
+	if r.Version == 0 {
+		r.Version, _ = strconv.Atoi(secret.Labels["version"])
+	}
+	return &r, nil
+}
+
+func (r *helmRecord) release() HelmRelease {
+	chart := r.Chart.Metadata
+	return HelmRelease{
+		Name:         r.Name,
+		Namespace:    r.Namespace,
+		Revision:     r.Version,
+		Status:       r.Info.Status,
+		Chart:        chart.Name + "-" + chart.Version,
+		ChartName:    chart.Name,
+		ChartVersion: chart.Version,
+		AppVersion:   chart.AppVersion,
+		Updated:      r.Info.LastDeployed.Time,
+		Description:  r.Info.Description,
+	}
+}
+
+func (r *helmRecord) detail(showSecrets bool) *HelmReleaseDetail {
+	values := r.Config
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	detail := &HelmReleaseDetail{
+		HelmRelease:    r.release(),
+		Values:         values,
+		ComputedValues: coalesceValues(r.Chart.Values, values),
+		Manifest:       r.Manifest,
+		Notes:          r.Info.Notes,
+		Hooks:          make([]HelmHook, 0, len(r.Hooks)),
+	}
+	for _, h := range r.Hooks {
+		detail.Hooks = append(detail.Hooks, HelmHook{Name: h.Name, Kind: h.Kind, Path: h.Path, Events: h.Events, Manifest: h.Manifest})
+	}
+	if !showSecrets {
+		detail.Values = maskSecretKeys(detail.Values, false)
+		detail.ComputedValues = maskSecretKeys(detail.ComputedValues, false)
+		detail.Manifest = maskManifestSecrets(detail.Manifest)
+		for i := range detail.Hooks {
+			detail.Hooks[i].Manifest = maskManifestSecrets(detail.Hooks[i].Manifest)
+		}
+	}
+	return detail
+}
+
+// secretKeyPattern matches value keys that usually hold credentials, like
+// adminPassword, apiKey or auth.existingSecret.
+var secretKeyPattern = regexp.MustCompile(`(?i)(passw(or)?d|pwd|secret|token|api_?key|private_?key|access_?key|credential)`)
+
+// maskSecretKeys returns a copy of values where the values under
+// secret-like keys, or every value when masked is set, are digests.
+func maskSecretKeys(values map[string]interface{}, masked bool) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		result[key] = maskSecretValue(value, masked || secretKeyPattern.MatchString(key))
+	}
+	return result
+}
+
+func maskSecretValue(value interface{}, masked bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return maskSecretKeys(v, masked)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = maskSecretValue(item, masked)
+		}
+		return items
+	case nil, bool:
+		return v
+	}
+	if masked {
+		return maskValue(value)
+	}
+	return value
+}
+
+// manifestSeparator splits a rendered manifest into its documents.
+var manifestSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// maskManifestSecrets masks the values of the Secrets of a rendered
+// manifest. Other documents, and the comments before a Secret such as
+// "# Source:", are kept as they are.
+func maskManifestSecrets(manifest string) string {
+	docs := manifestSeparator.Split(manifest, -1)
+	for i, doc := range docs {
+		var raw map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &raw); err != nil {
+			continue
+		}
+		obj := &unstructured.Unstructured{Object: raw}
+		if obj.GetKind() != "Secret" {
+			continue
+		}
+		masked, err := objectYAML(maskSecretValues(obj))
+		if err != nil {
+			continue
+		}
+		var header strings.Builder
+		for _, line := range strings.SplitAfter(doc, "\n") {
+			if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				break
+			}
+			header.WriteString(line)
+		}
+		docs[i] = header.String() + masked
+	}
+	return strings.Join(docs, "---")
+}
+
+// coalesceValues merges user values over chart defaults like Helm: maps
+// merge recursively, other values replace, and null deletes a default.
+func coalesceValues(defaults, values map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(defaults)+len(values))
+	for key, value := range defaults {
+		result[key] = value
+	}
+	for key, value := range values {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		userMap, userIsMap := value.(map[string]interface{})
+		defaultMap, defaultIsMap := result[key].(map[string]interface{})
+		if userIsMap && defaultIsMap {
+			result[key] = coalesceValues(defaultMap, userMap)
+		} else {
+			result[key] = value
+		}
+	}
+	return result
+}
@@ -0,0 +1,373 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// HelmBinary is the helm executable that installs and changes releases.
+// Reading releases does not need it.
+var HelmBinary = "helm"
+
+type HelmChartOptions struct {
+	Namespace       string                 `json:"namespace"`
+	Release         string                 `json:"release"`
+	Chart           string                 `json:"chart"` // local chart directory or packaged .tgz
+	Values          map[string]interface{} `json:"values"`
+	ValuesFiles     []string               `json:"values_files"`
+	ReuseValues     bool                   `json:"reuse_values"` // upgrades start from the current values
+	CreateNamespace bool                   `json:"create_namespace"`
+	Wait            bool                   `json:"wait"`    // wait until resources are ready
+	Timeout         time.Duration          `json:"timeout"` // helm default of five minutes when zero
+	DryRun          bool                   `json:"dry_run"`
+}
+
+// InstallHelmChart installs a local chart as a new release and returns it
+// with secrets masked.
+func (km *K8sManager) InstallHelmChart(ctx context.Context, opts HelmChartOptions) (*HelmReleaseDetail, error) {
+	r, err := km.runHelmChart(ctx, "install", opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.detail(false), nil
+}
+
+// UpgradeHelmRelease upgrades a release to a local chart, installing it
+// when missing, and returns it with secrets masked.
+func (km *K8sManager) UpgradeHelmRelease(ctx context.Context, opts HelmChartOptions) (*HelmReleaseDetail, error) {
+	r, err := km.runHelmChart(ctx, "upgrade", opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.detail(false), nil
+}
+
+// DiffHelmUpgrade renders an upgrade in dry-run mode and diffs its
+// manifest, object by object, against the current revision of the release.
+// Hooks are not compared. Both manifests are compared unmasked; the diff
+// masks Secret values itself.
+func (km *K8sManager) DiffHelmUpgrade(ctx context.Context, opts HelmChartOptions) ([]ObjectDiff, DiffSummary, error) {
+	var summary DiffSummary
+	opts.DryRun = true
+	next, err := km.runHelmChart(ctx, "upgrade", opts)
+	if err != nil {
+		return nil, summary, err
+	}
+
+	var current string
+	records, err := km.helmRecords(helmNamespace(opts.Namespace), opts.Release)
+	if err != nil {
+		return nil, summary, err
+	}
+	latest := 0
+	for _, r := range records {
+		if r.Version > latest && r.Info.Status != "uninstalled" {
+			latest, current = r.Version, r.Manifest
+		}
+	}
+	return diffManifests(current, next.Manifest, helmNamespace(opts.Namespace))
+}
+
+// runHelmChart installs or upgrades a release and returns helm's record of
+// it, unmasked.
+func (km *K8sManager) runHelmChart(ctx context.Context, action string, opts HelmChartOptions) (*helmRecord, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	if opts.Release == "" || opts.Chart == "" {
+		return nil, apierrors.NewBadRequest("release and chart are required")
+	}
+	if err := validateReleaseName(opts.Release); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(opts.Chart); err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("chart %s not found: %v", opts.Chart, err))
+	}
+
+	args := []string{action, "--namespace", helmNamespace(opts.Namespace), "--output", "json"}
+	if action == "upgrade" {
+		args = append(args, "--install")
+		if opts.ReuseValues {
+			args = append(args, "--reuse-values")
+		}
+	}
+	if opts.CreateNamespace {
+		args = append(args, "--create-namespace")
+	}
+	if opts.DryRun {
+		args = append(args, "--dry-run")
+	}
+	args = append(args, helmWaitFlags(opts.Wait, opts.Timeout)...)
+	for _, file := range opts.ValuesFiles {
+		args = append(args, "--values", file)
+	}
+	// Inline values are passed last so they override the files
+	if len(opts.Values) > 0 {
+		file, err := writeHelmValues(opts.Values)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(file)
+		args = append(args, "--values", file)
+	}
+	args = append(args, "--", opts.Release, opts.Chart)
+
+	out, err := km.runHelm(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	var r helmRecord
+	if err := json.Unmarshal(out, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse helm output: %w", err)
+	}
+	if !opts.DryRun {
+		logrus.Infof("Helm %s of release %s in namespace %s: revision %d %s", action, r.Name, r.Namespace, r.Version, r.Info.Status)
+	}
+	return &r, nil
+}
+
+// RollbackHelmRelease rolls a release back to a revision; revision 0 is
+// the previous one.
+func (km *K8sManager) RollbackHelmRelease(ctx context.Context, namespace, name string, revision int, wait bool, timeout time.Duration) (*HelmReleaseDetail, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	if err := validateReleaseName(name); err != nil {
+		return nil, err
+	}
+
+	args := []string{"rollback", "--namespace", helmNamespace(namespace)}
+	args = append(args, helmWaitFlags(wait, timeout)...)
+	args = append(args, "--", name)
+	if revision > 0 {
+		args = append(args, strconv.Itoa(revision))
+	}
+	if _, err := km.runHelm(ctx, args...); err != nil {
+		return nil, err
+	}
+	logrus.Infof("Rolled back release %s in namespace %s", name, helmNamespace(namespace))
+	return km.GetHelmRelease(helmNamespace(namespace), name, 0, false)
+}
+
+// UninstallHelmRelease removes a release and its resources. keepHistory
+// keeps the release secrets so the release can be rolled back.
+func (km *K8sManager) UninstallHelmRelease(ctx context.Context, namespace, name string, keepHistory bool) error {
+	if !km.IsConnected() {
+		return fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	if err := validateReleaseName(name); err != nil {
+		return err
+	}
+
+	args := []string{"uninstall", "--namespace", helmNamespace(namespace)}
+	if keepHistory {
+		args = append(args, "--keep-history")
+	}
+	args = append(args, "--", name)
+	if _, err := km.runHelm(ctx, args...); err != nil {
+		return err
+	}
+	logrus.Infof("Uninstalled release %s in namespace %s", name, helmNamespace(namespace))
+	return nil
+}
+
+// runHelm runs the helm CLI against the manager's cluster and returns its
+// standard output. args start with the helm command; positional arguments
+// follow "--" so they are never read as flags.
+func (km *K8sManager) runHelm(ctx context.Context, args ...string) ([]byte, error) {
+	if len(km.kubeconfig) > 0 && km.context != "" {
+		args = append([]string{args[0], "--kube-context", km.context}, args[1:]...)
+	}
+	cmd := exec.CommandContext(ctx, HelmBinary, args...)
+	if len(km.kubeconfig) > 0 {
+		cmd.Env = append(os.Environ(), "KUBECONFIG="+strings.Join(km.kubeconfig, string(os.PathListSeparator)))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("helm executable %s not found, install helm or set kubernetes.helmPath", HelmBinary)
+		}
+		// Helm explains why it rejected the request
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("helm %s failed: %s", args[0], strings.TrimPrefix(msg, "Error: ")))
+		}
+		return nil, fmt.Errorf("helm %s failed: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// maxReleaseNameLength is the longest release name Helm accepts.
+const maxReleaseNameLength = 53
+
+// validateReleaseName checks a release name like Helm does: a DNS-1123
+// subdomain of at most 53 characters, which also rules out a leading "-".
+func validateReleaseName(name string) error {
+	if len(name) > maxReleaseNameLength {
+		return apierrors.NewBadRequest(fmt.Sprintf("invalid release name %q: must be at most %d characters", name, maxReleaseNameLength))
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return apierrors.NewBadRequest(fmt.Sprintf("invalid release name %q: %s", name, strings.Join(errs, "; ")))
+	}
+	return nil
+}
+
+func helmNamespace(namespace string) string {
+	if namespace == "" {
+		return "default"
+	}
+	return namespace
+}
+
+func helmWaitFlags(wait bool, timeout time.Duration) []string {
+	var flags []string
+	if wait {
+		flags = append(flags, "--wait")
+	}
+	if timeout > 0 {
+		flags = append(flags, "--timeout", timeout.String())
+	}
+	return flags
+}
+
+// writeHelmValues stores values in a temporary file for --values; JSON is
+// valid YAML. The caller removes the file.
+func writeHelmValues(values map[string]interface{}) (string, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode values: %w", err)
+	}
+	file, err := os.CreateTemp("", "helm-values-*.json")
+	if err != nil {
+		return "", fmt.Errorf("failed to write values: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write values: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// diffManifests compares two rendered manifests object by object. Objects
+// without a namespace are placed in namespace, as Helm does on install.
+func diffManifests(from, to, namespace string) ([]ObjectDiff, DiffSummary, error) {
+	var summary DiffSummary
+	index := func(manifest string) (map[string]*unstructured.Unstructured, []string, error) {
+		objects, err := decodeManifest(manifest)
+		if err != nil {
+			return nil, nil, err
+		}
+		byKey := make(map[string]*unstructured.Unstructured, len(objects))
+		var keys []string
+		for _, obj := range objects {
+			ns := obj.GetNamespace()
+			if ns == "" {
+				ns = namespace
+			}
+			key := obj.GroupVersionKind().GroupKind().String() + "/" + ns + "/" + obj.GetName()
+			if _, dup := byKey[key]; !dup {
+				keys = append(keys, key)
+			}
+			byKey[key] = obj
+		}
+		return byKey, keys, nil
+	}
+	old, oldKeys, err := index(from)
+	if err != nil {
+		return nil, summary, fmt.Errorf("failed to parse current manifest: %w", err)
+	}
+	next, nextKeys, err := index(to)
+	if err != nil {
+		return nil, summary, fmt.Errorf("failed to parse new manifest: %w", err)
+	}
+
+	var diffs []ObjectDiff
+	compare := func(before, after *unstructured.Unstructured) {
+		obj := after
+		if obj == nil {
+			obj = before
+		}
+		diff := ObjectDiff{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(), Name: obj.GetName(), Namespace: obj.GetNamespace()}
+		var beforeYAML, afterYAML string
+		var err error
+		if before != nil {
+			beforeYAML, err = objectYAML(maskSecretValues(before))
+		}
+		if after != nil && err == nil {
+			afterYAML, err = objectYAML(maskSecretValues(after))
+		}
+		switch {
+		case err != nil:
+			diff.Action, diff.Error = DiffError, err.Error()
+		case before == nil:
+			diff.Action = DiffCreate
+		case after == nil:
+			diff.Action = DiffDelete
+		case beforeYAML == afterYAML:
+			diff.Action = DiffUnchanged
+		default:
+			diff.Action = DiffUpdate
+		}
+		if diff.Action != DiffError && diff.Action != DiffUnchanged {
+			ref := objectRef(obj.GroupVersionKind(), obj.GetName())
+			diff.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        manifestLines(beforeYAML),
+				B:        manifestLines(afterYAML),
+				FromFile: "current/" + ref,
+				ToFile:   "upgrade/" + ref,
+				Context:  3,
+			})
+			if err != nil {
+				diff.Action, diff.Error = DiffError, err.Error()
+			}
+		}
+		switch diff.Action {
+		case DiffCreate:
+			summary.Create++
+		case DiffUpdate:
+			summary.Update++
+		case DiffDelete:
+			summary.Delete++
+		case DiffUnchanged:
+			summary.Unchanged++
+		default:
+			summary.Errors++
+		}
+		diffs = append(diffs, diff)
+	}
+	for _, key := range nextKeys {
+		compare(old[key], next[key])
+	}
+	for _, key := range oldKeys {
+		if _, kept := next[key]; !kept {
+			compare(old[key], nil)
+		}
+	}
+	return diffs, summary, nil
+}
+
+// manifestLines splits an object's YAML for difflib; a missing object has
+// no lines.
+func manifestLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return difflib.SplitLines(text)
+}
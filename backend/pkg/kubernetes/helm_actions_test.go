@@ -0,0 +1,164 @@
+package kubernetes
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+const testSecretManifest = `---
+# Source: app/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+data:
+  password: %s
+`
+
+func secretManifest(password string) string {
+	return strings.Replace(testSecretManifest, "%s", base64.StdEncoding.EncodeToString([]byte(password)), 1)
+}
+
+// helmReleaseJSON is a release as helm prints it with --output json.
+func helmReleaseJSON(t *testing.T, version int, status, manifest string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{
+		"name":      "app",
+		"namespace": "default",
+		"version":   version,
+		"info":      map[string]interface{}{"status": status},
+		"manifest":  manifest,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// newHelmTestManager returns a manager whose API server stores one deployed
+// revision of release "app" with currentManifest, and whose helm binary
+// prints a dry-run upgrade rendering nextManifest.
+func newHelmTestManager(t *testing.T, currentManifest, nextManifest string) *K8sManager {
+	t.Helper()
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(helmReleaseJSON(t, 1, "deployed", currentManifest))
+	w.Close()
+	secrets := corev1.SecretList{Items: []corev1.Secret{{
+		ObjectMeta: metav1.ObjectMeta{Name: "sh.helm.release.v1.app.v1", Namespace: "default", Labels: map[string]string{"owner": "helm", "name": "app"}},
+		Type:       helmReleaseSecretType,
+		Data:       map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(gz.Bytes()))},
+	}}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/nodes":
+			json.NewEncoder(w).Encode(corev1.NodeList{})
+		case "/api/v1/namespaces/default/secrets":
+			json.NewEncoder(w).Encode(secrets)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "release.json")
+	if err := os.WriteFile(output, helmReleaseJSON(t, 2, "pending-upgrade", nextManifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	helm := filepath.Join(dir, "helm")
+	if err := os.WriteFile(helm, []byte("#!/bin/sh\ncat "+output+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	previous := HelmBinary
+	HelmBinary = helm
+	t.Cleanup(func() { HelmBinary = previous })
+
+	km, err := NewK8sManagerForConfig("", &rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return km
+}
+
+func TestDiffHelmUpgradeUnchangedSecret(t *testing.T) {
+	manifest := secretManifest("hunter2")
+	km := newHelmTestManager(t, manifest, manifest)
+
+	diffs, summary, err := km.DiffHelmUpgrade(context.Background(), HelmChartOptions{Release: "app", Chart: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Action != DiffUnchanged {
+		t.Fatalf("diffs = %+v, want one unchanged Secret", diffs)
+	}
+	if summary.Unchanged != 1 || summary.Update != 0 {
+		t.Errorf("summary = %+v", summary)
+	}
+}
+
+func TestDiffHelmUpgradeChangedSecret(t *testing.T) {
+	km := newHelmTestManager(t, secretManifest("hunter2"), secretManifest("correct horse"))
+
+	diffs, _, err := km.DiffHelmUpgrade(context.Background(), HelmChartOptions{Release: "app", Chart: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Action != DiffUpdate {
+		t.Fatalf("diffs = %+v, want one updated Secret", diffs)
+	}
+	for _, value := range []string{"hunter2", "correct horse"} {
+		if strings.Contains(diffs[0].Diff, base64.StdEncoding.EncodeToString([]byte(value))) {
+			t.Errorf("diff reveals %q:\n%s", value, diffs[0].Diff)
+		}
+	}
+}
+
+func TestUpgradeHelmReleaseMasksSecrets(t *testing.T) {
+	manifest := secretManifest("hunter2")
+	km := newHelmTestManager(t, manifest, manifest)
+
+	release, err := km.UpgradeHelmRelease(context.Background(), HelmChartOptions{Release: "app", Chart: t.TempDir(), DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(release.Manifest, base64.StdEncoding.EncodeToString([]byte("hunter2"))) {
+		t.Errorf("manifest reveals the secret:\n%s", release.Manifest)
+	}
+	if !strings.Contains(release.Manifest, "# Source: app/templates/secret.yaml") {
+		t.Errorf("manifest lost its source comment:\n%s", release.Manifest)
+	}
+}
+
+func TestValidateReleaseName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"app":                   true,
+		"my-app.v2":             true,
+		"-app":                  false,
+		"App":                   false,
+		"app_1":                 false,
+		"":                      false,
+		strings.Repeat("a", 53): true,
+		strings.Repeat("a", 54): false,
+	} {
+		if err := validateReleaseName(name); (err == nil) != valid {
+			t.Errorf("validateReleaseName(%q) = %v, want valid %t", name, err, valid)
+		}
+	}
+}
@@ -2,37 +2,103 @@ package kubernetes
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"path/filepath"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 )
 
 type K8sManager struct {
+	context       string   // kubeconfig context, empty for the ambient config
+	kubeconfig    []string // files the context was loaded from, for CLI tools
 	clientset     *kubernetes.Clientset
 	dynamicClient dynamic.Interface
+	metadata      metadata.Interface // object metadata only, e.g. to list secrets without data
+	discovery     discovery.CachedDiscoveryInterface
+	mapper        *restmapper.DeferredDiscoveryRESTMapper
 	config        *rest.Config
 	connected     bool
+
+	// IsConnected caches its probe; watch errors invalidate it
+	healthMu      sync.Mutex
+	healthy       bool
+	healthChecked time.Time
+
+	cache *resourceCache
+
+	// Decoded OpenAPI documents by URL, which changes with their hash
+	openapiMu   sync.Mutex
+	openapiDocs map[string]*openAPIDocument
+
+	forwardsMu sync.Mutex
+	forwards   map[string]*portForward
 }
 
+// PodInfo describes a pod like kubectl get pods: Status is the display
+// status (CrashLoopBackOff, Init:1/2, Terminating, ...) and Restarts the
+// total over all containers.
 type PodInfo struct {
-	Name      string            `json:"name"`
-	Namespace string            `json:"namespace"`
-	Status    string            `json:"status"`
-	Ready     string            `json:"ready"`
-	Restarts  int32             `json:"restarts"`
-	Age       string            `json:"age"`
-	Node      string            `json:"node"`
-	Labels    map[string]string `json:"labels"`
-	IP        string            `json:"ip"`
+	Name           string            `json:"name"`
+	Namespace      string            `json:"namespace"`
+	Status         string            `json:"status"`
+	Phase          string            `json:"phase"`
+	Ready          string            `json:"ready"`
+	Restarts       int32             `json:"restarts"`
+	Age            string            `json:"age"`
+	Created        time.Time         `json:"created"`
+	Node           string            `json:"node"`
+	Labels         map[string]string `json:"labels"`
+	IP             string            `json:"ip"`
+	QOSClass       string            `json:"qos_class"`
+	Owner          string            `json:"owner,omitempty"` // controller as Kind/name
+	Containers     []ContainerInfo   `json:"containers"`
+	InitContainers []ContainerInfo   `json:"init_containers,omitempty"`
+	Conditions     []PodCondition    `json:"conditions"`
+}
+
+type ContainerInfo struct {
+	Name       string            `json:"name"`
+	Image      string            `json:"image"`
+	Ready      bool              `json:"ready"`
+	Restarts   int32             `json:"restarts"`
+	State      string            `json:"state"` // waiting, running or terminated
+	Reason     string            `json:"reason,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	ExitCode   *int32            `json:"exit_code,omitempty"`
+	LastReason string            `json:"last_reason,omitempty"` // why the previous run ended, e.g. OOMKilled
+	Sidecar    bool              `json:"sidecar,omitempty"`     // init container that keeps running
+	Requests   map[string]string `json:"requests"`
+	Limits     map[string]string `json:"limits"`
+}
+
+type PodCondition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"last_transition_time"`
+}
+
+type PodList struct {
+	Items    []PodInfo `json:"items"`
+	Continue string    `json:"continue,omitempty"` // token for the next page
 }
 
 type ServiceInfo struct {
@@ -55,14 +121,34 @@ type DeploymentInfo struct {
 	Labels    map[string]string `json:"labels"`
 }
 
+type NamespaceInfo struct {
+	Name   string            `json:"name"`
+	Status string            `json:"status"`
+	Age    string            `json:"age"`
+	Labels map[string]string `json:"labels"`
+}
+
+type EventInfo struct {
+	Namespace string    `json:"namespace"`
+	Type      string    `json:"type"` // Normal or Warning
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Object    string    `json:"object"` // kind/name of the involved object
+	Count     int32     `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Source    string    `json:"source"`
+}
+
 type NodeInfo struct {
-	Name     string            `json:"name"`
-	Status   string            `json:"status"`
-	Roles    []string          `json:"roles"`
-	Age      string            `json:"age"`
-	Version  string            `json:"version"`
-	Labels   map[string]string `json:"labels"`
-	Capacity map[string]string `json:"capacity"`
+	Name        string            `json:"name"`
+	Status      string            `json:"status"`
+	Roles       []string          `json:"roles"`
+	Age         string            `json:"age"`
+	Version     string            `json:"version"`
+	Labels      map[string]string `json:"labels"`
+	Capacity    map[string]string `json:"capacity"`
+	Allocatable map[string]string `json:"allocatable"` // capacity left for pods
 }
 
 func NewK8sManager() (*K8sManager, error) {
@@ -73,17 +159,24 @@ func NewK8sManager() (*K8sManager, error) {
 	// Try to connect using in-cluster config first, then kubeconfig
 	config, err := rest.InClusterConfig()
 	if err != nil {
-		// Not in cluster, try kubeconfig
-		var kubeconfig string
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfig = filepath.Join(home, ".kube", "config")
-		}
-
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+		// Not in cluster, try KUBECONFIG or ~/.kube/config
+		loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{})
+		config, err = loader.ClientConfig()
 		if err != nil {
 			return manager, fmt.Errorf("failed to get kubeconfig: %w", err)
 		}
 	}
+	return NewK8sManagerForConfig("", config)
+}
+
+// NewK8sManagerForConfig creates a manager for a kubeconfig context. No
+// request is made; IsConnected probes the cluster.
+func NewK8sManagerForConfig(contextName string, config *rest.Config) (*K8sManager, error) {
+	manager := &K8sManager{
+		context:   contextName,
+		connected: false,
+	}
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -95,60 +188,121 @@ func NewK8sManager() (*K8sManager, error) {
 		return manager, fmt.Errorf("failed to create dynamic client: %w", err)
 	}
 
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		return manager, fmt.Errorf("failed to create metadata client: %w", err)
+	}
+
 	manager.clientset = clientset
 	manager.dynamicClient = dynamicClient
+	manager.metadata = metadataClient
+	// Discovery is cached; restMapping and resolveResource reset it when a
+	// kind is not found, e.g. new CRDs
+	manager.discovery = memory.NewMemCacheClient(clientset.Discovery())
+	manager.mapper = restmapper.NewDeferredDiscoveryRESTMapper(manager.discovery)
 	manager.config = config
 	manager.connected = true
 
-	logrus.Info("Successfully connected to Kubernetes cluster")
+	logrus.Infof("Kubernetes client ready for %s", config.Host)
 	return manager, nil
 }
 
+// Context returns the kubeconfig context the manager is bound to.
+func (km *K8sManager) Context() string {
+	return km.context
+}
+
+// ServerVersion asks the API server for its version.
+func (km *K8sManager) ServerVersion(ctx context.Context) (string, error) {
+	if !km.connected {
+		return "", fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	return serverVersion(ctx, km.clientset.Discovery().RESTClient())
+}
+
+func serverVersion(ctx context.Context, client rest.Interface) (string, error) {
+	var info version.Info
+	body, err := client.Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return "", fmt.Errorf("failed to decode server version: %w", err)
+	}
+	return info.GitVersion, nil
+}
+
+// notFoundError is a NotFound API error for objects the manager looks up
+// itself, like a revision of a workload, so handlers report them as 404.
+func notFoundError(message string) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusNotFound,
+		Reason:  metav1.StatusReasonNotFound,
+		Message: message,
+	}}
+}
+
+// healthTTL bounds how long a connectivity probe result is reused.
+const healthTTL = 15 * time.Second
+
 func (km *K8sManager) IsConnected() bool {
 	if !km.connected {
 		return false
 	}
 
+	km.healthMu.Lock()
+	defer km.healthMu.Unlock()
+	if time.Since(km.healthChecked) < healthTTL {
+		return km.healthy
+	}
+
 	_, err := km.clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{Limit: 1})
-	return err == nil
+	km.healthy = err == nil
+	km.healthChecked = time.Now()
+	return km.healthy
 }
 
-func (km *K8sManager) ListPods(namespace string) ([]PodInfo, error) {
+// invalidateHealth forces the next IsConnected call to probe the cluster.
+func (km *K8sManager) invalidateHealth() {
+	km.healthMu.Lock()
+	km.healthChecked = time.Time{}
+	km.healthMu.Unlock()
+}
+
+// ListPods lists pods, all at once from the cache, or from the API server
+// when opts has selectors or asks for a page.
+func (km *K8sManager) ListPods(opts ResourceListOptions) (*PodList, error) {
 	if !km.IsConnected() {
 		return nil, fmt.Errorf("not connected to Kubernetes cluster")
 	}
 
-	pods, err := km.clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list pods: %w", err)
-	}
-
-	var result []PodInfo
-	for _, pod := range pods.Items {
-		ready := 0
-		total := len(pod.Status.ContainerStatuses)
-		for _, status := range pod.Status.ContainerStatuses {
-			if status.Ready {
-				ready++
-			}
+	var pods []*corev1.Pod
+	result := &PodList{}
+	if opts.LabelSelector == "" && opts.FieldSelector == "" && opts.Limit == 0 && opts.Continue == "" {
+		cached, err := km.listPods(opts.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods: %w", err)
 		}
-
-		age := time.Since(pod.CreationTimestamp.Time).Round(time.Second).String()
-
-		podInfo := PodInfo{
-			Name:      pod.Name,
-			Namespace: pod.Namespace,
-			Status:    string(pod.Status.Phase),
-			Ready:     fmt.Sprintf("%d/%d", ready, total),
-			Restarts:  pod.Status.ContainerStatuses[0].RestartCount,
-			Age:       age,
-			Node:      pod.Spec.NodeName,
-			Labels:    pod.Labels,
-			IP:        pod.Status.PodIP,
+		pods = cached
+	} else {
+		list, err := km.clientset.CoreV1().Pods(opts.Namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: opts.LabelSelector,
+			FieldSelector: opts.FieldSelector,
+			Limit:         opts.Limit,
+			Continue:      opts.Continue,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods: %w", err)
 		}
-		result = append(result, podInfo)
+		pods = pointers(list.Items)
+		result.Continue = list.Continue
 	}
 
+	result.Items = make([]PodInfo, 0, len(pods))
+	for _, pod := range pods {
+		result.Items = append(result.Items, toPodInfo(pod))
+	}
 	return result, nil
 }
 
@@ -157,33 +311,36 @@ func (km *K8sManager) ListServices(namespace string) ([]ServiceInfo, error) {
 		return nil, fmt.Errorf("not connected to Kubernetes cluster")
 	}
 
-	services, err := km.clientset.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{})
+	services, err := km.listServices(namespace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list services: %w", err)
 	}
 
 	var result []ServiceInfo
-	for _, service := range services.Items {
-		var ports []string
-		for _, port := range service.Spec.Ports {
-			ports = append(ports, fmt.Sprintf("%d:%d/%s", port.Port, port.TargetPort.IntVal, port.Protocol))
-		}
+	for _, service := range services {
+		result = append(result, toServiceInfo(service))
+	}
 
-		age := time.Since(service.CreationTimestamp.Time).Round(time.Second).String()
+	return result, nil
+}
 
-		serviceInfo := ServiceInfo{
-			Name:      service.Name,
-			Namespace: service.Namespace,
-			Type:      string(service.Spec.Type),
-			ClusterIP: service.Spec.ClusterIP,
-			Ports:     ports,
-			Labels:    service.Labels,
-			Age:       age,
-		}
-		result = append(result, serviceInfo)
+func toServiceInfo(service *corev1.Service) ServiceInfo {
+	var ports []string
+	for _, port := range service.Spec.Ports {
+		ports = append(ports, fmt.Sprintf("%d:%d/%s", port.Port, port.TargetPort.IntVal, port.Protocol))
 	}
 
-	return result, nil
+	age := time.Since(service.CreationTimestamp.Time).Round(time.Second).String()
+
+	return ServiceInfo{
+		Name:      service.Name,
+		Namespace: service.Namespace,
+		Type:      string(service.Spec.Type),
+		ClusterIP: service.Spec.ClusterIP,
+		Ports:     ports,
+		Labels:    service.Labels,
+		Age:       age,
+	}
 }
 
 func (km *K8sManager) ListDeployments(namespace string) ([]DeploymentInfo, error) {
@@ -191,106 +348,165 @@ func (km *K8sManager) ListDeployments(namespace string) ([]DeploymentInfo, error
 		return nil, fmt.Errorf("not connected to Kubernetes cluster")
 	}
 
-	deployments, err := km.clientset.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+	deployments, err := km.listDeployments(namespace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list deployments: %w", err)
 	}
 
 	var result []DeploymentInfo
-	for _, deployment := range deployments.Items {
-		age := time.Since(deployment.CreationTimestamp.Time).Round(time.Second).String()
-
-		deploymentInfo := DeploymentInfo{
-			Name:      deployment.Name,
-			Namespace: deployment.Namespace,
-			Replicas:  *deployment.Spec.Replicas,
-			Ready:     deployment.Status.ReadyReplicas,
-			Available: deployment.Status.AvailableReplicas,
-			Age:       age,
-			Labels:    deployment.Labels,
-		}
-		result = append(result, deploymentInfo)
+	for _, deployment := range deployments {
+		result = append(result, toDeploymentInfo(deployment))
 	}
 
 	return result, nil
 }
 
+func toDeploymentInfo(deployment *appsv1.Deployment) DeploymentInfo {
+	age := time.Since(deployment.CreationTimestamp.Time).Round(time.Second).String()
+
+	// spec.replicas defaults to 1 when unset
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	return DeploymentInfo{
+		Name:      deployment.Name,
+		Namespace: deployment.Namespace,
+		Replicas:  replicas,
+		Ready:     deployment.Status.ReadyReplicas,
+		Available: deployment.Status.AvailableReplicas,
+		Age:       age,
+		Labels:    deployment.Labels,
+	}
+}
+
 func (km *K8sManager) ListNodes() ([]NodeInfo, error) {
 	if !km.IsConnected() {
 		return nil, fmt.Errorf("not connected to Kubernetes cluster")
 	}
 
-	nodes, err := km.clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	nodes, err := km.listNodes()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list nodes: %w", err)
 	}
 
 	var result []NodeInfo
-	for _, node := range nodes.Items {
-		var roles []string
-		for key := range node.Labels {
-			if key == "node-role.kubernetes.io/master" || key == "node-role.kubernetes.io/control-plane" {
-				roles = append(roles, "master")
-			} else if key == "node-role.kubernetes.io/worker" {
-				roles = append(roles, "worker")
-			}
+	for _, node := range nodes {
+		result = append(result, toNodeInfo(node))
+	}
+
+	return result, nil
+}
+
+func toNodeInfo(node *corev1.Node) NodeInfo {
+	var roles []string
+	for key := range node.Labels {
+		if key == "node-role.kubernetes.io/master" || key == "node-role.kubernetes.io/control-plane" {
+			roles = append(roles, "master")
+		} else if key == "node-role.kubernetes.io/worker" {
+			roles = append(roles, "worker")
 		}
+	}
 
-		status := "Unknown"
-		for _, condition := range node.Status.Conditions {
-			if condition.Type == corev1.NodeReady {
-				if condition.Status == corev1.ConditionTrue {
-					status = "Ready"
-				} else {
-					status = "NotReady"
-				}
-				break
+	status := "Unknown"
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			if condition.Status == corev1.ConditionTrue {
+				status = "Ready"
+			} else {
+				status = "NotReady"
 			}
+			break
 		}
+	}
 
-		age := time.Since(node.CreationTimestamp.Time).Round(time.Second).String()
-
-		capacity := make(map[string]string)
-		for key, value := range node.Status.Capacity {
-			capacity[string(key)] = value.String()
-		}
+	age := time.Since(node.CreationTimestamp.Time).Round(time.Second).String()
 
-		nodeInfo := NodeInfo{
-			Name:     node.Name,
-			Status:   status,
-			Roles:    roles,
-			Age:      age,
-			Version:  node.Status.NodeInfo.KubeletVersion,
-			Labels:   node.Labels,
-			Capacity: capacity,
-		}
-		result = append(result, nodeInfo)
+	capacity := make(map[string]string)
+	for key, value := range node.Status.Capacity {
+		capacity[string(key)] = value.String()
+	}
+	allocatable := make(map[string]string)
+	for key, value := range node.Status.Allocatable {
+		allocatable[string(key)] = value.String()
 	}
 
-	return result, nil
+	return NodeInfo{
+		Name:        node.Name,
+		Status:      status,
+		Roles:       roles,
+		Age:         age,
+		Version:     node.Status.NodeInfo.KubeletVersion,
+		Labels:      node.Labels,
+		Capacity:    capacity,
+		Allocatable: allocatable,
+	}
 }
 
-func (km *K8sManager) ApplyManifest(manifest string) error {
+func (km *K8sManager) ListNamespaces() ([]NamespaceInfo, error) {
 	if !km.IsConnected() {
-		return fmt.Errorf("not connected to Kubernetes cluster")
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	namespaces, err := km.listNamespaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
 	}
 
-	// This is a simplified implementation
-	// In a real implementation, you would parse the YAML and apply it
-	// For now, we'll just log that we received a manifest
-	logrus.Infof("Received manifest to apply: %s", manifest)
-	return nil
+	var result []NamespaceInfo
+	for _, namespace := range namespaces {
+		result = append(result, toNamespaceInfo(namespace))
+	}
+
+	return result, nil
 }
 
-func (km *K8sManager) DeleteResource(resourceType, name, namespace string) error {
-	if !km.IsConnected() {
-		return fmt.Errorf("not connected to Kubernetes cluster")
+func toNamespaceInfo(namespace *corev1.Namespace) NamespaceInfo {
+	return NamespaceInfo{
+		Name:   namespace.Name,
+		Status: string(namespace.Status.Phase),
+		Age:    time.Since(namespace.CreationTimestamp.Time).Round(time.Second).String(),
+		Labels: namespace.Labels,
+	}
+}
+
+func toEventInfo(event *corev1.Event) EventInfo {
+	// events.k8s.io fills EventTime and Series instead of the legacy fields
+	firstSeen := event.FirstTimestamp.Time
+	if firstSeen.IsZero() {
+		firstSeen = event.EventTime.Time
+	}
+	lastSeen := event.LastTimestamp.Time
+	if event.Series != nil {
+		lastSeen = event.Series.LastObservedTime.Time
+	}
+	if lastSeen.IsZero() {
+		lastSeen = firstSeen
+	}
+	count := event.Count
+	if event.Series != nil {
+		count = event.Series.Count
+	}
+	if count == 0 {
+		count = 1
+	}
+	source := event.Source.Component
+	if source == "" {
+		source = event.ReportingController
 	}
 
-	// This is a simplified implementation
-	// In a real implementation, you would use the appropriate client to delete the resource
-	logrus.Infof("Deleting %s/%s in namespace %s", resourceType, name, namespace)
-	return nil
+	return EventInfo{
+		Namespace: event.Namespace,
+		Type:      event.Type,
+		Reason:    event.Reason,
+		Message:   event.Message,
+		Object:    strings.ToLower(event.InvolvedObject.Kind) + "/" + event.InvolvedObject.Name,
+		Count:     count,
+		FirstSeen: firstSeen,
+		LastSeen:  lastSeen,
+		Source:    source,
+	}
 }
 
 func (km *K8sManager) GetClusterInfo() (map[string]interface{}, error) {
@@ -0,0 +1,216 @@
+package kubernetes
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// defaultContainerAnnotation is the kubectl convention for picking the
+// container of multi-container pods.
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+type LogOptions struct {
+	Container    string     `json:"container"` // empty: default container, or all containers when tailing
+	Previous     bool       `json:"previous"`  // logs of the last terminated instance
+	SinceSeconds *int64     `json:"since_seconds,omitempty"`
+	SinceTime    *time.Time `json:"since_time,omitempty"`
+	TailLines    *int64     `json:"tail_lines,omitempty"`
+	Timestamps   bool       `json:"timestamps"`
+	Follow       bool       `json:"follow"`
+}
+
+// LogLine is one line of container output, or a lifecycle notice when
+// Status is set (a container started or stopped being tailed).
+type LogLine struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Line      string `json:"line,omitempty"`
+	Status    string `json:"status,omitempty"` // started or stopped
+}
+
+type LogHandler func(LogLine)
+
+// StreamPodLogs writes the logs of one container to out until the stream
+// ends or ctx is cancelled.
+func (km *K8sManager) StreamPodLogs(ctx context.Context, namespace, pod string, opts LogOptions, out LogHandler) error {
+	if !km.IsConnected() {
+		return fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	if opts.Container == "" {
+		p, err := km.clientset.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get pod %s: %w", pod, err)
+		}
+		opts.Container = defaultContainer(p)
+	}
+	return km.streamContainerLogs(ctx, namespace, pod, opts, out)
+}
+
+func (km *K8sManager) streamContainerLogs(ctx context.Context, namespace, pod string, opts LogOptions, out LogHandler) error {
+	podLogOpts := &corev1.PodLogOptions{
+		Container:    opts.Container,
+		Previous:     opts.Previous,
+		SinceSeconds: opts.SinceSeconds,
+		TailLines:    opts.TailLines,
+		Timestamps:   opts.Timestamps,
+		Follow:       opts.Follow,
+	}
+	if opts.SinceTime != nil {
+		podLogOpts.SinceTime = &metav1.Time{Time: *opts.SinceTime}
+	}
+
+	stream, err := km.clientset.CoreV1().Pods(namespace).GetLogs(pod, podLogOpts).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to stream logs of %s/%s: %w", pod, opts.Container, err)
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		out(LogLine{Namespace: namespace, Pod: pod, Container: opts.Container, Line: scanner.Text()})
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to read logs of %s/%s: %w", pod, opts.Container, err)
+	}
+	return nil
+}
+
+// TailPods follows the logs of every running container of the pods
+// matching selector, like stern: pods that appear later are picked up,
+// restarted containers are followed again and deleted pods are dropped.
+// It blocks until ctx is cancelled. out is never called concurrently.
+func (km *K8sManager) TailPods(ctx context.Context, namespace, selector string, opts LogOptions, out LogHandler) error {
+	if !km.IsConnected() {
+		return fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	var outMu sync.Mutex
+	emit := func(line LogLine) {
+		outMu.Lock()
+		defer outMu.Unlock()
+		out(line)
+	}
+
+	// A dedicated informer scoped to the selector handles relisting and
+	// reconnection for the lifetime of the tail
+	factory := informers.NewSharedInformerFactoryWithOptions(km.clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) { o.LabelSelector = selector }))
+	informer := factory.Core().V1().Pods().Informer()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	tails := make(map[string]context.CancelFunc) // namespace/pod/container/containerID
+	initial := true
+
+	startTails := func(obj interface{}) {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok || pod.DeletionTimestamp != nil {
+			return
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Running == nil || (opts.Container != "" && status.Name != opts.Container) {
+				continue
+			}
+			key := strings.Join([]string{pod.Namespace, pod.Name, status.Name, status.ContainerID}, "/")
+
+			mu.Lock()
+			if _, running := tails[key]; running {
+				mu.Unlock()
+				continue
+			}
+			tailCtx, cancel := context.WithCancel(ctx)
+			tails[key] = cancel
+			// Pods found at start honour TailLines; later ones are read whole
+			tailOpts := opts
+			tailOpts.Container = status.Name
+			tailOpts.Follow = true
+			tailOpts.Previous = false
+			if !initial {
+				tailOpts.TailLines = nil
+			}
+			mu.Unlock()
+
+			wg.Add(1)
+			go func(pod *corev1.Pod, key string) {
+				defer wg.Done()
+				line := LogLine{Namespace: pod.Namespace, Pod: pod.Name, Container: tailOpts.Container}
+				line.Status = "started"
+				emit(line)
+				err := km.streamContainerLogs(tailCtx, pod.Namespace, pod.Name, tailOpts, emit)
+				if err != nil {
+					logrus.Debugf("Log tail of %s ended: %v", key, err)
+				}
+				line.Status = "stopped"
+				emit(line)
+
+				mu.Lock()
+				delete(tails, key)
+				mu.Unlock()
+				cancel()
+			}(pod, key)
+		}
+	}
+
+	stopTails := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		pod, ok := obj.(*corev1.Pod)
+		if !ok {
+			return
+		}
+		prefix := pod.Namespace + "/" + pod.Name + "/"
+		mu.Lock()
+		defer mu.Unlock()
+		for key, cancel := range tails {
+			if strings.HasPrefix(key, prefix) {
+				cancel()
+			}
+		}
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    startTails,
+		UpdateFunc: func(_, newObj interface{}) { startTails(newObj) },
+		DeleteFunc: stopTails,
+	})
+
+	factory.Start(ctx.Done())
+	// Tails end with ctx; wait for them so out is not called after return
+	defer wg.Wait()
+	defer factory.Shutdown()
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return ctx.Err()
+	}
+	mu.Lock()
+	initial = false
+	mu.Unlock()
+
+	<-ctx.Done()
+	return nil
+}
+
+// defaultContainer picks the container kubectl would use for a pod.
+func defaultContainer(pod *corev1.Pod) string {
+	if name := pod.Annotations[defaultContainerAnnotation]; name != "" {
+		return name
+	}
+	if len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package kubernetes
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+// decodeManifest splits a multi-document YAML or JSON manifest into
+// objects. Empty documents are skipped and List kinds are flattened.
+func decodeManifest(manifest string) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(strings.NewReader(manifest), 4096)
+
+	var objects []*unstructured.Unstructured
+	for i := 1; ; i++ {
+		var raw map[string]interface{}
+		if err := decoder.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse document %d: %w", i, err)
+		}
+		if len(raw) == 0 {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{Object: raw}
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("document %d is missing apiVersion or kind", i)
+		}
+		if obj.IsList() {
+			err := obj.EachListItem(func(item runtime.Object) error {
+				objects = append(objects, item.(*unstructured.Unstructured))
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to read list in document %d: %w", i, err)
+			}
+			continue
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// resourceFor resolves the REST mapping of an object and returns the
+// dynamic client for it. Namespaced objects without a namespace get
+// defaultNamespace; cluster-scoped objects have theirs cleared.
+func (km *K8sManager) resourceFor(obj *unstructured.Unstructured, defaultNamespace string) (dynamic.ResourceInterface, *meta.RESTMapping, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := km.restMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown resource type %s: %w", gvk, err)
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		obj.SetNamespace("")
+		return km.dynamicClient.Resource(mapping.Resource), mapping, nil
+	}
+
+	if obj.GetNamespace() == "" {
+		if defaultNamespace == "" {
+			defaultNamespace = "default"
+		}
+		obj.SetNamespace(defaultNamespace)
+	}
+	return km.dynamicClient.Resource(mapping.Resource).Namespace(obj.GetNamespace()), mapping, nil
+}
+
+// restMapping resolves a kind, rediscovering the API once when it is not
+// found: the discovery cache never expires by itself, so CRDs installed
+// since, or earlier in the same manifest, are otherwise unknown.
+func (km *K8sManager) restMapping(gk schema.GroupKind, version string) (*meta.RESTMapping, error) {
+	mapping, err := km.mapper.RESTMapping(gk, version)
+	if meta.IsNoMatchError(err) {
+		km.mapper.Reset()
+		mapping, err = km.mapper.RESTMapping(gk, version)
+	}
+	return mapping, err
+}
+
+// resolveResource maps a resource type given as a kind, plural, singular
+// or short name, optionally qualified with a group ("deploy",
+// "Deployment", "deployments.apps", "certificates.v1.cert-manager.io").
+func (km *K8sManager) resolveResource(resourceType string) (*meta.RESTMapping, error) {
+	mapping, err := km.lookupResource(resourceType)
+	if meta.IsNoMatchError(err) {
+		km.mapper.Reset()
+		mapping, err = km.lookupResource(resourceType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unknown resource type %q: %w", resourceType, err)
+	}
+	return mapping, nil
+}
+
+func (km *K8sManager) lookupResource(resourceType string) (*meta.RESTMapping, error) {
+	expander := restmapper.NewShortcutExpander(km.mapper, km.discovery, nil)
+	fullGVR, groupResource := schema.ParseResourceArg(strings.ToLower(resourceType))
+
+	var gvk schema.GroupVersionKind
+	var err error
+	if fullGVR != nil {
+		gvk, err = expander.KindFor(*fullGVR)
+	}
+	if gvk.Empty() {
+		gvk, err = expander.KindFor(groupResource.WithVersion(""))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if gvk.Empty() {
+		return nil, &meta.NoResourceMatchError{PartialResource: groupResource.WithVersion("")}
+	}
+	return km.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+// clientFor returns the dynamic client of a mapping, scoped to namespace
+// for namespaced resources. An empty namespace means all namespaces.
+func (km *K8sManager) clientFor(mapping *meta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return km.dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+	}
+	return km.dynamicClient.Resource(mapping.Resource)
+}
+
+// objectRef formats an object as kind/name for messages.
+func objectRef(gvk schema.GroupVersionKind, name string) string {
+	return strings.ToLower(gvk.Kind) + "/" + name
+}
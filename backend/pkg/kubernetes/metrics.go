@@ -0,0 +1,362 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// metrics.k8s.io is served by metrics-server, which is an optional addon
+var (
+	nodeMetricsResource = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "nodes"}
+	podMetricsResource  = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+)
+
+// ResourceUsage compares one resource against what is reserved for it.
+// CPU is in millicores and memory in bytes. Usage and the percentages
+// based on it are nil without metrics.
+type ResourceUsage struct {
+	Allocatable            int64    `json:"allocatable,omitempty"` // nodes only
+	Requests               int64    `json:"requests"`
+	Limits                 int64    `json:"limits"`
+	Usage                  *int64   `json:"usage"`
+	RequestsPercent        *float64 `json:"requests_percent,omitempty"`          // nodes only: requests of allocatable
+	LimitsPercent          *float64 `json:"limits_percent,omitempty"`            // nodes only: limits of allocatable
+	UsagePercent           *float64 `json:"usage_percent,omitempty"`             // nodes only: usage of allocatable
+	UsageOfRequestsPercent *float64 `json:"usage_of_requests_percent,omitempty"` // pods only
+	UsageOfLimitsPercent   *float64 `json:"usage_of_limits_percent,omitempty"`   // pods only
+}
+
+type NodeUsage struct {
+	Name      string        `json:"name"`
+	Pods      int           `json:"pods"` // non-terminated pods
+	CPU       ResourceUsage `json:"cpu"`
+	Memory    ResourceUsage `json:"memory"`
+	Timestamp *time.Time    `json:"timestamp,omitempty"` // when usage was sampled
+}
+
+type ContainerUsage struct {
+	Name   string        `json:"name"`
+	CPU    ResourceUsage `json:"cpu"`
+	Memory ResourceUsage `json:"memory"`
+}
+
+type PodUsage struct {
+	Name       string           `json:"name"`
+	Namespace  string           `json:"namespace"`
+	Node       string           `json:"node"`
+	CPU        ResourceUsage    `json:"cpu"`
+	Memory     ResourceUsage    `json:"memory"`
+	Containers []ContainerUsage `json:"containers"`
+	Timestamp  *time.Time       `json:"timestamp,omitempty"`
+}
+
+// MetricsStatus tells whether usage could be read; requests and limits
+// are reported either way.
+type MetricsStatus struct {
+	MetricsAvailable bool   `json:"metrics_available"`
+	MetricsError     string `json:"metrics_error,omitempty"`
+}
+
+type NodeUsageList struct {
+	MetricsStatus
+	Nodes []NodeUsage `json:"nodes"`
+}
+
+type PodUsageList struct {
+	MetricsStatus
+	Pods []PodUsage `json:"pods"`
+}
+
+// nodeMetrics and podMetrics mirror the metrics.k8s.io/v1beta1 types
+type nodeMetrics struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Timestamp         metav1.Time         `json:"timestamp"`
+	Usage             corev1.ResourceList `json:"usage"`
+}
+
+type podMetrics struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Timestamp         metav1.Time `json:"timestamp"`
+	Containers        []struct {
+		Name  string              `json:"name"`
+		Usage corev1.ResourceList `json:"usage"`
+	} `json:"containers"`
+}
+
+// ListNodeUsage returns allocatable, requested and used CPU and memory of
+// every node. Requests and limits are summed over the pods scheduled there.
+func (km *K8sManager) ListNodeUsage() (*NodeUsageList, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	nodes, err := km.listNodes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	pods, err := km.listPods("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	type reserved struct {
+		pods             int
+		requests, limits corev1.ResourceList
+	}
+	byNode := make(map[string]*reserved)
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || podTerminated(pod) {
+			continue
+		}
+		r, ok := byNode[pod.Spec.NodeName]
+		if !ok {
+			r = &reserved{requests: corev1.ResourceList{}, limits: corev1.ResourceList{}}
+			byNode[pod.Spec.NodeName] = r
+		}
+		requests, limits := podRequestsAndLimits(pod)
+		addResources(r.requests, requests)
+		addResources(r.limits, limits)
+		r.pods++
+	}
+
+	result := &NodeUsageList{Nodes: make([]NodeUsage, 0, len(nodes))}
+	metrics := make(map[string]nodeMetrics)
+	list, err := km.dynamicClient.Resource(nodeMetricsResource).List(context.TODO(), metav1.ListOptions{})
+	result.MetricsStatus = metricsStatus(err)
+	if err == nil {
+		for i := range list.Items {
+			var m nodeMetrics
+			if decodeMetrics(&list.Items[i], &m) == nil {
+				metrics[m.Name] = m
+			}
+		}
+	}
+
+	for _, node := range nodes {
+		usage := NodeUsage{Name: node.Name}
+		r := byNode[node.Name]
+		if r == nil {
+			r = &reserved{}
+		}
+		usage.Pods = r.pods
+		var used corev1.ResourceList
+		if m, ok := metrics[node.Name]; ok {
+			used = m.Usage
+			usage.Timestamp = &m.Timestamp.Time
+		}
+		usage.CPU = nodeResourceUsage(corev1.ResourceCPU, node.Status.Allocatable, r.requests, r.limits, used)
+		usage.Memory = nodeResourceUsage(corev1.ResourceMemory, node.Status.Allocatable, r.requests, r.limits, used)
+		result.Nodes = append(result.Nodes, usage)
+	}
+	return result, nil
+}
+
+// ListPodUsage returns CPU and memory usage of the pods of a namespace, or
+// all namespaces, against their requests and limits.
+func (km *K8sManager) ListPodUsage(namespace string) (*PodUsageList, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	pods, err := km.listPods(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	result := &PodUsageList{Pods: make([]PodUsage, 0, len(pods))}
+	metrics := make(map[string]podMetrics)
+	list, err := km.dynamicClient.Resource(podMetricsResource).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+	result.MetricsStatus = metricsStatus(err)
+	if err == nil {
+		for i := range list.Items {
+			var m podMetrics
+			if decodeMetrics(&list.Items[i], &m) == nil {
+				metrics[m.Namespace+"/"+m.Name] = m
+			}
+		}
+	}
+
+	for _, pod := range pods {
+		if podTerminated(pod) {
+			continue
+		}
+		m, hasMetrics := metrics[pod.Namespace+"/"+pod.Name]
+		containerUsed := make(map[string]corev1.ResourceList)
+		var podUsed corev1.ResourceList
+		if hasMetrics {
+			podUsed = corev1.ResourceList{}
+			for _, c := range m.Containers {
+				containerUsed[c.Name] = c.Usage
+				addResources(podUsed, c.Usage)
+			}
+		}
+
+		requests, limits := podRequestsAndLimits(pod)
+		usage := PodUsage{
+			Name:       pod.Name,
+			Namespace:  pod.Namespace,
+			Node:       pod.Spec.NodeName,
+			CPU:        podResourceUsage(corev1.ResourceCPU, requests, limits, podUsed),
+			Memory:     podResourceUsage(corev1.ResourceMemory, requests, limits, podUsed),
+			Containers: make([]ContainerUsage, 0, len(pod.Spec.Containers)),
+		}
+		if hasMetrics {
+			usage.Timestamp = &m.Timestamp.Time
+		}
+		for _, c := range pod.Spec.Containers {
+			used, ok := containerUsed[c.Name]
+			if !ok && hasMetrics {
+				used = corev1.ResourceList{} // not running yet
+			}
+			usage.Containers = append(usage.Containers, ContainerUsage{
+				Name:   c.Name,
+				CPU:    podResourceUsage(corev1.ResourceCPU, c.Resources.Requests, c.Resources.Limits, used),
+				Memory: podResourceUsage(corev1.ResourceMemory, c.Resources.Requests, c.Resources.Limits, used),
+			})
+		}
+		result.Pods = append(result.Pods, usage)
+	}
+	sort.SliceStable(result.Pods, func(i, j int) bool {
+		if result.Pods[i].Namespace != result.Pods[j].Namespace {
+			return result.Pods[i].Namespace < result.Pods[j].Namespace
+		}
+		return result.Pods[i].Name < result.Pods[j].Name
+	})
+	return result, nil
+}
+
+// metricsStatus turns the error of a metrics.k8s.io list into a status;
+// the API is missing without metrics-server and unavailable while it
+// starts.
+func metricsStatus(err error) MetricsStatus {
+	if err != nil {
+		return MetricsStatus{MetricsError: fmt.Sprintf("metrics-server unavailable: %v", err)}
+	}
+	return MetricsStatus{MetricsAvailable: true}
+}
+
+func decodeMetrics(obj *unstructured.Unstructured, into interface{}) error {
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, into)
+}
+
+func podTerminated(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+// podRequestsAndLimits returns what the scheduler reserves for a pod: the
+// containers and sidecars together, or the largest init container if that
+// is more, plus the pod overhead.
+func podRequestsAndLimits(pod *corev1.Pod) (requests, limits corev1.ResourceList) {
+	requests, limits = corev1.ResourceList{}, corev1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		addResources(requests, c.Resources.Requests)
+		addResources(limits, c.Resources.Limits)
+	}
+
+	sidecarRequests, sidecarLimits := corev1.ResourceList{}, corev1.ResourceList{}
+	for _, c := range pod.Spec.InitContainers {
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			addResources(requests, c.Resources.Requests)
+			addResources(limits, c.Resources.Limits)
+			addResources(sidecarRequests, c.Resources.Requests)
+			addResources(sidecarLimits, c.Resources.Limits)
+			continue
+		}
+		// An init container runs next to the sidecars started before it
+		initRequests, initLimits := sidecarRequests.DeepCopy(), sidecarLimits.DeepCopy()
+		addResources(initRequests, c.Resources.Requests)
+		addResources(initLimits, c.Resources.Limits)
+		maxResources(requests, initRequests)
+		maxResources(limits, initLimits)
+	}
+
+	addResources(requests, pod.Spec.Overhead)
+	for name, quantity := range pod.Spec.Overhead {
+		if limit, ok := limits[name]; ok { // no limit stays no limit
+			limit.Add(quantity)
+			limits[name] = limit
+		}
+	}
+	return requests, limits
+}
+
+func addResources(total, add corev1.ResourceList) {
+	for name, quantity := range add {
+		sum := total[name]
+		sum.Add(quantity)
+		total[name] = sum
+	}
+}
+
+func maxResources(total, other corev1.ResourceList) {
+	for name, quantity := range other {
+		if current, ok := total[name]; !ok || quantity.Cmp(current) > 0 {
+			total[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+// resourceValue is CPU in millicores and anything else in base units.
+func resourceValue(name corev1.ResourceName, list corev1.ResourceList) int64 {
+	quantity, ok := list[name]
+	if !ok {
+		return 0
+	}
+	return quantityValue(name, &quantity)
+}
+
+func quantityValue(name corev1.ResourceName, quantity *resource.Quantity) int64 {
+	if name == corev1.ResourceCPU {
+		return quantity.MilliValue()
+	}
+	return quantity.Value()
+}
+
+func nodeResourceUsage(name corev1.ResourceName, allocatable, requests, limits, used corev1.ResourceList) ResourceUsage {
+	u := ResourceUsage{
+		Allocatable: resourceValue(name, allocatable),
+		Requests:    resourceValue(name, requests),
+		Limits:      resourceValue(name, limits),
+	}
+	u.RequestsPercent = percent(u.Requests, u.Allocatable)
+	u.LimitsPercent = percent(u.Limits, u.Allocatable)
+	if used != nil {
+		value := resourceValue(name, used)
+		u.Usage = &value
+		u.UsagePercent = percent(value, u.Allocatable)
+	}
+	return u
+}
+
+func podResourceUsage(name corev1.ResourceName, requests, limits, used corev1.ResourceList) ResourceUsage {
+	u := ResourceUsage{
+		Requests: resourceValue(name, requests),
+		Limits:   resourceValue(name, limits),
+	}
+	if used != nil {
+		value := resourceValue(name, used)
+		u.Usage = &value
+		u.UsageOfRequestsPercent = percent(value, u.Requests)
+		u.UsageOfLimitsPercent = percent(value, u.Limits)
+	}
+	return u
+}
+
+// percent is nil when there is nothing to compare against.
+func percent(value, of int64) *float64 {
+	if of <= 0 {
+		return nil
+	}
+	p := math.Round(float64(value)/float64(of)*1000) / 10
+	return &p
+}
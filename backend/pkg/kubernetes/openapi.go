@@ -0,0 +1,279 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// schemaCacheTTL is how often the saved schemas are refreshed in full
+const schemaCacheTTL = 24 * time.Hour
+
+// Where ValidateManifest took its schemas from
+const (
+	SchemaSourceCluster = "cluster"
+	SchemaSourceCache   = "cache" // saved from an earlier validation, cluster unreachable
+	SchemaSourceNone    = "none"  // neither, schema checks skipped
+)
+
+// apiSchema is the subset of an OpenAPI v3 schema used for validation.
+type apiSchema struct {
+	Type                 string                `json:"type"`
+	Properties           map[string]*apiSchema `json:"properties"`
+	AdditionalProperties *schemaOrBool         `json:"additionalProperties"`
+	Items                *apiSchema            `json:"items"`
+	Required             []string              `json:"required"`
+	Enum                 []interface{}         `json:"enum"`
+	Ref                  string                `json:"$ref"`
+	AllOf                []*apiSchema          `json:"allOf"`
+	OneOf                []*apiSchema          `json:"oneOf"`
+	IntOrString          bool                  `json:"x-kubernetes-int-or-string"`
+	PreserveUnknown      bool                  `json:"x-kubernetes-preserve-unknown-fields"`
+	EmbeddedResource     bool                  `json:"x-kubernetes-embedded-resource"`
+	GroupVersionKinds    []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind"`
+}
+
+// schemaOrBool is additionalProperties, either a schema or true/false.
+type schemaOrBool struct {
+	Allowed bool
+	Schema  *apiSchema
+}
+
+func (s *schemaOrBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true":
+		s.Allowed = true
+		return nil
+	case "false":
+		return nil
+	}
+	s.Allowed = true
+	return json.Unmarshal(data, &s.Schema)
+}
+
+// openAPIDocument is the schema document of one group version.
+type openAPIDocument struct {
+	Components struct {
+		Schemas map[string]*apiSchema `json:"schemas"`
+	} `json:"components"`
+
+	kinds map[string]*apiSchema // by kind
+}
+
+func decodeOpenAPIDocument(data []byte) (*openAPIDocument, error) {
+	var doc openAPIDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	doc.kinds = make(map[string]*apiSchema)
+	for _, s := range doc.Components.Schemas {
+		for _, gvk := range s.GroupVersionKinds {
+			doc.kinds[gvk.Group+"/"+gvk.Version+"/"+gvk.Kind] = s
+		}
+	}
+	return &doc, nil
+}
+
+// resolve follows $ref and the single-entry allOf Kubernetes wraps
+// references in.
+func (doc *openAPIDocument) resolve(s *apiSchema) *apiSchema {
+	for i := 0; s != nil && i < 32; i++ {
+		switch {
+		case s.Ref != "":
+			s = doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		case len(s.AllOf) == 1 && s.Type == "" && len(s.Properties) == 0:
+			s = s.AllOf[0]
+		default:
+			return s
+		}
+	}
+	return s
+}
+
+// schemaSet gives the schema documents of the group versions served by a
+// cluster, from the cluster or from the disk cache.
+type schemaSet struct {
+	source        string
+	serverVersion string
+	saved         time.Time       // when a cached set was saved
+	paths         map[string]bool // served group versions, e.g. apis/apps/v1
+	load          func(path string) (*openAPIDocument, error)
+	// refresh rediscovers the served group versions, once per validation;
+	// nil for cached sets
+	refresh func()
+}
+
+// groupVersionPath is the OpenAPI v3 path of a group version.
+func groupVersionPath(gv schema.GroupVersion) string {
+	if gv.Group == "" {
+		return "api/" + gv.Version
+	}
+	return "apis/" + gv.Group + "/" + gv.Version
+}
+
+// cachedSchemaIndex is saved next to the documents for offline use.
+type cachedSchemaIndex struct {
+	ServerVersion string    `json:"server_version"`
+	Paths         []string  `json:"paths"`
+	Saved         time.Time `json:"saved"`
+}
+
+// openAPISchemas returns the cluster's schemas, keeping a copy on disk, or
+// the saved copy when the cluster is unreachable.
+func (km *K8sManager) openAPISchemas() *schemaSet {
+	dir := openAPICacheDir(km.context)
+	if km.IsConnected() {
+		set, err := km.clusterSchemas(dir)
+		if err == nil {
+			return set
+		}
+		logrus.Warnf("OpenAPI schemas not available from the cluster: %v", err)
+	}
+	if set, err := cachedSchemas(dir); err == nil {
+		return set
+	}
+	return &schemaSet{source: SchemaSourceNone}
+}
+
+func (km *K8sManager) clusterSchemas(dir string) (*schemaSet, error) {
+	paths, err := km.discovery.OpenAPIV3().Paths()
+	if err != nil {
+		return nil, err
+	}
+	serverVersion, err := km.ServerVersion(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	set := &schemaSet{source: SchemaSourceCluster, serverVersion: serverVersion, paths: make(map[string]bool)}
+	index := cachedSchemaIndex{ServerVersion: serverVersion, Saved: time.Now()}
+	for path := range paths {
+		set.paths[path] = true
+		index.Paths = append(index.Paths, path)
+	}
+	sort.Strings(index.Paths)
+	// Refresh the whole cache daily, so validation works offline for
+	// kinds not validated online yet
+	var refresh bool
+	if saved, err := cachedSchemas(dir); err != nil || saved.saved.Before(time.Now().Add(-schemaCacheTTL)) || saved.serverVersion != serverVersion {
+		refresh = true
+		if err := os.MkdirAll(dir, 0755); err == nil {
+			if data, err := json.Marshal(index); err == nil {
+				os.WriteFile(filepath.Join(dir, "index.json"), data, 0644)
+			}
+		}
+	}
+
+	set.load = func(path string) (*openAPIDocument, error) {
+		km.openapiMu.Lock()
+		defer km.openapiMu.Unlock()
+		gv, ok := paths[path]
+		if !ok {
+			return nil, fmt.Errorf("%s is not served", path)
+		}
+		key := gv.ServerRelativeURL() // changes with the schema hash
+		if doc, ok := km.openapiDocs[key]; ok {
+			return doc, nil
+		}
+		data, err := gv.Schema("application/json")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch schema of %s: %w", path, err)
+		}
+		doc, err := decodeOpenAPIDocument(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse schema of %s: %w", path, err)
+		}
+		if km.openapiDocs == nil {
+			km.openapiDocs = make(map[string]*openAPIDocument)
+		}
+		km.openapiDocs[key] = doc
+		if err := os.WriteFile(filepath.Join(dir, cacheFileName(path)), data, 0644); err != nil {
+			logrus.Debugf("OpenAPI schema of %s not cached: %v", path, err)
+		}
+		return doc, nil
+	}
+	set.refresh = func() {
+		km.mapper.Reset()
+		fresh, err := km.discovery.OpenAPIV3().Paths()
+		if err != nil {
+			return
+		}
+		km.openapiMu.Lock()
+		paths = fresh
+		km.openapiMu.Unlock()
+		for path := range fresh {
+			set.paths[path] = true
+		}
+	}
+	if refresh {
+		go func() {
+			for _, path := range index.Paths {
+				if _, err := set.load(path); err != nil {
+					logrus.Debugf("OpenAPI schema not cached: %v", err)
+				}
+			}
+		}()
+	}
+	return set, nil
+}
+
+func cachedSchemas(dir string) (*schemaSet, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	var index cachedSchemaIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+
+	set := &schemaSet{source: SchemaSourceCache, serverVersion: index.ServerVersion, saved: index.Saved, paths: make(map[string]bool)}
+	for _, path := range index.Paths {
+		set.paths[path] = true
+	}
+	docs := make(map[string]*openAPIDocument)
+	set.load = func(path string) (*openAPIDocument, error) {
+		if doc, ok := docs[path]; ok {
+			return doc, nil
+		}
+		data, err := os.ReadFile(filepath.Join(dir, cacheFileName(path)))
+		if err != nil {
+			return nil, fmt.Errorf("schema of %s is not cached", path)
+		}
+		doc, err := decodeOpenAPIDocument(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cached schema of %s: %w", path, err)
+		}
+		docs[path] = doc
+		return doc, nil
+	}
+	return set, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// openAPICacheDir is where the schemas of a context are saved.
+func openAPICacheDir(contextName string) string {
+	if contextName == "" {
+		contextName = "default"
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".devops-unity", "kubernetes", "openapi", unsafeFileChars.ReplaceAllString(contextName, "_"))
+}
+
+func cacheFileName(path string) string {
+	return unsafeFileChars.ReplaceAllString(path, "_") + ".json"
+}
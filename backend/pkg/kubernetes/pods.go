@@ -0,0 +1,222 @@
+package kubernetes
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nodeLostReason is the pod reason the node lifecycle controller sets on
+// pods of unreachable nodes.
+const nodeLostReason = "NodeLost"
+
+func toPodInfo(pod *corev1.Pod) PodInfo {
+	status, ready, total, restarts := podDisplayStatus(pod)
+
+	info := PodInfo{
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		Status:    status,
+		Phase:     string(pod.Status.Phase),
+		Ready:     fmt.Sprintf("%d/%d", ready, total),
+		Restarts:  restarts,
+		Age:       time.Since(pod.CreationTimestamp.Time).Round(time.Second).String(),
+		Created:   pod.CreationTimestamp.Time,
+		Node:      pod.Spec.NodeName,
+		Labels:    pod.Labels,
+		IP:        pod.Status.PodIP,
+		QOSClass:  string(pod.Status.QOSClass),
+		Owner:     ownerRef(pod),
+	}
+
+	statuses := make(map[string]*corev1.ContainerStatus)
+	for i := range pod.Status.ContainerStatuses {
+		statuses[pod.Status.ContainerStatuses[i].Name] = &pod.Status.ContainerStatuses[i]
+	}
+	info.Containers = make([]ContainerInfo, 0, len(pod.Spec.Containers))
+	for i := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[i]
+		info.Containers = append(info.Containers, toContainerInfo(c, statuses[c.Name]))
+	}
+
+	initStatuses := make(map[string]*corev1.ContainerStatus)
+	for i := range pod.Status.InitContainerStatuses {
+		initStatuses[pod.Status.InitContainerStatuses[i].Name] = &pod.Status.InitContainerStatuses[i]
+	}
+	for i := range pod.Spec.InitContainers {
+		c := &pod.Spec.InitContainers[i]
+		container := toContainerInfo(c, initStatuses[c.Name])
+		container.Sidecar = isSidecar(c)
+		info.InitContainers = append(info.InitContainers, container)
+	}
+
+	info.Conditions = make([]PodCondition, 0, len(pod.Status.Conditions))
+	for _, condition := range pod.Status.Conditions {
+		info.Conditions = append(info.Conditions, PodCondition{
+			Type:               string(condition.Type),
+			Status:             string(condition.Status),
+			Reason:             condition.Reason,
+			Message:            condition.Message,
+			LastTransitionTime: condition.LastTransitionTime.Time,
+		})
+	}
+	return info
+}
+
+// podDisplayStatus computes the STATUS, READY and RESTARTS columns of
+// kubectl get pods. Statuses may be missing entirely, e.g. for pending
+// pods.
+func podDisplayStatus(pod *corev1.Pod) (status string, ready, total int, restarts int32) {
+	status = string(pod.Status.Phase)
+	if pod.Status.Reason != "" {
+		status = pod.Status.Reason
+	}
+	total = len(pod.Spec.Containers)
+
+	sidecars := make(map[string]bool)
+	for i := range pod.Spec.InitContainers {
+		if isSidecar(&pod.Spec.InitContainers[i]) {
+			sidecars[pod.Spec.InitContainers[i].Name] = true
+			total++
+		}
+	}
+
+	// Init containers run in order; the first unfinished one is the status
+	initializing := false
+	var sidecarRestarts int32
+	for i, container := range pod.Status.InitContainerStatuses {
+		restarts += container.RestartCount
+		if sidecars[container.Name] {
+			sidecarRestarts += container.RestartCount
+			if container.Started != nil && *container.Started {
+				if container.Ready {
+					ready++
+				}
+				continue
+			}
+		}
+		state := container.State
+		switch {
+		case state.Terminated != nil && state.Terminated.ExitCode == 0:
+			continue
+		case state.Terminated != nil:
+			switch {
+			case state.Terminated.Reason != "":
+				status = "Init:" + state.Terminated.Reason
+			case state.Terminated.Signal != 0:
+				status = fmt.Sprintf("Init:Signal:%d", state.Terminated.Signal)
+			default:
+				status = fmt.Sprintf("Init:ExitCode:%d", state.Terminated.ExitCode)
+			}
+		case state.Waiting != nil && state.Waiting.Reason != "" && state.Waiting.Reason != "PodInitializing":
+			status = "Init:" + state.Waiting.Reason
+		default:
+			status = fmt.Sprintf("Init:%d/%d", i, len(pod.Spec.InitContainers))
+		}
+		initializing = true
+		break
+	}
+
+	if !initializing || podConditionTrue(pod, corev1.PodInitialized) {
+		// Restarts of init containers that completed no longer count
+		restarts = sidecarRestarts
+		running := false
+		for i := len(pod.Status.ContainerStatuses) - 1; i >= 0; i-- {
+			container := pod.Status.ContainerStatuses[i]
+			restarts += container.RestartCount
+			state := container.State
+			switch {
+			case state.Waiting != nil && state.Waiting.Reason != "":
+				status = state.Waiting.Reason
+			case state.Terminated != nil && state.Terminated.Reason != "":
+				status = state.Terminated.Reason
+			case state.Terminated != nil && state.Terminated.Signal != 0:
+				status = fmt.Sprintf("Signal:%d", state.Terminated.Signal)
+			case state.Terminated != nil:
+				status = fmt.Sprintf("ExitCode:%d", state.Terminated.ExitCode)
+			case container.Ready && state.Running != nil:
+				running = true
+				ready++
+			}
+		}
+		// A completed container does not make a pod with running ones done
+		if status == "Completed" && running {
+			if podConditionTrue(pod, corev1.PodReady) {
+				status = string(corev1.PodRunning)
+			} else {
+				status = "NotReady"
+			}
+		}
+	}
+
+	// Succeeded and Failed pods being deleted keep Completed or Error
+	switch {
+	case pod.DeletionTimestamp != nil && pod.Status.Reason == nodeLostReason:
+		status = string(corev1.PodUnknown)
+	case pod.DeletionTimestamp != nil && !podPhaseTerminal(pod.Status.Phase):
+		status = "Terminating"
+	}
+	return status, ready, total, restarts
+}
+
+// podPhaseTerminal reports whether a pod has finished for good, like
+// IsPodPhaseTerminal of the Kubernetes pod utilities.
+func podPhaseTerminal(phase corev1.PodPhase) bool {
+	return phase == corev1.PodSucceeded || phase == corev1.PodFailed
+}
+
+func toContainerInfo(c *corev1.Container, status *corev1.ContainerStatus) ContainerInfo {
+	info := ContainerInfo{
+		Name:     c.Name,
+		Image:    c.Image,
+		State:    "waiting",
+		Requests: resourceStrings(c.Resources.Requests),
+		Limits:   resourceStrings(c.Resources.Limits),
+	}
+	if status == nil {
+		return info
+	}
+	info.Ready = status.Ready
+	info.Restarts = status.RestartCount
+	switch state := status.State; {
+	case state.Running != nil:
+		info.State = "running"
+	case state.Terminated != nil:
+		info.State = "terminated"
+		info.Reason = state.Terminated.Reason
+		info.Message = state.Terminated.Message
+		exitCode := state.Terminated.ExitCode
+		info.ExitCode = &exitCode
+	case state.Waiting != nil:
+		info.Reason = state.Waiting.Reason
+		info.Message = state.Waiting.Message
+	}
+	if last := status.LastTerminationState.Terminated; last != nil {
+		info.LastReason = last.Reason
+	}
+	return info
+}
+
+// isSidecar reports whether an init container keeps running next to the
+// app containers.
+func isSidecar(c *corev1.Container) bool {
+	return c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways
+}
+
+func podConditionTrue(pod *corev1.Pod, conditionType corev1.PodConditionType) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func resourceStrings(list corev1.ResourceList) map[string]string {
+	result := make(map[string]string, len(list))
+	for name, quantity := range list {
+		result[string(name)] = quantity.String()
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package kubernetes
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodDisplayStatus(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	started := true
+	deleting := metav1.Now()
+	containers := func(names ...string) []corev1.Container {
+		var result []corev1.Container
+		for _, name := range names {
+			result = append(result, corev1.Container{Name: name})
+		}
+		return result
+	}
+	running := func(name string, ready bool, restarts int32) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name, Ready: ready, RestartCount: restarts,
+			State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}
+	}
+	terminated := func(name, reason string, code int32) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: reason, ExitCode: code}}}
+	}
+	initialized := []corev1.PodCondition{{Type: corev1.PodInitialized, Status: corev1.ConditionTrue}}
+
+	tests := []struct {
+		name     string
+		pod      corev1.Pod
+		status   string
+		ready    int
+		total    int
+		restarts int32
+	}{
+		{
+			name: "pending without statuses",
+			pod: corev1.Pod{
+				Spec:   corev1.PodSpec{Containers: containers("app", "proxy")},
+				Status: corev1.PodStatus{Phase: corev1.PodPending},
+			},
+			status: "Pending", total: 2,
+		},
+		{
+			name: "second of three init containers",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{InitContainers: containers("a", "b", "c"), Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodPending,
+					InitContainerStatuses: []corev1.ContainerStatus{
+						terminated("a", "Completed", 0),
+						running("b", false, 0),
+						{Name: "c", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}},
+					},
+					ContainerStatuses: []corev1.ContainerStatus{
+						{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}},
+					},
+				},
+			},
+			status: "Init:1/3", total: 1,
+		},
+		{
+			name: "crash loop",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:      corev1.PodRunning,
+					Conditions: initialized,
+					ContainerStatuses: []corev1.ContainerStatus{{
+						Name:         "app",
+						RestartCount: 5,
+						State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+					}},
+				},
+			},
+			status: "CrashLoopBackOff", total: 1, restarts: 5,
+		},
+		{
+			name: "completed job container with a running sidecar",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "proxy", RestartPolicy: &always}},
+					Containers:     containers("job"),
+				},
+				Status: corev1.PodStatus{
+					Phase:      corev1.PodRunning,
+					Conditions: initialized,
+					InitContainerStatuses: []corev1.ContainerStatus{{
+						Name: "proxy", Ready: true, Started: &started, RestartCount: 1,
+						State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+					}},
+					ContainerStatuses: []corev1.ContainerStatus{terminated("job", "Completed", 0)},
+				},
+			},
+			status: "Completed", ready: 1, total: 2, restarts: 1,
+		},
+		{
+			name: "running pod being deleted",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &deleting},
+				Spec:       corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					Conditions:        initialized,
+					ContainerStatuses: []corev1.ContainerStatus{running("app", true, 0)},
+				},
+			},
+			status: "Terminating", ready: 1, total: 1,
+		},
+		{
+			name: "succeeded pod being deleted",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &deleting},
+				Spec:       corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodSucceeded,
+					Conditions:        initialized,
+					ContainerStatuses: []corev1.ContainerStatus{terminated("app", "Completed", 0)},
+				},
+			},
+			status: "Completed", total: 1,
+		},
+		{
+			name: "failed pod being deleted",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &deleting},
+				Spec:       corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodFailed,
+					Conditions:        initialized,
+					ContainerStatuses: []corev1.ContainerStatus{terminated("app", "Error", 1)},
+				},
+			},
+			status: "Error", total: 1,
+		},
+		{
+			name: "pod on a lost node",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &deleting},
+				Spec:       corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					Reason:            nodeLostReason,
+					Conditions:        initialized,
+					ContainerStatuses: []corev1.ContainerStatus{running("app", true, 0)},
+				},
+			},
+			status: "Unknown", ready: 1, total: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, ready, total, restarts := podDisplayStatus(&tt.pod)
+			if status != tt.status || ready != tt.ready || total != tt.total || restarts != tt.restarts {
+				t.Errorf("podDisplayStatus() = %q %d/%d %d restarts, want %q %d/%d %d restarts",
+					status, ready, total, restarts, tt.status, tt.ready, tt.total, tt.restarts)
+			}
+		})
+	}
+}
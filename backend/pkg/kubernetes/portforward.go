@@ -0,0 +1,388 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// Port-forward states
+const (
+	ForwardStarting     = "starting"
+	ForwardActive       = "active"
+	ForwardReconnecting = "reconnecting" // target pod gone or connection lost
+	ForwardStopped      = "stopped"
+)
+
+// forwardCheckInterval is how often the backing pod is checked.
+const forwardCheckInterval = 5 * time.Second
+
+type PortForwardRequest struct {
+	Namespace  string `json:"namespace"`
+	Target     string `json:"target"`      // pod/<name> or service/<name> (svc/ also accepted)
+	RemotePort string `json:"remote_port"` // port number or name on the pod or service
+	LocalPort  int    `json:"local_port"`  // 0 picks a free port
+	Address    string `json:"address"`     // defaults to localhost
+}
+
+type PortForwardInfo struct {
+	ID         string    `json:"id"`
+	Namespace  string    `json:"namespace"`
+	Target     string    `json:"target"`
+	Pod        string    `json:"pod"` // current backing pod
+	RemotePort int       `json:"remote_port"`
+	LocalPort  int       `json:"local_port"`
+	Address    string    `json:"address"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Started    time.Time `json:"started"`
+}
+
+type portForward struct {
+	request PortForwardRequest
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu   sync.Mutex
+	info PortForwardInfo
+}
+
+func (pf *portForward) update(fn func(info *PortForwardInfo)) {
+	pf.mu.Lock()
+	fn(&pf.info)
+	pf.mu.Unlock()
+}
+
+func (pf *portForward) snapshot() PortForwardInfo {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	return pf.info
+}
+
+// StartPortForward forwards a local port to a pod, or to a ready pod
+// backing a service. It returns once the local listener is up; the forward
+// then follows pod replacements until stopped.
+func (km *K8sManager) StartPortForward(req PortForwardRequest) (*PortForwardInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	if req.Namespace == "" {
+		req.Namespace = "default"
+	}
+	if req.Address == "" {
+		req.Address = "localhost"
+	}
+	if _, _, err := km.resolveForwardTarget(req); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pf := &portForward{
+		request: req,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		info: PortForwardInfo{
+			ID:        uuid.NewString(),
+			Namespace: req.Namespace,
+			Target:    req.Target,
+			LocalPort: req.LocalPort,
+			Address:   req.Address,
+			Status:    ForwardStarting,
+			Started:   time.Now(),
+		},
+	}
+
+	ready := make(chan error, 1)
+	go km.runPortForward(ctx, pf, ready)
+	if err := <-ready; err != nil {
+		cancel()
+		<-pf.done
+		return nil, err
+	}
+
+	km.forwardsMu.Lock()
+	if km.forwards == nil {
+		km.forwards = make(map[string]*portForward)
+	}
+	km.forwards[pf.info.ID] = pf
+	km.forwardsMu.Unlock()
+
+	info := pf.snapshot()
+	logrus.Infof("Forwarding %s:%d to %s/%s:%d", info.Address, info.LocalPort, info.Namespace, info.Pod, info.RemotePort)
+	return &info, nil
+}
+
+// runPortForward keeps the forward alive, re-resolving the target pod
+// whenever it disappears or the connection drops. The first outcome is
+// reported on ready.
+func (km *K8sManager) runPortForward(ctx context.Context, pf *portForward, ready chan<- error) {
+	defer close(pf.done)
+	defer pf.update(func(info *PortForwardInfo) { info.Status = ForwardStopped })
+
+	first := true
+	report := func(err error) {
+		if first {
+			ready <- err
+			first = false
+		}
+	}
+
+	for ctx.Err() == nil {
+		err := km.forwardOnce(ctx, pf, func() { report(nil) })
+		if first {
+			report(err)
+			if err != nil {
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		logrus.Warnf("Port-forward %s interrupted, reconnecting: %v", pf.info.ID, err)
+		pf.update(func(info *PortForwardInfo) {
+			info.Status = ForwardReconnecting
+			if err != nil {
+				info.Error = err.Error()
+			}
+		})
+		select {
+		case <-ctx.Done():
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// forwardOnce forwards to the current backing pod until the pod stops
+// running, the connection is lost or ctx is cancelled.
+func (km *K8sManager) forwardOnce(ctx context.Context, pf *portForward, onReady func()) error {
+	pod, remotePort, err := km.resolveForwardTarget(pf.request)
+	if err != nil {
+		return err
+	}
+
+	pf.mu.Lock()
+	localPort := pf.info.LocalPort
+	pf.mu.Unlock()
+
+	transport, upgrader, err := spdy.RoundTripperFor(km.config)
+	if err != nil {
+		return fmt.Errorf("failed to create port-forward transport: %w", err)
+	}
+	url := km.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(pod.Namespace).Name(pod.Name).SubResource("portforward").URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+
+	stop := make(chan struct{})
+	readyCh := make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{pf.request.Address},
+		[]string{fmt.Sprintf("%d:%d", localPort, remotePort)}, stop, readyCh, io.Discard, io.Discard)
+	if err != nil {
+		return fmt.Errorf("failed to create port-forward: %w", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- forwarder.ForwardPorts() }()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			err = fmt.Errorf("port-forward ended before it was ready")
+		}
+		return err
+	case <-ctx.Done():
+		close(stop)
+		return <-errCh
+	case <-readyCh:
+	}
+
+	// Keep the local port across reconnections, even when it was picked
+	if ports, err := forwarder.GetPorts(); err == nil && len(ports) > 0 {
+		localPort = int(ports[0].Local)
+	}
+	pf.update(func(info *PortForwardInfo) {
+		info.Pod = pod.Name
+		info.RemotePort = remotePort
+		info.LocalPort = localPort
+		info.Status = ForwardActive
+		info.Error = ""
+	})
+	onReady()
+
+	ticker := time.NewTicker(forwardCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-errCh:
+			if err == nil {
+				err = portforward.ErrLostConnectionToPod
+			}
+			return err
+		case <-ctx.Done():
+			close(stop)
+			<-errCh
+			return nil
+		case <-ticker.C:
+			current, err := km.clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+			if err != nil || current.UID != pod.UID ||
+				current.DeletionTimestamp != nil || current.Status.Phase != corev1.PodRunning {
+				close(stop)
+				<-errCh
+				return fmt.Errorf("pod %s is no longer available", pod.Name)
+			}
+		}
+	}
+}
+
+// resolveForwardTarget returns the pod to forward to and the container
+// port, following a service's selector and port mapping.
+func (km *K8sManager) resolveForwardTarget(req PortForwardRequest) (*corev1.Pod, int, error) {
+	kind, name, ok := strings.Cut(req.Target, "/")
+	if !ok || name == "" {
+		return nil, 0, fmt.Errorf("invalid target %q, expected pod/<name> or service/<name>", req.Target)
+	}
+	ctx := context.TODO()
+
+	switch kind {
+	case "pod", "pods", "po":
+		pod, err := km.clientset.CoreV1().Pods(req.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get pod %s: %w", name, err)
+		}
+		if pod.Status.Phase != corev1.PodRunning {
+			return nil, 0, fmt.Errorf("pod %s is not running (%s)", name, pod.Status.Phase)
+		}
+		port, err := containerPort(pod, intstr.Parse(req.RemotePort))
+		return pod, port, err
+
+	case "service", "services", "svc":
+		svc, err := km.clientset.CoreV1().Services(req.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get service %s: %w", name, err)
+		}
+		if len(svc.Spec.Selector) == 0 {
+			return nil, 0, fmt.Errorf("service %s has no selector", name)
+		}
+
+		// Map the service port to its target port
+		targetPort := intstr.Parse(req.RemotePort)
+		for _, sp := range svc.Spec.Ports {
+			if sp.Name == req.RemotePort || strconv.Itoa(int(sp.Port)) == req.RemotePort || (req.RemotePort == "" && len(svc.Spec.Ports) == 1) {
+				targetPort = sp.TargetPort
+				if targetPort.IntValue() == 0 && targetPort.Type == intstr.Int {
+					targetPort = intstr.FromInt32(sp.Port)
+				}
+				break
+			}
+		}
+
+		pods, err := km.clientset.CoreV1().Pods(req.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to list pods of service %s: %w", name, err)
+		}
+		candidates := pointers(pods.Items)
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].CreationTimestamp.Before(&candidates[j].CreationTimestamp)
+		})
+		for _, pod := range candidates {
+			if podReady(pod) {
+				port, err := containerPort(pod, targetPort)
+				return pod, port, err
+			}
+		}
+		return nil, 0, fmt.Errorf("service %s has no ready pod", name)
+
+	default:
+		return nil, 0, fmt.Errorf("cannot forward to %s, expected pod or service", kind)
+	}
+}
+
+// containerPort resolves a numeric or named port against the pod's containers.
+func containerPort(pod *corev1.Pod, port intstr.IntOrString) (int, error) {
+	if port.Type == intstr.Int {
+		if port.IntValue() <= 0 {
+			return 0, fmt.Errorf("a remote port is required")
+		}
+		return port.IntValue(), nil
+	}
+	for _, container := range pod.Spec.Containers {
+		for _, p := range container.Ports {
+			if p.Name == port.StrVal {
+				return int(p.ContainerPort), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("pod %s has no port named %q", pod.Name, port.StrVal)
+}
+
+func podReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// ListPortForwards returns the active forwards, oldest first.
+func (km *K8sManager) ListPortForwards() []PortForwardInfo {
+	km.forwardsMu.Lock()
+	defer km.forwardsMu.Unlock()
+
+	result := make([]PortForwardInfo, 0, len(km.forwards))
+	for _, pf := range km.forwards {
+		result = append(result, pf.snapshot())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Started.Before(result[j].Started) })
+	return result
+}
+
+// StopPortForward closes a forward and its local listener.
+func (km *K8sManager) StopPortForward(id string) error {
+	km.forwardsMu.Lock()
+	pf, ok := km.forwards[id]
+	delete(km.forwards, id)
+	km.forwardsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("port-forward %s not found", id)
+	}
+
+	pf.cancel()
+	<-pf.done
+	logrus.Infof("Stopped port-forward %s to %s", id, pf.request.Target)
+	return nil
+}
+
+// StopAllPortForwards closes every forward, on shutdown.
+func (km *K8sManager) StopAllPortForwards() {
+	km.forwardsMu.Lock()
+	ids := make([]string, 0, len(km.forwards))
+	for id := range km.forwards {
+		ids = append(ids, id)
+	}
+	km.forwardsMu.Unlock()
+
+	for _, id := range ids {
+		km.StopPortForward(id)
+	}
+}
@@ -0,0 +1,236 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+// lastAppliedAnnotation holds the last kubectl apply, secret data included.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// APIResourceInfo is a resource type served by the cluster, CRDs included.
+type APIResourceInfo struct {
+	Name       string   `json:"name"` // plural, e.g. deployments
+	Group      string   `json:"group"`
+	Version    string   `json:"version"`
+	Kind       string   `json:"kind"`
+	Namespaced bool     `json:"namespaced"`
+	ShortNames []string `json:"short_names,omitempty"`
+	Verbs      []string `json:"verbs"`
+}
+
+type ResourceListOptions struct {
+	Namespace     string `json:"namespace"` // empty for all namespaces
+	LabelSelector string `json:"label_selector"`
+	FieldSelector string `json:"field_selector"`
+	Limit         int64  `json:"limit"`
+	Continue      string `json:"continue"`
+}
+
+// ResourceSummary is the kind-independent view of any object.
+type ResourceSummary struct {
+	APIVersion string            `json:"api_version"`
+	Kind       string            `json:"kind"`
+	Name       string            `json:"name"`
+	Namespace  string            `json:"namespace,omitempty"`
+	Age        string            `json:"age"`
+	Created    time.Time         `json:"created"`
+	Labels     map[string]string `json:"labels"`
+}
+
+type ResourceList struct {
+	Items    []ResourceSummary `json:"items"`
+	Continue string            `json:"continue,omitempty"` // token for the next page
+}
+
+// ResourceDetail is one object as stored by the API server, without
+// managed fields. Info holds the matching Info struct for kinds the IDE
+// knows, e.g. a PodInfo for pods.
+type ResourceDetail struct {
+	ResourceSummary
+	Info   interface{}            `json:"info,omitempty"`
+	Object map[string]interface{} `json:"object"`
+}
+
+// infoConverters build the Info struct of the known kinds from an
+// unstructured object.
+var infoConverters = map[schema.GroupResource]func(*unstructured.Unstructured) (interface{}, error){
+	{Resource: "pods"}:                                           infoFrom(toPodInfo),
+	{Resource: "services"}:                                       infoFrom(toServiceInfo),
+	{Resource: "nodes"}:                                          infoFrom(toNodeInfo),
+	{Resource: "namespaces"}:                                     infoFrom(toNamespaceInfo),
+	{Resource: "events"}:                                         infoFrom(toEventInfo),
+	{Resource: "configmaps"}:                                     infoFrom(toConfigMapInfo),
+	{Resource: "persistentvolumeclaims"}:                         infoFrom(toPersistentVolumeClaimInfo),
+	{Resource: "persistentvolumes"}:                              infoFrom(toPersistentVolumeInfo),
+	{Resource: "serviceaccounts"}:                                infoFrom(toServiceAccountInfo),
+	{Group: "apps", Resource: "deployments"}:                     infoFrom(toDeploymentInfo),
+	{Group: "apps", Resource: "statefulsets"}:                    infoFrom(toStatefulSetInfo),
+	{Group: "apps", Resource: "daemonsets"}:                      infoFrom(toDaemonSetInfo),
+	{Group: "apps", Resource: "replicasets"}:                     infoFrom(toReplicaSetInfo),
+	{Group: "batch", Resource: "jobs"}:                           infoFrom(toJobInfo),
+	{Group: "batch", Resource: "cronjobs"}:                       infoFrom(toCronJobInfo),
+	{Group: "networking.k8s.io", Resource: "ingresses"}:          infoFrom(toIngressInfo),
+	{Group: "autoscaling", Resource: "horizontalpodautoscalers"}: infoFrom(toHPAInfo),
+}
+
+func infoFrom[T any, I any](convert func(*T) I) func(*unstructured.Unstructured) (interface{}, error) {
+	return func(obj *unstructured.Unstructured) (interface{}, error) {
+		var typed T
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &typed); err != nil {
+			return nil, err
+		}
+		return convert(&typed), nil
+	}
+}
+
+// ListAPIResources returns the preferred version of every resource type the
+// cluster serves. Groups whose discovery fails, e.g. an unavailable
+// aggregated API, are skipped.
+func (km *K8sManager) ListAPIResources() ([]APIResourceInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+
+	lists, err := km.discovery.ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, fmt.Errorf("failed to discover API resources: %w", err)
+	}
+
+	var result []APIResourceInfo
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			if strings.Contains(r.Name, "/") {
+				continue // subresources
+			}
+			result = append(result, APIResourceInfo{
+				Name:       r.Name,
+				Group:      gv.Group,
+				Version:    gv.Version,
+				Kind:       r.Kind,
+				Namespaced: r.Namespaced,
+				ShortNames: r.ShortNames,
+				Verbs:      r.Verbs,
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Group != result[j].Group {
+			return result[i].Group < result[j].Group
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// ListResources lists objects of any resource type, CRDs included, one
+// page at a time when opts.Limit is set.
+func (km *K8sManager) ListResources(resourceType string, opts ResourceListOptions) (*ResourceList, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	mapping, err := km.resolveResource(resourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := km.clientFor(mapping, opts.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: opts.LabelSelector,
+		FieldSelector: opts.FieldSelector,
+		Limit:         opts.Limit,
+		Continue:      opts.Continue,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", mapping.Resource.Resource, err)
+	}
+
+	result := &ResourceList{Items: make([]ResourceSummary, 0, len(list.Items)), Continue: list.GetContinue()}
+	for i := range list.Items {
+		result.Items = append(result.Items, toResourceSummary(&list.Items[i]))
+	}
+	return result, nil
+}
+
+// GetResource returns one object of any resource type. Secret values are
+// blanked unless showSecrets is set.
+func (km *K8sManager) GetResource(resourceType, namespace, name string, showSecrets bool) (*ResourceDetail, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	mapping, err := km.resolveResource(resourceType)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	obj, err := km.clientFor(mapping, namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", objectRef(mapping.GroupVersionKind, name), err)
+	}
+	unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+
+	detail := &ResourceDetail{ResourceSummary: toResourceSummary(obj)}
+	groupResource := mapping.Resource.GroupResource()
+	if groupResource == (schema.GroupResource{Resource: "secrets"}) {
+		if !showSecrets {
+			hideSecretValues(obj)
+		}
+		detail.Info, err = infoFrom(func(secret *corev1.Secret) SecretInfo {
+			return toSecretInfo(secret, showSecrets)
+		})(obj)
+	} else if convert, ok := infoConverters[groupResource]; ok {
+		detail.Info, err = convert(obj)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", objectRef(mapping.GroupVersionKind, name), err)
+	}
+	detail.Object = obj.Object
+	return detail, nil
+}
+
+// hideSecretValues blanks every value of a secret, keeping its keys.
+func hideSecretValues(obj *unstructured.Unstructured) {
+	for _, field := range []string{"data", "stringData"} {
+		values, found, _ := unstructured.NestedMap(obj.Object, field)
+		if !found {
+			continue
+		}
+		for key := range values {
+			values[key] = ""
+		}
+		unstructured.SetNestedMap(obj.Object, values, field)
+	}
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[lastAppliedAnnotation]; ok {
+		delete(annotations, lastAppliedAnnotation)
+		obj.SetAnnotations(annotations)
+	}
+}
+
+func toResourceSummary(obj *unstructured.Unstructured) ResourceSummary {
+	return ResourceSummary{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Name:       obj.GetName(),
+		Namespace:  obj.GetNamespace(),
+		Age:        objectAge(obj.GetCreationTimestamp()),
+		Created:    obj.GetCreationTimestamp().Time,
+		Labels:     obj.GetLabels(),
+	}
+}
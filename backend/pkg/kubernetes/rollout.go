@@ -0,0 +1,554 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Workload kinds supporting rollouts
+const (
+	KindDeployment  = "deployments"
+	KindStatefulSet = "statefulsets"
+	KindDaemonSet   = "daemonsets"
+)
+
+const (
+	revisionAnnotation    = "deployment.kubernetes.io/revision"
+	changeCauseAnnotation = "kubernetes.io/change-cause"
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+)
+
+// RolloutStatus follows kubectl rollout status: Done once every replica
+// runs the current template, Failed when the progress deadline passed.
+type RolloutStatus struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Revision  int64  `json:"revision,omitempty"`
+	Desired   int32  `json:"desired"`
+	Updated   int32  `json:"updated"`
+	Ready     int32  `json:"ready"`
+	Available int32  `json:"available"`
+	Paused    bool   `json:"paused"`
+	Done      bool   `json:"done"`
+	Failed    bool   `json:"failed"`
+	Message   string `json:"message"`
+}
+
+// RolloutRevision is one entry of a workload's rollout history, backed by a
+// ReplicaSet for Deployments and a ControllerRevision otherwise.
+type RolloutRevision struct {
+	Revision    int64     `json:"revision"`
+	Name        string    `json:"name"`
+	ChangeCause string    `json:"change_cause,omitempty"`
+	Images      []string  `json:"images"`
+	Replicas    int32     `json:"replicas"` // ReplicaSets only
+	Current     bool      `json:"current"`
+	Created     time.Time `json:"created"`
+}
+
+// workloadKind normalizes the kubectl names and shortcuts of the rollout kinds.
+func workloadKind(kind string) (string, error) {
+	switch kind {
+	case "deployment", "deployments", "deploy":
+		return KindDeployment, nil
+	case "statefulset", "statefulsets", "sts":
+		return KindStatefulSet, nil
+	case "daemonset", "daemonsets", "ds":
+		return KindDaemonSet, nil
+	}
+	return "", apierrors.NewBadRequest(fmt.Sprintf("%s do not support rollouts", kind))
+}
+
+// ScaleWorkload sets the replica count of a Deployment or StatefulSet
+// through the scale subresource.
+func (km *K8sManager) ScaleWorkload(kind, namespace, name string, replicas int32) error {
+	if !km.IsConnected() {
+		return fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	kind, err := workloadKind(kind)
+	if err != nil {
+		return err
+	}
+	if replicas < 0 {
+		return apierrors.NewBadRequest("replicas must not be negative")
+	}
+
+	ctx := context.TODO()
+	apps := km.clientset.AppsV1()
+	switch kind {
+	case KindDeployment:
+		scale, err := apps.Deployments(namespace).GetScale(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			scale.Spec.Replicas = replicas
+			_, err = apps.Deployments(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to scale deployment %s: %w", name, err)
+		}
+	case KindStatefulSet:
+		scale, err := apps.StatefulSets(namespace).GetScale(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			scale.Spec.Replicas = replicas
+			_, err = apps.StatefulSets(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to scale statefulset %s: %w", name, err)
+		}
+	default:
+		return apierrors.NewBadRequest("daemonsets run one pod per node and cannot be scaled")
+	}
+
+	logrus.Infof("Scaled %s %s/%s to %d replicas", kind, namespace, name, replicas)
+	return nil
+}
+
+// RestartWorkload triggers a rolling restart like kubectl rollout restart,
+// by stamping the pod template.
+func (km *K8sManager) RestartWorkload(kind, namespace, name string) error {
+	if !km.IsConnected() {
+		return fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	kind, err := workloadKind(kind)
+	if err != nil {
+		return err
+	}
+
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{restartedAtAnnotation: time.Now().Format(time.RFC3339)},
+				},
+			},
+		},
+	}
+	if err := km.patchWorkload(kind, namespace, name, types.StrategicMergePatchType, patch); err != nil {
+		return fmt.Errorf("failed to restart %s %s: %w", kind, name, err)
+	}
+	logrus.Infof("Restarted %s %s/%s", kind, namespace, name)
+	return nil
+}
+
+// SetRolloutPaused pauses or resumes a Deployment rollout.
+func (km *K8sManager) SetRolloutPaused(kind, namespace, name string, paused bool) error {
+	if !km.IsConnected() {
+		return fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	kind, err := workloadKind(kind)
+	if err != nil {
+		return err
+	}
+	if kind != KindDeployment {
+		return apierrors.NewBadRequest("only deployments can be paused")
+	}
+
+	patch := map[string]interface{}{"spec": map[string]interface{}{"paused": paused}}
+	if err := km.patchWorkload(kind, namespace, name, types.StrategicMergePatchType, patch); err != nil {
+		return fmt.Errorf("failed to update deployment %s: %w", name, err)
+	}
+	logrus.Infof("Set paused=%t on deployment %s/%s", paused, namespace, name)
+	return nil
+}
+
+func (km *K8sManager) patchWorkload(kind, namespace, name string, patchType types.PatchType, patch interface{}) error {
+	data, ok := patch.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(patch); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.TODO()
+	apps := km.clientset.AppsV1()
+	var err error
+	switch kind {
+	case KindDeployment:
+		_, err = apps.Deployments(namespace).Patch(ctx, name, patchType, data, metav1.PatchOptions{})
+	case KindStatefulSet:
+		_, err = apps.StatefulSets(namespace).Patch(ctx, name, patchType, data, metav1.PatchOptions{})
+	case KindDaemonSet:
+		_, err = apps.DaemonSets(namespace).Patch(ctx, name, patchType, data, metav1.PatchOptions{})
+	}
+	return err
+}
+
+// GetRolloutStatus reports the current progress of a workload rollout.
+func (km *K8sManager) GetRolloutStatus(kind, namespace, name string) (*RolloutStatus, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	kind, err := workloadKind(kind)
+	if err != nil {
+		return nil, err
+	}
+	return km.rolloutStatus(context.TODO(), kind, namespace, name)
+}
+
+func (km *K8sManager) rolloutStatus(ctx context.Context, kind, namespace, name string) (*RolloutStatus, error) {
+	apps := km.clientset.AppsV1()
+	status := &RolloutStatus{Kind: kind, Namespace: namespace, Name: name}
+
+	switch kind {
+	case KindDeployment:
+		d, err := apps.Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployment %s: %w", name, err)
+		}
+		status.Revision, _ = strconv.ParseInt(d.Annotations[revisionAnnotation], 10, 64)
+		status.Desired = 1
+		if d.Spec.Replicas != nil {
+			status.Desired = *d.Spec.Replicas
+		}
+		status.Updated = d.Status.UpdatedReplicas
+		status.Ready = d.Status.ReadyReplicas
+		status.Available = d.Status.AvailableReplicas
+		status.Paused = d.Spec.Paused
+
+		switch {
+		case d.Generation > d.Status.ObservedGeneration:
+			status.Message = "Waiting for deployment spec update to be observed"
+		case deploymentTimedOut(d):
+			status.Failed = true
+			status.Message = fmt.Sprintf("deployment %q exceeded its progress deadline", name)
+		case status.Updated < status.Desired:
+			status.Message = fmt.Sprintf("Waiting for rollout to finish: %d out of %d new replicas have been updated", status.Updated, status.Desired)
+		case d.Status.Replicas > status.Updated:
+			status.Message = fmt.Sprintf("Waiting for rollout to finish: %d old replicas are pending termination", d.Status.Replicas-status.Updated)
+		case status.Available < status.Updated:
+			status.Message = fmt.Sprintf("Waiting for rollout to finish: %d of %d updated replicas are available", status.Available, status.Updated)
+		default:
+			status.Done = true
+			status.Message = fmt.Sprintf("deployment %q successfully rolled out", name)
+		}
+
+	case KindStatefulSet:
+		s, err := apps.StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get statefulset %s: %w", name, err)
+		}
+		status.Desired = 1
+		if s.Spec.Replicas != nil {
+			status.Desired = *s.Spec.Replicas
+		}
+		status.Updated = s.Status.UpdatedReplicas
+		status.Ready = s.Status.ReadyReplicas
+		status.Available = s.Status.AvailableReplicas
+
+		var partition int32
+		if ru := s.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil {
+			partition = *ru.Partition
+		}
+		switch {
+		case s.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType:
+			status.Done = true
+			status.Message = "rollout status is only available for RollingUpdate strategy type"
+		case s.Status.ObservedGeneration == 0 || s.Generation > s.Status.ObservedGeneration:
+			status.Message = "Waiting for statefulset spec update to be observed"
+		case status.Ready < status.Desired:
+			status.Message = fmt.Sprintf("Waiting for %d pods to be ready", status.Desired-status.Ready)
+		case partition > 0:
+			if status.Updated < status.Desired-partition {
+				status.Message = fmt.Sprintf("Waiting for partitioned roll out to finish: %d out of %d new pods have been updated", status.Updated, status.Desired-partition)
+			} else {
+				status.Done = true
+				status.Message = fmt.Sprintf("partitioned roll out complete: %d new pods have been updated", status.Updated)
+			}
+		case s.Status.UpdateRevision != s.Status.CurrentRevision:
+			status.Message = fmt.Sprintf("waiting for statefulset rolling update to complete %d pods at revision %s", status.Updated, s.Status.UpdateRevision)
+		default:
+			status.Done = true
+			status.Message = fmt.Sprintf("statefulset rolling update complete %d pods at revision %s", s.Status.CurrentReplicas, s.Status.CurrentRevision)
+		}
+
+	case KindDaemonSet:
+		ds, err := apps.DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get daemonset %s: %w", name, err)
+		}
+		status.Desired = ds.Status.DesiredNumberScheduled
+		status.Updated = ds.Status.UpdatedNumberScheduled
+		status.Ready = ds.Status.NumberReady
+		status.Available = ds.Status.NumberAvailable
+
+		switch {
+		case ds.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType:
+			status.Done = true
+			status.Message = "rollout status is only available for RollingUpdate strategy type"
+		case ds.Generation > ds.Status.ObservedGeneration:
+			status.Message = "Waiting for daemon set spec update to be observed"
+		case status.Updated < status.Desired:
+			status.Message = fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d out of %d new pods have been updated", name, status.Updated, status.Desired)
+		case status.Available < status.Desired:
+			status.Message = fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d of %d updated pods are available", name, status.Available, status.Desired)
+		default:
+			status.Done = true
+			status.Message = fmt.Sprintf("daemon set %q successfully rolled out", name)
+		}
+	}
+	return status, nil
+}
+
+func deploymentTimedOut(d *appsv1.Deployment) bool {
+	for _, condition := range d.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing {
+			return condition.Reason == "ProgressDeadlineExceeded"
+		}
+	}
+	return false
+}
+
+// WatchRollout polls a rollout until it is done, failed, paused or timeout
+// passes, reporting every status change. It returns the last status.
+func (km *K8sManager) WatchRollout(ctx context.Context, kind, namespace, name string, timeout time.Duration, progress func(RolloutStatus)) (*RolloutStatus, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	kind, err := workloadKind(kind)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	if progress == nil {
+		progress = func(RolloutStatus) {}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var last RolloutStatus
+	for {
+		status, err := km.rolloutStatus(ctx, kind, namespace, name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return &last, fmt.Errorf("timed out waiting for %s %s rollout", kind, name)
+			}
+			return nil, err
+		}
+		if *status != last {
+			last = *status
+			progress(last)
+		}
+		if status.Done || status.Failed || status.Paused {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, fmt.Errorf("timed out waiting for %s %s rollout", kind, name)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// RolloutHistory lists the revisions of a workload, newest first.
+func (km *K8sManager) RolloutHistory(kind, namespace, name string) ([]RolloutRevision, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	kind, err := workloadKind(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, _, err := km.rolloutRevisions(context.TODO(), kind, namespace, name)
+	return revisions, err
+}
+
+// rolloutRevisions returns the history and, per revision number, the pod
+// template patch that restores it.
+func (km *K8sManager) rolloutRevisions(ctx context.Context, kind, namespace, name string) ([]RolloutRevision, map[int64][]byte, error) {
+	apps := km.clientset.AppsV1()
+	var revisions []RolloutRevision
+	templates := make(map[int64][]byte)
+
+	if kind == KindDeployment {
+		d, err := apps.Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get deployment %s: %w", name, err)
+		}
+		selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid selector on deployment %s: %w", name, err)
+		}
+		sets, err := apps.ReplicaSets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list replicasets of %s: %w", name, err)
+		}
+		current := d.Annotations[revisionAnnotation]
+		for i := range sets.Items {
+			rs := &sets.Items[i]
+			if !metav1.IsControlledBy(rs, d) {
+				continue
+			}
+			revision, err := strconv.ParseInt(rs.Annotations[revisionAnnotation], 10, 64)
+			if err != nil {
+				continue
+			}
+			revisions = append(revisions, RolloutRevision{
+				Revision:    revision,
+				Name:        rs.Name,
+				ChangeCause: rs.Annotations[changeCauseAnnotation],
+				Images:      templateImages(rs.Spec.Template.Spec),
+				Replicas:    rs.Status.Replicas,
+				Current:     rs.Annotations[revisionAnnotation] == current,
+				Created:     rs.CreationTimestamp.Time,
+			})
+
+			// Restore the template as it was, without the label the
+			// controller adds to tell ReplicaSets apart
+			template := rs.Spec.Template.DeepCopy()
+			delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+			patch, err := json.Marshal([]map[string]interface{}{
+				{"op": "replace", "path": "/spec/template", "value": template},
+			})
+			if err == nil {
+				templates[revision] = patch
+			}
+		}
+	} else {
+		var owner metav1.Object
+		var selector *metav1.LabelSelector
+		var currentRevision string
+		switch kind {
+		case KindStatefulSet:
+			s, err := apps.StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get statefulset %s: %w", name, err)
+			}
+			owner, selector, currentRevision = s, s.Spec.Selector, s.Status.UpdateRevision
+		case KindDaemonSet:
+			ds, err := apps.DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get daemonset %s: %w", name, err)
+			}
+			owner, selector = ds, ds.Spec.Selector
+		}
+
+		sel, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid selector on %s: %w", name, err)
+		}
+		history, err := apps.ControllerRevisions(namespace).List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list controller revisions of %s: %w", name, err)
+		}
+		var newest int64
+		for i := range history.Items {
+			cr := &history.Items[i]
+			if !metav1.IsControlledBy(cr, owner) {
+				continue
+			}
+			// The revision data is a strategic merge patch of the template
+			var data struct {
+				Spec struct {
+					Template corev1.PodTemplateSpec `json:"template"`
+				} `json:"spec"`
+			}
+			if err := json.Unmarshal(cr.Data.Raw, &data); err != nil {
+				// The revision can still be restored, only its images are unknown
+				logrus.Warnf("Failed to decode controller revision %s/%s: %v", namespace, cr.Name, err)
+			}
+			revisions = append(revisions, RolloutRevision{
+				Revision:    cr.Revision,
+				Name:        cr.Name,
+				ChangeCause: cr.Annotations[changeCauseAnnotation],
+				Images:      templateImages(data.Spec.Template.Spec),
+				Current:     currentRevision != "" && cr.Name == currentRevision,
+				Created:     cr.CreationTimestamp.Time,
+			})
+			templates[cr.Revision] = cr.Data.Raw
+			if cr.Revision > newest {
+				newest = cr.Revision
+			}
+		}
+		if currentRevision == "" {
+			// DaemonSets do not report their revision; the newest is current
+			for i := range revisions {
+				revisions[i].Current = revisions[i].Revision == newest
+			}
+		}
+	}
+
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision > revisions[j].Revision })
+	return revisions, templates, nil
+}
+
+func templateImages(spec corev1.PodSpec) []string {
+	images := make([]string, 0, len(spec.Containers))
+	for _, container := range spec.Containers {
+		images = append(images, container.Image)
+	}
+	return images
+}
+
+// UndoRollout rolls a workload back to revision, or to the revision before
+// the current one when revision is 0, and returns the revision restored.
+func (km *K8sManager) UndoRollout(kind, namespace, name string, revision int64) (*RolloutRevision, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	kind, err := workloadKind(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+	if kind == KindDeployment {
+		d, err := km.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployment %s: %w", name, err)
+		}
+		if d.Spec.Paused {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("cannot roll back paused deployment %s; resume it first", name))
+		}
+	}
+
+	revisions, templates, err := km.rolloutRevisions(ctx, kind, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *RolloutRevision
+	for i := range revisions {
+		if revision == 0 && revisions[i].Current && i+1 < len(revisions) {
+			target = &revisions[i+1]
+			break
+		}
+		if revision != 0 && revisions[i].Revision == revision {
+			target = &revisions[i]
+			break
+		}
+	}
+	switch {
+	case target == nil && revision == 0:
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("no previous revision of %s %s to roll back to", kind, name))
+	case target == nil:
+		return nil, notFoundError(fmt.Sprintf("revision %d of %s %s not found", revision, kind, name))
+	case target.Current:
+		return target, nil // already running it
+	}
+
+	patchType := types.StrategicMergePatchType
+	if kind == KindDeployment {
+		patchType = types.JSONPatchType
+	}
+	if err := km.patchWorkload(kind, namespace, name, patchType, templates[target.Revision]); err != nil {
+		return nil, fmt.Errorf("failed to roll back %s %s: %w", kind, name, err)
+	}
+	logrus.Infof("Rolled back %s %s/%s to revision %d", kind, namespace, name, target.Revision)
+	return target, nil
+}
@@ -0,0 +1,560 @@
+package kubernetes
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/distribution/reference"
+	"go.yaml.in/yaml/v3"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Diagnostic sources
+const (
+	SourceYAML        = "yaml"
+	SourceSchema      = "schema"
+	SourceDeprecation = "deprecation"
+	SourceLint        = "lint"
+)
+
+// Lint rules
+const (
+	RuleResourceLimits = "resource-limits"
+	RuleLatestTag      = "latest-tag"
+	RulePrivileged     = "privileged"
+	RuleReadinessProbe = "readiness-probe"
+	RuleLivenessProbe  = "liveness-probe"
+)
+
+// Diagnostic is one problem of a manifest. Lines and columns are 1-based
+// like Monaco markers; the end column is exclusive.
+type Diagnostic struct {
+	Severity    string `json:"severity"` // error, warning or info
+	Source      string `json:"source"`
+	Rule        string `json:"rule,omitempty"` // lint rule
+	Message     string `json:"message"`
+	Object      string `json:"object,omitempty"` // Kind/name
+	Path        string `json:"path,omitempty"`   // e.g. spec.template.spec.containers[0].image
+	StartLine   int    `json:"start_line"`
+	StartColumn int    `json:"start_column"`
+	EndLine     int    `json:"end_line"`
+	EndColumn   int    `json:"end_column"`
+}
+
+type ValidationResult struct {
+	Valid         bool         `json:"valid"` // no errors
+	SchemaSource  string       `json:"schema_source"`
+	ServerVersion string       `json:"server_version,omitempty"`
+	Diagnostics   []Diagnostic `json:"diagnostics"`
+}
+
+// ValidateManifest checks a multi-document manifest without applying it:
+// YAML syntax, the cluster's OpenAPI schema (the copy saved on disk when
+// the cluster is unreachable), API versions deprecated or removed in the
+// cluster's version, and best-practice lints.
+func (km *K8sManager) ValidateManifest(manifest string) *ValidationResult {
+	return validateManifest(manifest, km.openAPISchemas())
+}
+
+// LintManifest runs the checks that need no cluster: YAML syntax,
+// deprecated API versions and lints.
+func LintManifest(manifest string) *ValidationResult {
+	return validateManifest(manifest, &schemaSet{source: SchemaSourceNone})
+}
+
+type manifestValidator struct {
+	schemas     *schemaSet
+	diagnostics []Diagnostic
+	object      string
+}
+
+func validateManifest(manifest string, schemas *schemaSet) *ValidationResult {
+	v := &manifestValidator{schemas: schemas}
+	decoder := yaml.NewDecoder(strings.NewReader(manifest))
+	for {
+		var doc yaml.Node
+		if err := decoder.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			v.syntaxError(err)
+			break
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		v.validateDocument(doc.Content[0])
+	}
+
+	result := &ValidationResult{
+		Valid:         true,
+		SchemaSource:  schemas.source,
+		ServerVersion: schemas.serverVersion,
+		Diagnostics:   v.diagnostics,
+	}
+	if result.Diagnostics == nil {
+		result.Diagnostics = []Diagnostic{}
+	}
+	sort.SliceStable(result.Diagnostics, func(i, j int) bool {
+		a, b := result.Diagnostics[i], result.Diagnostics[j]
+		if a.StartLine != b.StartLine {
+			return a.StartLine < b.StartLine
+		}
+		return a.StartColumn < b.StartColumn
+	})
+	for _, d := range result.Diagnostics {
+		if d.Severity == SeverityError {
+			result.Valid = false
+		}
+	}
+	return result
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+func (v *manifestValidator) syntaxError(err error) {
+	line, message := 1, strings.TrimPrefix(err.Error(), "yaml: ")
+	if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+		line, _ = strconv.Atoi(m[1])
+		message = strings.TrimPrefix(err.Error(), m[0])
+	}
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		Severity:    SeverityError,
+		Source:      SourceYAML,
+		Message:     message,
+		StartLine:   line,
+		StartColumn: 1,
+		EndLine:     line,
+		EndColumn:   1000,
+	})
+}
+
+func (v *manifestValidator) report(severity, source, rule, path string, node *yaml.Node, format string, args ...interface{}) {
+	d := Diagnostic{
+		Severity: severity,
+		Source:   source,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+		Object:   v.object,
+		Path:     path,
+	}
+	d.StartLine, d.StartColumn, d.EndLine, d.EndColumn = nodeRange(node)
+	v.diagnostics = append(v.diagnostics, d)
+}
+
+// nodeRange is the span of a scalar, or the first character of a
+// collection.
+func nodeRange(node *yaml.Node) (startLine, startColumn, endLine, endColumn int) {
+	if node == nil {
+		return 1, 1, 1, 2
+	}
+	width := 1
+	if node.Kind == yaml.ScalarNode && !strings.Contains(node.Value, "\n") {
+		width = len(node.Value)
+		if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+			width += 2
+		}
+		if width == 0 {
+			width = 1
+		}
+	}
+	return node.Line, node.Column, node.Line, node.Column + width
+}
+
+func (v *manifestValidator) validateDocument(root *yaml.Node) {
+	if root.Kind == yaml.ScalarNode && root.Tag == "!!null" {
+		return // empty document
+	}
+	if root.Kind != yaml.MappingNode {
+		v.object = ""
+		v.report(SeverityError, SourceSchema, "", "", root, "document is not an object")
+		return
+	}
+
+	_, apiVersionNode := mappingField(root, "apiVersion")
+	_, kindNode := mappingField(root, "kind")
+	apiVersion, kind := scalarValue(apiVersionNode), scalarValue(kindNode)
+	v.object = kind
+	if _, metadata := mappingField(root, "metadata"); metadata != nil {
+		if _, name := mappingField(metadata, "name"); name != nil {
+			v.object = kind + "/" + name.Value
+		}
+	}
+	if apiVersion == "" || kind == "" {
+		v.report(SeverityError, SourceSchema, "", "", root, "apiVersion and kind are required")
+		return
+	}
+
+	// Lists hold objects in items
+	if _, items := mappingField(root, "items"); strings.HasSuffix(kind, "List") && items != nil && items.Kind == yaml.SequenceNode {
+		for _, item := range items.Content {
+			v.validateDocument(item)
+		}
+		return
+	}
+
+	removed := false
+	if d := findDeprecation(apiVersion, kind); d != nil {
+		severity, message := d.check(apiVersion, kind, v.schemas.serverVersion)
+		if severity != "" {
+			v.report(severity, SourceDeprecation, "", "apiVersion", apiVersionNode, "%s", message)
+			removed = severity == SeverityError
+		}
+	}
+	if !removed {
+		v.validateSchema(root, apiVersion, kind, apiVersionNode, kindNode)
+	}
+	v.lint(root, kind)
+}
+
+func (v *manifestValidator) validateSchema(root *yaml.Node, apiVersion, kind string, apiVersionNode, kindNode *yaml.Node) {
+	if v.schemas.load == nil {
+		return
+	}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		v.report(SeverityError, SourceSchema, "", "apiVersion", apiVersionNode, "invalid apiVersion %q", apiVersion)
+		return
+	}
+	path := groupVersionPath(gv)
+	if !v.schemas.paths[path] && v.schemas.refresh != nil {
+		// The cluster may serve it since discovery was cached
+		v.schemas.refresh()
+		v.schemas.refresh = nil
+	}
+	if !v.schemas.paths[path] {
+		// Custom resources often come with their CRD in the same manifest
+		if strings.Contains(gv.Group, ".") && !strings.HasSuffix(gv.Group, ".k8s.io") {
+			v.report(SeverityWarning, SourceSchema, "", "apiVersion", apiVersionNode, "apiVersion %s is not served by the cluster; apply its CustomResourceDefinition first", apiVersion)
+		} else {
+			v.report(SeverityError, SourceSchema, "", "apiVersion", apiVersionNode, "apiVersion %s is not served by the cluster", apiVersion)
+		}
+		return
+	}
+	doc, err := v.schemas.load(path)
+	if err != nil {
+		v.report(SeverityInfo, SourceSchema, "", "apiVersion", apiVersionNode, "schema not checked: %v", err)
+		return
+	}
+	s, ok := doc.kinds[gv.Group+"/"+gv.Version+"/"+kind]
+	if !ok {
+		v.report(SeverityError, SourceSchema, "", "kind", kindNode, "kind %s is not served in %s", kind, apiVersion)
+		return
+	}
+	(&schemaWalker{v: v, doc: doc}).walk(root, s, "", nil)
+}
+
+// schemaWalker checks YAML nodes against the schema of one object.
+type schemaWalker struct {
+	v   *manifestValidator
+	doc *openAPIDocument
+}
+
+// walk checks node against s; key is the mapping key node of the field,
+// where missing required fields are reported.
+func (w *schemaWalker) walk(node *yaml.Node, s *apiSchema, path string, key *yaml.Node) {
+	s = w.doc.resolve(s)
+	if s == nil || node.Tag == "!!null" {
+		return
+	}
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	if s.IntOrString {
+		if node.Kind != yaml.ScalarNode || (node.Tag != "!!int" && node.Tag != "!!str") {
+			w.v.report(SeverityError, SourceSchema, "", path, node, "%s must be an integer or a string", fieldName(path))
+		}
+		return
+	}
+	if len(s.OneOf) > 0 && s.Type == "" {
+		w.walkOneOf(node, s, path)
+		return
+	}
+
+	typ := s.Type
+	if typ == "" && len(s.Properties) > 0 {
+		typ = "object"
+	}
+	switch typ {
+	case "object":
+		if node.Kind != yaml.MappingNode {
+			w.v.report(SeverityError, SourceSchema, "", path, node, "%s must be an object, got %s", fieldName(path), nodeType(node))
+			return
+		}
+		w.walkObject(node, s, path, key)
+	case "array":
+		if node.Kind != yaml.SequenceNode {
+			w.v.report(SeverityError, SourceSchema, "", path, node, "%s must be an array, got %s", fieldName(path), nodeType(node))
+			return
+		}
+		if s.Items != nil {
+			for i, item := range node.Content {
+				w.walk(item, s.Items, fmt.Sprintf("%s[%d]", path, i), nil)
+			}
+		}
+	case "string", "integer", "number", "boolean":
+		if !scalarMatches(node, typ) {
+			w.v.report(SeverityError, SourceSchema, "", path, node, "%s must be %s, got %s", fieldName(path), article(typ), nodeType(node))
+			return
+		}
+		if len(s.Enum) > 0 && !enumContains(s.Enum, node.Value) {
+			w.v.report(SeverityError, SourceSchema, "", path, node, "%s must be one of %s", fieldName(path), enumList(s.Enum))
+		}
+	}
+}
+
+func (w *schemaWalker) walkObject(node *yaml.Node, s *apiSchema, path string, key *yaml.Node) {
+	freeForm := len(s.Properties) == 0 && s.AdditionalProperties == nil
+	present := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		k, value := node.Content[i], node.Content[i+1]
+		present[k.Value] = true
+		fieldPath := k.Value
+		if path != "" {
+			fieldPath = path + "." + k.Value
+		}
+		switch prop, ok := s.Properties[k.Value]; {
+		case ok:
+			w.walk(value, prop, fieldPath, k)
+		case s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil:
+			w.walk(value, s.AdditionalProperties.Schema, fieldPath, k)
+		case freeForm, s.PreserveUnknown, s.AdditionalProperties != nil && s.AdditionalProperties.Allowed:
+		case s.EmbeddedResource && (k.Value == "apiVersion" || k.Value == "kind" || k.Value == "metadata"):
+		default:
+			w.v.report(SeverityError, SourceSchema, "", fieldPath, k, "unknown field %q in %s", k.Value, objectName(path))
+		}
+	}
+
+	anchor := key
+	if anchor == nil {
+		anchor = node
+	}
+	for _, required := range s.Required {
+		if !present[required] {
+			w.v.report(SeverityError, SourceSchema, "", path, anchor, "missing required field %q in %s", required, objectName(path))
+		}
+	}
+}
+
+// walkOneOf accepts a value matching any of the simple types listed, as
+// used for quantities; complex alternatives are not checked.
+func (w *schemaWalker) walkOneOf(node *yaml.Node, s *apiSchema, path string) {
+	var types []string
+	for _, option := range s.OneOf {
+		option = w.doc.resolve(option)
+		if option == nil || option.Type == "" || option.Type == "object" || option.Type == "array" {
+			return
+		}
+		if scalarMatches(node, option.Type) {
+			return
+		}
+		types = append(types, option.Type)
+	}
+	w.v.report(SeverityError, SourceSchema, "", path, node, "%s must be %s, got %s", fieldName(path), strings.Join(types, " or "), nodeType(node))
+}
+
+func scalarMatches(node *yaml.Node, typ string) bool {
+	if node.Kind != yaml.ScalarNode {
+		return false
+	}
+	switch typ {
+	case "string":
+		return node.Tag == "!!str" || node.Tag == "!!binary" || node.Tag == "!!timestamp"
+	case "integer":
+		return node.Tag == "!!int"
+	case "number":
+		return node.Tag == "!!int" || node.Tag == "!!float"
+	case "boolean":
+		return node.Tag == "!!bool"
+	}
+	return true
+}
+
+func nodeType(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "an object"
+	case yaml.SequenceNode:
+		return "an array"
+	}
+	switch node.Tag {
+	case "!!int":
+		return "an integer"
+	case "!!float":
+		return "a number"
+	case "!!bool":
+		return "a boolean"
+	}
+	return "a string"
+}
+
+func article(typ string) string {
+	if typ == "integer" {
+		return "an integer"
+	}
+	return "a " + typ
+}
+
+func enumContains(enum []interface{}, value string) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == value {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []interface{}) string {
+	values := make([]string, 0, len(enum))
+	for _, e := range enum {
+		values = append(values, fmt.Sprint(e))
+	}
+	return strings.Join(values, ", ")
+}
+
+func fieldName(path string) string {
+	if path == "" {
+		return "object"
+	}
+	return path
+}
+
+func objectName(path string) string {
+	if path == "" {
+		return "the object"
+	}
+	return path
+}
+
+// mappingField returns the key and value nodes of a field of a mapping.
+func mappingField(node *yaml.Node, name string) (key, value *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == name {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+// podSpecPaths locate the pod template of the workload kinds.
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// lint checks the containers of workloads for common mistakes.
+func (v *manifestValidator) lint(root *yaml.Node, kind string) {
+	fields, ok := podSpecPaths[kind]
+	if !ok {
+		return
+	}
+	spec := root
+	for _, field := range fields {
+		if _, spec = mappingField(spec, field); spec == nil {
+			return
+		}
+	}
+	path := strings.Join(fields, ".")
+	// Jobs run to completion, probes matter for long-running pods
+	probes := kind != "Job" && kind != "CronJob"
+
+	for _, group := range []string{"initContainers", "containers"} {
+		_, containers := mappingField(spec, group)
+		if containers == nil || containers.Kind != yaml.SequenceNode {
+			continue
+		}
+		for i, container := range containers.Content {
+			containerPath := fmt.Sprintf("%s.%s[%d]", path, group, i)
+			v.lintContainer(container, containerPath, probes && group == "containers")
+		}
+	}
+}
+
+func (v *manifestValidator) lintContainer(container *yaml.Node, path string, probes bool) {
+	if container.Kind != yaml.MappingNode {
+		return
+	}
+	_, nameNode := mappingField(container, "name")
+	name := scalarValue(nameNode)
+	if name == "" {
+		name = path[strings.LastIndex(path, ".")+1:]
+	}
+	anchor := nameNode
+	if anchor == nil {
+		anchor = container
+	}
+
+	if _, image := mappingField(container, "image"); image != nil && image.Kind == yaml.ScalarNode {
+		if latestTag(image.Value) {
+			v.report(SeverityWarning, SourceLint, RuleLatestTag, path+".image", image,
+				"image %s uses the latest tag; pin a version or digest so rollouts are reproducible", image.Value)
+		}
+	}
+
+	_, resources := mappingField(container, "resources")
+	_, limits := mappingField(resources, "limits")
+	_, cpu := mappingField(limits, "cpu")
+	_, memory := mappingField(limits, "memory")
+	switch {
+	case cpu == nil && memory == nil:
+		v.report(SeverityWarning, SourceLint, RuleResourceLimits, path+".resources", anchor,
+			"container %s has no resource limits; set resources.limits.cpu and memory", name)
+	case memory == nil:
+		v.report(SeverityWarning, SourceLint, RuleResourceLimits, path+".resources.limits", anchor,
+			"container %s has no memory limit", name)
+	case cpu == nil:
+		v.report(SeverityInfo, SourceLint, RuleResourceLimits, path+".resources.limits", anchor,
+			"container %s has no CPU limit", name)
+	}
+
+	_, securityContext := mappingField(container, "securityContext")
+	if _, privileged := mappingField(securityContext, "privileged"); privileged != nil && privileged.Value == "true" {
+		v.report(SeverityWarning, SourceLint, RulePrivileged, path+".securityContext.privileged", privileged,
+			"container %s runs privileged with full access to the node", name)
+	}
+
+	if !probes {
+		return
+	}
+	if _, probe := mappingField(container, "readinessProbe"); probe == nil {
+		v.report(SeverityWarning, SourceLint, RuleReadinessProbe, path, anchor,
+			"container %s has no readiness probe; traffic is sent before it is ready", name)
+	}
+	if _, probe := mappingField(container, "livenessProbe"); probe == nil {
+		v.report(SeverityInfo, SourceLint, RuleLivenessProbe, path, anchor,
+			"container %s has no liveness probe; a hung process is not restarted", name)
+	}
+}
+
+// latestTag tells whether an image runs whatever latest points to.
+func latestTag(image string) bool {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return false
+	}
+	tagged, ok := named.(reference.Tagged)
+	return !ok || tagged.Tag() == "latest"
+}
@@ -0,0 +1,136 @@
+package kubernetes
+
+import (
+	"testing"
+)
+
+// rules returns the diagnostics of a result keyed by source and rule.
+func rules(result *ValidationResult) map[string]Diagnostic {
+	found := map[string]Diagnostic{}
+	for _, d := range result.Diagnostics {
+		found[d.Source+"/"+d.Rule] = d
+	}
+	return found
+}
+
+func TestValidateManifestSyntaxError(t *testing.T) {
+	result := LintManifest("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata: key: value\n")
+	if result.Valid {
+		t.Fatal("want an invalid result")
+	}
+	if len(result.Diagnostics) != 1 {
+		t.Fatalf("diagnostics = %+v, want one", result.Diagnostics)
+	}
+	d := result.Diagnostics[0]
+	if d.Source != SourceYAML || d.Severity != SeverityError || d.StartLine != 5 {
+		t.Errorf("diagnostic = %+v, want a yaml error on line 5", d)
+	}
+}
+
+func TestValidateManifestDeprecations(t *testing.T) {
+	const manifest = `apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+`
+	tests := []struct {
+		serverVersion string
+		severity      string
+		valid         bool
+	}{
+		{"", SeverityWarning, true},        // unknown version
+		{"v1.20.4", "", true},              // before the deprecation
+		{"v1.23.1", SeverityWarning, true}, // deprecated
+		{"v1.29.0", SeverityError, false},  // removed
+	}
+	for _, tt := range tests {
+		result := validateManifest(manifest, &schemaSet{source: SchemaSourceNone, serverVersion: tt.serverVersion})
+		d, found := rules(result)[SourceDeprecation+"/"]
+		if result.Valid != tt.valid || found != (tt.severity != "") || d.Severity != tt.severity {
+			t.Errorf("server %q: valid %t, diagnostics %+v; want valid %t and severity %q",
+				tt.serverVersion, result.Valid, result.Diagnostics, tt.valid, tt.severity)
+			continue
+		}
+		if found && (d.StartLine != 1 || d.StartColumn != 13 || d.Object != "CronJob/backup") {
+			t.Errorf("server %q: diagnostic %+v does not point at the apiVersion", tt.serverVersion, d)
+		}
+	}
+}
+
+func TestValidateManifestLint(t *testing.T) {
+	const manifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx
+        securityContext:
+          privileged: true
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: migrate:1.2@sha256:0000000000000000000000000000000000000000000000000000000000000000
+        resources:
+          limits:
+            cpu: 100m
+            memory: 64Mi
+`
+	result := LintManifest(manifest)
+	if !result.Valid {
+		t.Errorf("lint findings must not invalidate the manifest: %+v", result.Diagnostics)
+	}
+	found := rules(result)
+	for rule, severity := range map[string]string{
+		RuleLatestTag:      SeverityWarning,
+		RuleResourceLimits: SeverityWarning,
+		RulePrivileged:     SeverityWarning,
+		RuleReadinessProbe: SeverityWarning,
+		RuleLivenessProbe:  SeverityInfo,
+	} {
+		d, ok := found[SourceLint+"/"+rule]
+		if !ok {
+			t.Errorf("missing %s finding", rule)
+			continue
+		}
+		if d.Severity != severity || d.Object != "Deployment/web" {
+			t.Errorf("%s finding = %+v, want %s on Deployment/web", rule, d, severity)
+		}
+	}
+	if d := found[SourceLint+"/"+RuleLatestTag]; d.StartLine != 10 || d.Path != "spec.template.spec.containers[0].image" {
+		t.Errorf("latest tag finding = %+v, want line 10 at the image", d)
+	}
+	if len(result.Diagnostics) != 5 {
+		t.Errorf("diagnostics = %+v, want none for the pinned and limited Job", result.Diagnostics)
+	}
+}
+
+func TestLatestTag(t *testing.T) {
+	for image, latest := range map[string]bool{
+		"nginx":                            true,
+		"nginx:latest":                     true,
+		"registry:5000/team/app":           true,
+		"ghcr.io/org/app:latest":           true,
+		"nginx:1.27":                       false,
+		"registry:5000/team/app:v2":        false,
+		"nginx@sha256:" + sha256Hex:        false,
+		"nginx:latest@sha256:" + sha256Hex: false,
+		"Invalid Image":                    false,
+	} {
+		if got := latestTag(image); got != latest {
+			t.Errorf("latestTag(%q) = %t, want %t", image, got, latest)
+		}
+	}
+}
+
+const sha256Hex = "0000000000000000000000000000000000000000000000000000000000000000"
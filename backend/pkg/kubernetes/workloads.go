@@ -0,0 +1,693 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type StatefulSetInfo struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Replicas    int32             `json:"replicas"`
+	Ready       int32             `json:"ready"`
+	Updated     int32             `json:"updated"`
+	ServiceName string            `json:"service_name"`
+	Images      []string          `json:"images"`
+	Age         string            `json:"age"`
+	Labels      map[string]string `json:"labels"`
+}
+
+type DaemonSetInfo struct {
+	Name         string            `json:"name"`
+	Namespace    string            `json:"namespace"`
+	Desired      int32             `json:"desired"`
+	Current      int32             `json:"current"`
+	Ready        int32             `json:"ready"`
+	Updated      int32             `json:"updated"`
+	Available    int32             `json:"available"`
+	NodeSelector map[string]string `json:"node_selector,omitempty"`
+	Images       []string          `json:"images"`
+	Age          string            `json:"age"`
+	Labels       map[string]string `json:"labels"`
+}
+
+type JobInfo struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Status      string            `json:"status"`      // Running, Complete, Failed or Suspended
+	Completions string            `json:"completions"` // succeeded/desired
+	Active      int32             `json:"active"`
+	Failed      int32             `json:"failed"`
+	Duration    string            `json:"duration,omitempty"`
+	Owner       string            `json:"owner,omitempty"` // kind/name, e.g. the CronJob
+	Images      []string          `json:"images"`
+	Age         string            `json:"age"`
+	Labels      map[string]string `json:"labels"`
+}
+
+type CronJobInfo struct {
+	Name           string            `json:"name"`
+	Namespace      string            `json:"namespace"`
+	Schedule       string            `json:"schedule"`
+	TimeZone       string            `json:"time_zone,omitempty"`
+	Suspend        bool              `json:"suspend"`
+	Active         int               `json:"active"`
+	LastSchedule   *time.Time        `json:"last_schedule,omitempty"`
+	LastSuccessful *time.Time        `json:"last_successful,omitempty"`
+	Images         []string          `json:"images"`
+	Age            string            `json:"age"`
+	Labels         map[string]string `json:"labels"`
+}
+
+type ReplicaSetInfo struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Desired   int32             `json:"desired"`
+	Current   int32             `json:"current"`
+	Ready     int32             `json:"ready"`
+	Owner     string            `json:"owner,omitempty"`
+	Revision  string            `json:"revision,omitempty"`
+	Images    []string          `json:"images"`
+	Age       string            `json:"age"`
+	Labels    map[string]string `json:"labels"`
+}
+
+type ConfigMapInfo struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Keys      []string          `json:"keys"`
+	Immutable bool              `json:"immutable"`
+	Age       string            `json:"age"`
+	Labels    map[string]string `json:"labels"`
+}
+
+// SecretInfo lists the keys of a secret; Data is only filled when values
+// are explicitly requested.
+type SecretInfo struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Type      string            `json:"type"`
+	Keys      []string          `json:"keys"`
+	Data      map[string]string `json:"data,omitempty"`
+	Immutable bool              `json:"immutable"`
+	Age       string            `json:"age"`
+	Labels    map[string]string `json:"labels"`
+}
+
+type IngressRule struct {
+	Host    string `json:"host"`
+	Path    string `json:"path"`
+	Service string `json:"service"`
+	Port    string `json:"port"`
+}
+
+type IngressInfo struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Class     string            `json:"class,omitempty"`
+	Hosts     []string          `json:"hosts"`
+	Address   []string          `json:"address"`
+	TLSHosts  []string          `json:"tls_hosts,omitempty"`
+	Rules     []IngressRule     `json:"rules"`
+	Age       string            `json:"age"`
+	Labels    map[string]string `json:"labels"`
+}
+
+type PersistentVolumeClaimInfo struct {
+	Name         string            `json:"name"`
+	Namespace    string            `json:"namespace"`
+	Status       string            `json:"status"`
+	Volume       string            `json:"volume"`
+	Capacity     string            `json:"capacity"`
+	AccessModes  []string          `json:"access_modes"`
+	StorageClass string            `json:"storage_class"`
+	Age          string            `json:"age"`
+	Labels       map[string]string `json:"labels"`
+}
+
+type PersistentVolumeInfo struct {
+	Name          string            `json:"name"`
+	Status        string            `json:"status"`
+	Capacity      string            `json:"capacity"`
+	AccessModes   []string          `json:"access_modes"`
+	ReclaimPolicy string            `json:"reclaim_policy"`
+	Claim         string            `json:"claim,omitempty"` // namespace/name
+	StorageClass  string            `json:"storage_class"`
+	Reason        string            `json:"reason,omitempty"`
+	Age           string            `json:"age"`
+	Labels        map[string]string `json:"labels"`
+}
+
+type ServiceAccountInfo struct {
+	Name             string            `json:"name"`
+	Namespace        string            `json:"namespace"`
+	Secrets          int               `json:"secrets"`
+	ImagePullSecrets []string          `json:"image_pull_secrets,omitempty"`
+	AutomountToken   *bool             `json:"automount_token,omitempty"`
+	Age              string            `json:"age"`
+	Labels           map[string]string `json:"labels"`
+}
+
+type HPAInfo struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Target      string            `json:"target"` // kind/name of the scaled workload
+	MinReplicas int32             `json:"min_replicas"`
+	MaxReplicas int32             `json:"max_replicas"`
+	Current     int32             `json:"current"`
+	Desired     int32             `json:"desired"`
+	Metrics     []string          `json:"metrics"` // current/target, e.g. "cpu: 45%/80%"
+	Age         string            `json:"age"`
+	Labels      map[string]string `json:"labels"`
+}
+
+func (km *K8sManager) ListStatefulSets(namespace string) ([]StatefulSetInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	list, err := km.clientset.AppsV1().StatefulSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	return convertAll(list.Items, toStatefulSetInfo), nil
+}
+
+func (km *K8sManager) ListDaemonSets(namespace string) ([]DaemonSetInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	list, err := km.clientset.AppsV1().DaemonSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	return convertAll(list.Items, toDaemonSetInfo), nil
+}
+
+func (km *K8sManager) ListReplicaSets(namespace string) ([]ReplicaSetInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	list, err := km.clientset.AppsV1().ReplicaSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicasets: %w", err)
+	}
+	return convertAll(list.Items, toReplicaSetInfo), nil
+}
+
+func (km *K8sManager) ListJobs(namespace string) ([]JobInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	list, err := km.clientset.BatchV1().Jobs(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	return convertAll(list.Items, toJobInfo), nil
+}
+
+func (km *K8sManager) ListCronJobs(namespace string) ([]CronJobInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	list, err := km.clientset.BatchV1().CronJobs(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cronjobs: %w", err)
+	}
+	return convertAll(list.Items, toCronJobInfo), nil
+}
+
+func (km *K8sManager) ListConfigMaps(namespace string) ([]ConfigMapInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	list, err := km.clientset.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list configmaps: %w", err)
+	}
+	return convertAll(list.Items, toConfigMapInfo), nil
+}
+
+// ListSecrets lists secrets with their keys only.
+func (km *K8sManager) ListSecrets(namespace string) ([]SecretInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	list, err := km.clientset.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	return convertAll(list.Items, func(secret *corev1.Secret) SecretInfo {
+		return toSecretInfo(secret, false)
+	}), nil
+}
+
+func (km *K8sManager) ListIngresses(namespace string) ([]IngressInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	list, err := km.clientset.NetworkingV1().Ingresses(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+	return convertAll(list.Items, toIngressInfo), nil
+}
+
+func (km *K8sManager) ListPersistentVolumeClaims(namespace string) ([]PersistentVolumeClaimInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	list, err := km.clientset.CoreV1().PersistentVolumeClaims(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistentvolumeclaims: %w", err)
+	}
+	return convertAll(list.Items, toPersistentVolumeClaimInfo), nil
+}
+
+func (km *K8sManager) ListPersistentVolumes() ([]PersistentVolumeInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	list, err := km.clientset.CoreV1().PersistentVolumes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistentvolumes: %w", err)
+	}
+	return convertAll(list.Items, toPersistentVolumeInfo), nil
+}
+
+func (km *K8sManager) ListServiceAccounts(namespace string) ([]ServiceAccountInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	list, err := km.clientset.CoreV1().ServiceAccounts(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list serviceaccounts: %w", err)
+	}
+	return convertAll(list.Items, toServiceAccountInfo), nil
+}
+
+func (km *K8sManager) ListHPAs(namespace string) ([]HPAInfo, error) {
+	if !km.IsConnected() {
+		return nil, fmt.Errorf("not connected to Kubernetes cluster")
+	}
+	list, err := km.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list horizontalpodautoscalers: %w", err)
+	}
+	return convertAll(list.Items, toHPAInfo), nil
+}
+
+// convertAll maps API list items to Info structs.
+func convertAll[T any, I any](items []T, convert func(*T) I) []I {
+	result := make([]I, 0, len(items))
+	for i := range items {
+		result = append(result, convert(&items[i]))
+	}
+	return result
+}
+
+func objectAge(created metav1.Time) string {
+	return time.Since(created.Time).Round(time.Second).String()
+}
+
+// ownerRef formats the controlling owner as kind/name.
+func ownerRef(obj metav1.Object) string {
+	if owner := metav1.GetControllerOf(obj); owner != nil {
+		return owner.Kind + "/" + owner.Name
+	}
+	return ""
+}
+
+func toStatefulSetInfo(s *appsv1.StatefulSet) StatefulSetInfo {
+	replicas := int32(1)
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+	return StatefulSetInfo{
+		Name:        s.Name,
+		Namespace:   s.Namespace,
+		Replicas:    replicas,
+		Ready:       s.Status.ReadyReplicas,
+		Updated:     s.Status.UpdatedReplicas,
+		ServiceName: s.Spec.ServiceName,
+		Images:      templateImages(s.Spec.Template.Spec),
+		Age:         objectAge(s.CreationTimestamp),
+		Labels:      s.Labels,
+	}
+}
+
+func toDaemonSetInfo(ds *appsv1.DaemonSet) DaemonSetInfo {
+	return DaemonSetInfo{
+		Name:         ds.Name,
+		Namespace:    ds.Namespace,
+		Desired:      ds.Status.DesiredNumberScheduled,
+		Current:      ds.Status.CurrentNumberScheduled,
+		Ready:        ds.Status.NumberReady,
+		Updated:      ds.Status.UpdatedNumberScheduled,
+		Available:    ds.Status.NumberAvailable,
+		NodeSelector: ds.Spec.Template.Spec.NodeSelector,
+		Images:       templateImages(ds.Spec.Template.Spec),
+		Age:          objectAge(ds.CreationTimestamp),
+		Labels:       ds.Labels,
+	}
+}
+
+func toReplicaSetInfo(rs *appsv1.ReplicaSet) ReplicaSetInfo {
+	desired := int32(1)
+	if rs.Spec.Replicas != nil {
+		desired = *rs.Spec.Replicas
+	}
+	return ReplicaSetInfo{
+		Name:      rs.Name,
+		Namespace: rs.Namespace,
+		Desired:   desired,
+		Current:   rs.Status.Replicas,
+		Ready:     rs.Status.ReadyReplicas,
+		Owner:     ownerRef(rs),
+		Revision:  rs.Annotations[revisionAnnotation],
+		Images:    templateImages(rs.Spec.Template.Spec),
+		Age:       objectAge(rs.CreationTimestamp),
+		Labels:    rs.Labels,
+	}
+}
+
+func toJobInfo(job *batchv1.Job) JobInfo {
+	completions := int32(1)
+	if job.Spec.Completions != nil {
+		completions = *job.Spec.Completions
+	}
+
+	status := "Running"
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			status = "Complete"
+		case batchv1.JobFailed:
+			status = "Failed"
+		case batchv1.JobSuspended:
+			status = "Suspended"
+		}
+	}
+
+	info := JobInfo{
+		Name:        job.Name,
+		Namespace:   job.Namespace,
+		Status:      status,
+		Completions: fmt.Sprintf("%d/%d", job.Status.Succeeded, completions),
+		Active:      job.Status.Active,
+		Failed:      job.Status.Failed,
+		Owner:       ownerRef(job),
+		Images:      templateImages(job.Spec.Template.Spec),
+		Age:         objectAge(job.CreationTimestamp),
+		Labels:      job.Labels,
+	}
+	if start := job.Status.StartTime; start != nil {
+		end := time.Now()
+		if job.Status.CompletionTime != nil {
+			end = job.Status.CompletionTime.Time
+		}
+		info.Duration = end.Sub(start.Time).Round(time.Second).String()
+	}
+	return info
+}
+
+func toCronJobInfo(cj *batchv1.CronJob) CronJobInfo {
+	info := CronJobInfo{
+		Name:      cj.Name,
+		Namespace: cj.Namespace,
+		Schedule:  cj.Spec.Schedule,
+		Suspend:   cj.Spec.Suspend != nil && *cj.Spec.Suspend,
+		Active:    len(cj.Status.Active),
+		Images:    templateImages(cj.Spec.JobTemplate.Spec.Template.Spec),
+		Age:       objectAge(cj.CreationTimestamp),
+		Labels:    cj.Labels,
+	}
+	if cj.Spec.TimeZone != nil {
+		info.TimeZone = *cj.Spec.TimeZone
+	}
+	if cj.Status.LastScheduleTime != nil {
+		info.LastSchedule = &cj.Status.LastScheduleTime.Time
+	}
+	if cj.Status.LastSuccessfulTime != nil {
+		info.LastSuccessful = &cj.Status.LastSuccessfulTime.Time
+	}
+	return info
+}
+
+func toConfigMapInfo(cm *corev1.ConfigMap) ConfigMapInfo {
+	keys := make([]string, 0, len(cm.Data)+len(cm.BinaryData))
+	for key := range cm.Data {
+		keys = append(keys, key)
+	}
+	for key := range cm.BinaryData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return ConfigMapInfo{
+		Name:      cm.Name,
+		Namespace: cm.Namespace,
+		Keys:      keys,
+		Immutable: cm.Immutable != nil && *cm.Immutable,
+		Age:       objectAge(cm.CreationTimestamp),
+		Labels:    cm.Labels,
+	}
+}
+
+func toSecretInfo(secret *corev1.Secret, showValues bool) SecretInfo {
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	info := SecretInfo{
+		Name:      secret.Name,
+		Namespace: secret.Namespace,
+		Type:      string(secret.Type),
+		Keys:      keys,
+		Immutable: secret.Immutable != nil && *secret.Immutable,
+		Age:       objectAge(secret.CreationTimestamp),
+		Labels:    secret.Labels,
+	}
+	if showValues {
+		info.Data = make(map[string]string, len(secret.Data))
+		for key, value := range secret.Data {
+			info.Data[key] = string(value)
+		}
+	}
+	return info
+}
+
+func toIngressInfo(ing *networkingv1.Ingress) IngressInfo {
+	info := IngressInfo{
+		Name:      ing.Name,
+		Namespace: ing.Namespace,
+		Hosts:     []string{},
+		Address:   []string{},
+		Rules:     []IngressRule{},
+		Age:       objectAge(ing.CreationTimestamp),
+		Labels:    ing.Labels,
+	}
+	if ing.Spec.IngressClassName != nil {
+		info.Class = *ing.Spec.IngressClassName
+	}
+	for _, lb := range ing.Status.LoadBalancer.Ingress {
+		if lb.IP != "" {
+			info.Address = append(info.Address, lb.IP)
+		} else if lb.Hostname != "" {
+			info.Address = append(info.Address, lb.Hostname)
+		}
+	}
+	for _, tls := range ing.Spec.TLS {
+		info.TLSHosts = append(info.TLSHosts, tls.Hosts...)
+	}
+	if backend := ing.Spec.DefaultBackend; backend != nil && backend.Service != nil {
+		info.Rules = append(info.Rules, IngressRule{Host: "*", Path: "/", Service: backend.Service.Name, Port: backendPort(backend.Service.Port)})
+	}
+	for _, rule := range ing.Spec.Rules {
+		host := rule.Host
+		if host == "" {
+			host = "*"
+		}
+		info.Hosts = append(info.Hosts, host)
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			r := IngressRule{Host: host, Path: path.Path}
+			if path.Backend.Service != nil {
+				r.Service = path.Backend.Service.Name
+				r.Port = backendPort(path.Backend.Service.Port)
+			} else if path.Backend.Resource != nil {
+				r.Service = path.Backend.Resource.Kind + "/" + path.Backend.Resource.Name
+			}
+			info.Rules = append(info.Rules, r)
+		}
+	}
+	return info
+}
+
+func backendPort(port networkingv1.ServiceBackendPort) string {
+	if port.Name != "" {
+		return port.Name
+	}
+	return fmt.Sprint(port.Number)
+}
+
+func accessModes(modes []corev1.PersistentVolumeAccessMode) []string {
+	result := make([]string, 0, len(modes))
+	for _, mode := range modes {
+		result = append(result, string(mode))
+	}
+	return result
+}
+
+func toPersistentVolumeClaimInfo(pvc *corev1.PersistentVolumeClaim) PersistentVolumeClaimInfo {
+	info := PersistentVolumeClaimInfo{
+		Name:        pvc.Name,
+		Namespace:   pvc.Namespace,
+		Status:      string(pvc.Status.Phase),
+		Volume:      pvc.Spec.VolumeName,
+		AccessModes: accessModes(pvc.Status.AccessModes),
+		Age:         objectAge(pvc.CreationTimestamp),
+		Labels:      pvc.Labels,
+	}
+	if storage, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+		info.Capacity = storage.String()
+	}
+	if pvc.Spec.StorageClassName != nil {
+		info.StorageClass = *pvc.Spec.StorageClassName
+	}
+	return info
+}
+
+func toPersistentVolumeInfo(pv *corev1.PersistentVolume) PersistentVolumeInfo {
+	info := PersistentVolumeInfo{
+		Name:          pv.Name,
+		Status:        string(pv.Status.Phase),
+		AccessModes:   accessModes(pv.Spec.AccessModes),
+		ReclaimPolicy: string(pv.Spec.PersistentVolumeReclaimPolicy),
+		StorageClass:  pv.Spec.StorageClassName,
+		Reason:        pv.Status.Reason,
+		Age:           objectAge(pv.CreationTimestamp),
+		Labels:        pv.Labels,
+	}
+	if storage, ok := pv.Spec.Capacity[corev1.ResourceStorage]; ok {
+		info.Capacity = storage.String()
+	}
+	if claim := pv.Spec.ClaimRef; claim != nil {
+		info.Claim = claim.Namespace + "/" + claim.Name
+	}
+	return info
+}
+
+func toServiceAccountInfo(sa *corev1.ServiceAccount) ServiceAccountInfo {
+	info := ServiceAccountInfo{
+		Name:           sa.Name,
+		Namespace:      sa.Namespace,
+		Secrets:        len(sa.Secrets),
+		AutomountToken: sa.AutomountServiceAccountToken,
+		Age:            objectAge(sa.CreationTimestamp),
+		Labels:         sa.Labels,
+	}
+	for _, ref := range sa.ImagePullSecrets {
+		info.ImagePullSecrets = append(info.ImagePullSecrets, ref.Name)
+	}
+	return info
+}
+
+func toHPAInfo(hpa *autoscalingv2.HorizontalPodAutoscaler) HPAInfo {
+	info := HPAInfo{
+		Name:        hpa.Name,
+		Namespace:   hpa.Namespace,
+		Target:      hpa.Spec.ScaleTargetRef.Kind + "/" + hpa.Spec.ScaleTargetRef.Name,
+		MinReplicas: 1,
+		MaxReplicas: hpa.Spec.MaxReplicas,
+		Current:     hpa.Status.CurrentReplicas,
+		Desired:     hpa.Status.DesiredReplicas,
+		Metrics:     []string{},
+		Age:         objectAge(hpa.CreationTimestamp),
+		Labels:      hpa.Labels,
+	}
+	if hpa.Spec.MinReplicas != nil {
+		info.MinReplicas = *hpa.Spec.MinReplicas
+	}
+
+	// Current values are reported in the same order as the spec
+	for i, metric := range hpa.Spec.Metrics {
+		var current *autoscalingv2.MetricStatus
+		if i < len(hpa.Status.CurrentMetrics) {
+			current = &hpa.Status.CurrentMetrics[i]
+		}
+		info.Metrics = append(info.Metrics, formatHPAMetric(metric, current))
+	}
+	return info
+}
+
+func formatHPAMetric(spec autoscalingv2.MetricSpec, status *autoscalingv2.MetricStatus) string {
+	var name string
+	var target autoscalingv2.MetricTarget
+	var current *autoscalingv2.MetricValueStatus
+
+	switch spec.Type {
+	case autoscalingv2.ResourceMetricSourceType:
+		name, target = string(spec.Resource.Name), spec.Resource.Target
+		if status != nil && status.Resource != nil {
+			current = &status.Resource.Current
+		}
+	case autoscalingv2.ContainerResourceMetricSourceType:
+		name, target = spec.ContainerResource.Container+"/"+string(spec.ContainerResource.Name), spec.ContainerResource.Target
+		if status != nil && status.ContainerResource != nil {
+			current = &status.ContainerResource.Current
+		}
+	case autoscalingv2.PodsMetricSourceType:
+		name, target = spec.Pods.Metric.Name, spec.Pods.Target
+		if status != nil && status.Pods != nil {
+			current = &status.Pods.Current
+		}
+	case autoscalingv2.ObjectMetricSourceType:
+		name, target = spec.Object.Metric.Name, spec.Object.Target
+		if status != nil && status.Object != nil {
+			current = &status.Object.Current
+		}
+	case autoscalingv2.ExternalMetricSourceType:
+		name, target = spec.External.Metric.Name, spec.External.Target
+		if status != nil && status.External != nil {
+			current = &status.External.Current
+		}
+	default:
+		return strings.ToLower(string(spec.Type))
+	}
+
+	value := func(utilization *int32, average, absolute *resource.Quantity) string {
+		switch {
+		case utilization != nil:
+			return fmt.Sprintf("%d%%", *utilization)
+		case average != nil:
+			return average.String()
+		case absolute != nil:
+			return absolute.String()
+		}
+		return "<unknown>"
+	}
+
+	wanted := value(target.AverageUtilization, target.AverageValue, target.Value)
+	got := "<unknown>"
+	if current != nil {
+		got = value(current.AverageUtilization, current.AverageValue, current.Value)
+	}
+	return fmt.Sprintf("%s: %s/%s", name, got, wanted)
+}
@@ -121,6 +121,58 @@ export namespace docker {
     dockerfilePath: string,
     tag: string
   ): Promise<void>;
+
+  export interface DiskItem {
+    id: string;
+    name: string;
+    size: number;
+    inUse: boolean;
+    dangling?: boolean;
+    created: string;
+    labels?: Record<string, string>;
+  }
+
+  export interface DiskUsageCategory {
+    total: number;
+    active: number;
+    size: number;
+    reclaimable: number;
+    items: DiskItem[];
+  }
+
+  export interface DiskUsage {
+    images: DiskUsageCategory;
+    containers: DiskUsageCategory;
+    volumes: DiskUsageCategory;
+    buildCache: DiskUsageCategory;
+    layersSize: number;
+    totalSize: number;
+    totalReclaimable: number;
+  }
+
+  export type PruneTarget = 'containers' | 'images' | 'volumes' | 'networks' | 'build-cache';
+
+  export interface PruneOptions {
+    targets?: PruneTarget[];
+    all?: boolean;
+    until?: string;
+    labels?: string[];
+    dryRun?: boolean;
+  }
+
+  export interface PruneResult {
+    dryRun: boolean;
+    targets: {
+      target: PruneTarget;
+      items: DiskItem[];
+      spaceReclaimed: number;
+      error?: string;
+    }[];
+    spaceReclaimed: number;
+  }
+
+  export function getDiskUsage(): Promise<DiskUsage>;
+  export function prune(options?: PruneOptions): Promise<PruneResult>;
 }
 
 // Kubernetes API